@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/margined-protocol/flood/internal/notify"
+)
+
+// alerter forwards startup problems to the notifier, delivery failures are
+// logged but never stop the bot
+type alerter struct {
+	ctx context.Context
+	l   *zap.Logger
+	n   notify.Notifier
+}
+
+func (a alerter) send(msg notify.Message) {
+	if err := a.n.Notify(a.ctx, msg); err != nil {
+		a.l.Warn("Failed to send notification", zap.Error(err))
+	}
+}
+
+// fatal sends a critical alert before exiting
+func (a alerter) fatal(event notify.Event, title string, err error) {
+	a.send(notify.Message{
+		Event:    event,
+		Severity: notify.SeverityCritical,
+		Title:    title,
+		Text:     err.Error(),
+	})
+	a.l.Fatal(title, zap.Error(err))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	sdkmath "cosmossdk.io/math"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/osmosis-labs/osmosis/osmomath"
+
+	"github.com/margined-protocol/flood/internal/backtest"
+	"github.com/margined-protocol/flood/internal/config"
+	"github.com/margined-protocol/flood/internal/logger"
+	"github.com/margined-protocol/flood/internal/units"
+)
+
+// runBacktest implements the backtest subcommand, it replays a recorded time
+// series through the strategy using the position settings from the config
+func runBacktest(args []string) error {
+	fs := flag.NewFlagSet("backtest", flag.ExitOnError)
+	configPath := fs.String("c", "config.toml", "path to config file")
+	dataPath := fs.String("data", "", "path to a CSV with time, base_price, power_price and normalisation_factor columns")
+	indexScale := fs.Int("index-scale", 10000, "index scale of the power contract")
+	exponent := fs.String("exponent", "", "exponent of the power perpetual, defaults to the power pool's or 2")
+	spreadFactor := fs.String("spread-factor", "0.002", "swap fee of the power pool")
+	spread := fs.String("spread", "", "override the position spreads from the config with one for both sides")
+	asJSON := fs.Bool("json", false, "print the full report including the inventory path as JSON")
+	showInventory := fs.Bool("inventory", false, "print the inventory after every sample")
+	_ = fs.Parse(args)
+
+	if *dataPath == "" {
+		return fmt.Errorf("-data is required")
+	}
+
+	l, err := logger.Setup()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	samples, err := backtest.LoadCSV(*dataPath)
+	if err != nil {
+		return err
+	}
+
+	sf, err := osmomath.NewDecFromStr(*spreadFactor)
+	if err != nil {
+		return fmt.Errorf("invalid spread factor: %w", err)
+	}
+
+	// Amounts in whole units need their decimals under [[assets]]
+	registry := units.NewRegistry(cfg.Assets, nil)
+	ctx := context.Background()
+
+	token0, err := registry.Coin(ctx, cfg.PowerPool.BaseAsset, cfg.Position.DefaultToken0Amount)
+	if err != nil {
+		return fmt.Errorf("invalid default_token_0_amount: %w", err)
+	}
+	token1, err := registry.Coin(ctx, cfg.PowerPool.QuoteAsset, cfg.Position.DefaultToken1Amount)
+	if err != nil {
+		return fmt.Errorf("invalid default_token_1_amount: %w", err)
+	}
+
+	params := backtest.Params{
+		Position:     cfg.Position,
+		IndexScale:   *indexScale,
+		Exponent:     *exponent,
+		SpreadFactor: sf,
+		Token0:       token0,
+		Token1:       token1,
+	}
+	if params.Exponent == "" {
+		params.Exponent = cfg.PowerPool.Exponent
+	}
+	if *spread != "" {
+		params.Position.Spread = *spread
+		params.Position.BuySpread, params.Position.SellSpread = "", ""
+	}
+
+	report, err := backtest.Run(l, samples, params)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	if *showInventory {
+		fmt.Fprintln(w, "time\tprice\ttarget\ttick\tamount0\tamount1\tvalue\thodl\trebalanced")
+		for _, p := range report.Inventory {
+			fmt.Fprintf(w, "%s\t%f\t%f\t%d\t%s\t%s\t%f\t%f\t%t\n",
+				p.Time.Format("2006-01-02T15:04:05Z07:00"), p.Price, p.TargetPrice, p.Tick,
+				p.Amount0, p.Amount1, p.Value, p.HodlValue, p.Rebalanced)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "samples\t%d\n", report.Samples)
+	fmt.Fprintf(w, "rebalances\t%d\n", report.Rebalances)
+	fmt.Fprintf(w, "skipped\t%d\n", report.Skipped)
+	fmt.Fprintf(w, "fills\t%d\n", report.Fills)
+	describe := func(amount sdkmath.Int, denom string) string {
+		return registry.Describe(ctx, sdk.Coin{Denom: denom, Amount: amount})
+	}
+
+	fmt.Fprintf(w, "initial inventory\t%s, %s\n", describe(token0.Amount, token0.Denom), describe(token1.Amount, token1.Denom))
+	fmt.Fprintf(w, "filled token0\t%s\n", describe(report.FilledToken0, params.Token0.Denom))
+	fmt.Fprintf(w, "fees\t%s, %s\n", describe(report.FeesToken0, params.Token0.Denom), describe(report.FeesToken1, params.Token1.Denom))
+	fmt.Fprintf(w, "fees value\t%f\n", report.FeesValue)
+	fmt.Fprintf(w, "initial value\t%f\n", report.InitialValue)
+	fmt.Fprintf(w, "final value\t%f\n", report.FinalValue)
+	fmt.Fprintf(w, "hodl value\t%f\n", report.HodlValue)
+	fmt.Fprintf(w, "impermanent loss\t%f (%.4f%%)\n", report.ImpermanentLoss, report.ImpermanentLossPct*100)
+
+	return w.Flush()
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/margined-protocol/flood/internal/admin"
+	"github.com/margined-protocol/flood/internal/engine"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+const defaultInterval = 5 * time.Minute
+
+// bot runs market making cycles and implements admin.Controller
+type bot struct {
+	cycle *engine.Cycle
+
+	// mu serialises cycles and admin actions that broadcast transactions
+	mu sync.Mutex
+
+	statusMu sync.RWMutex
+	status   admin.Status
+}
+
+func newBot(cycle *engine.Cycle) *bot {
+	return &bot{cycle: cycle}
+}
+
+// runCycle runs a cycle and records the result in the status
+func (b *bot) runCycle(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	result := b.cycle.Run(ctx, b.isPaused())
+
+	// Keep any pause requested while the cycle was running
+	b.statusMu.Lock()
+	status := statusFromResult(result)
+	status.Paused = b.status.Paused
+	b.status = status
+	b.statusMu.Unlock()
+
+	return result.Err
+}
+
+// statusFromResult converts a cycle result for the admin API
+func statusFromResult(result engine.CycleResult) admin.Status {
+	status := admin.Status{
+		LastCycle: result.Start,
+		Positions: result.Positions,
+		Decision:  string(result.Decision),
+		TxHash:    result.TxHash,
+		Endpoints: result.Endpoints,
+	}
+
+	if result.Err != nil {
+		status.Error = result.Err.Error()
+	}
+
+	if result.Balances != nil {
+		status.Idle = result.Balances.Idle
+	}
+
+	if m := result.Market; m != nil {
+		status.Snapshot = &admin.Snapshot{
+			Height:              m.Height,
+			BlockTime:           m.BlockTime,
+			BaseSpotPrice:       m.BaseSpotPrice,
+			PowerSpotPrice:      m.PowerSpotPrice,
+			MarkPrice:           m.MarkPrice,
+			IndexPrice:          m.IndexPrice,
+			TargetPrice:         m.TargetPrice,
+			Premium:             m.Premium,
+			NormalisationFactor: m.NormalisationFactor,
+			CurrentTick:         m.CurrentTick,
+		}
+	}
+
+	return status
+}
+
+func (b *bot) isPaused() bool {
+	b.statusMu.RLock()
+	defer b.statusMu.RUnlock()
+	return b.status.Paused
+}
+
+func (b *bot) setPaused(paused bool) {
+	b.statusMu.Lock()
+	defer b.statusMu.Unlock()
+	b.status.Paused = paused
+}
+
+// Status returns the result of the last cycle
+func (b *bot) Status() admin.Status {
+	b.statusMu.RLock()
+	defer b.statusMu.RUnlock()
+	return b.status
+}
+
+// Pause stops the bot placing liquidity, existing positions are left open
+func (b *bot) Pause() {
+	b.setPaused(true)
+}
+
+// Resume lets the bot place liquidity again from the next cycle
+func (b *bot) Resume() {
+	b.setPaused(false)
+}
+
+// Rebalance forces a cycle immediately
+func (b *bot) Rebalance(ctx context.Context) error {
+	return b.runCycle(ctx)
+}
+
+// WithdrawAll pauses the bot and withdraws every position it holds in the
+// power pool
+func (b *bot) WithdrawAll(ctx context.Context) (string, error) {
+	b.Pause()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	result := b.cycle.WithdrawAll(ctx)
+	if result.Err != nil {
+		return "", result.Err
+	}
+
+	b.statusMu.Lock()
+	b.status.LastCycle = result.Start
+	b.status.Positions = nil
+	b.status.Decision = string(result.Decision)
+	b.status.TxHash = result.TxHash
+	b.status.Error = ""
+	b.statusMu.Unlock()
+
+	return result.TxHash, nil
+}
+
+// runDaemon runs a cycle every interval and serves the admin API until the
+// context is cancelled
+func runDaemon(ctx context.Context, l *zap.Logger, cfg *types.Config, b *bot) error {
+	interval := cfg.Daemon.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	if cfg.Admin.ListenAddress != "" {
+		srv, err := admin.NewServer(l, cfg.Admin, b)
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			l.Info("Admin API listening", zap.String("address", cfg.Admin.ListenAddress))
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				l.Error("Admin API stopped", zap.Error(err))
+			}
+		}()
+
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = srv.Shutdown(shutdownCtx)
+		}()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := b.runCycle(ctx); err != nil {
+			l.Error("Cycle failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			l.Info("Shutting down")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
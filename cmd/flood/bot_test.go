@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sdkmath "cosmossdk.io/math"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/ignite/cli/ignite/pkg/cosmosaccount"
+	"github.com/osmosis-labs/osmosis/osmomath"
+	clmath "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/math"
+	cltypes "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/types"
+	pmtypes "github.com/osmosis-labs/osmosis/v21/x/poolmanager/types"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/config"
+	"github.com/margined-protocol/flood/internal/engine"
+	"github.com/margined-protocol/flood/internal/mock"
+	"github.com/margined-protocol/flood/internal/notify"
+	"github.com/margined-protocol/flood/internal/simulator"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+const (
+	testAddress  = "osmo1bot"
+	testContract = "osmo1power"
+	baseDenom    = "uosmo"
+	powerDenom   = "usqosmo"
+	usdcDenom    = "uusdc"
+)
+
+const testConfig = `
+address_prefix = "osmo"
+fees = "10000uosmo"
+signer_account = "bot"
+
+[power_pool]
+pool_id          = 2
+base_asset       = "uosmo"
+quote_asset      = "usqosmo"
+contract_address = "osmo1power"
+
+[position]
+default_token_0_amount = 1000000
+default_token_1_amount = 1000
+spread                 = "0.1"
+
+[notifier]
+low_gas_threshold = 1000
+`
+
+type fixture struct {
+	chain *mock.Chain
+	tx    *mock.Broadcaster
+	pool  *simulator.Pool
+	bot   *bot
+}
+
+// newFixture loads the test config and points a bot at a mock chain where
+// the power pool is priced at the target
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	assert.NilError(t, os.WriteFile(path, []byte(testConfig), 0o600))
+
+	cfg, err := config.LoadConfig(path)
+	assert.NilError(t, err)
+
+	chain := mock.NewChain()
+
+	// Base price 10 with an index scale of 10000 values power at 0.001 uosmo,
+	// a target of 1000 usqosmo per uosmo which is the pool price as token0 is
+	// uosmo
+	assert.NilError(t, chain.SetContractQuery(testContract, "config", types.GetConfigResponse{
+		PowerAsset: types.Asset{Denom: powerDenom},
+		BaseAsset:  types.Asset{Denom: baseDenom},
+		BasePool:   types.Pool{ID: 1, BaseDenom: baseDenom, QuoteDenom: usdcDenom},
+		PowerPool:  types.Pool{ID: 2, BaseDenom: powerDenom, QuoteDenom: baseDenom},
+		IndexScale: types.NewUint(10000),
+		Version:    "0.1.0",
+	}))
+	assert.NilError(t, chain.SetContractQuery(testContract, "state", types.GetStateResponse{
+		IsOpen:              true,
+		NormalisationFactor: "1",
+	}))
+	chain.SetSpotPrice(1, baseDenom, usdcDenom, "10")
+	chain.SetBalance(testAddress, sdk.NewInt64Coin(baseDenom, 1_000_000_000), sdk.NewInt64Coin(powerDenom, 1_000_000))
+
+	tick, err := clmath.CalculatePriceToTick(osmomath.MustNewBigDecFromStr("1000"))
+	assert.NilError(t, err)
+
+	pool, err := simulator.NewPool(2, baseDenom, powerDenom, 100, osmomath.MustNewDecFromStr("0.002"), tick)
+	assert.NilError(t, err)
+	chain.AddPool(pool)
+
+	conn, err := chain.Start()
+	assert.NilError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+		chain.Stop()
+	})
+
+	tx := mock.NewBroadcaster(chain)
+
+	return &fixture{
+		chain: chain,
+		tx:    tx,
+		pool:  pool,
+		bot: newBot(&engine.Cycle{
+			Logger:      zap.NewNop(),
+			Config:      cfg,
+			Account:     cosmosaccount.Account{Name: "bot"},
+			Address:     testAddress,
+			Querier:     engine.NewGRPCQuerier(conn, testContract, 0),
+			Broadcaster: tx,
+			Strategy:    engine.LiquidityStrategy{},
+			Notifier:    notify.Nop{},
+		}),
+	}
+}
+
+func TestCycleOpensAndRebalancesPositions(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	assert.NilError(t, f.bot.runCycle(ctx))
+
+	txs := f.tx.Txs()
+	assert.Equal(t, 1, len(txs))
+	assert.Equal(t, 2, len(txs[0].Msgs))
+
+	buy := txs[0].Msgs[0].(*cltypes.MsgCreatePosition)
+	sell := txs[0].Msgs[1].(*cltypes.MsgCreatePosition)
+	assert.Assert(t, buy.UpperTick < f.pool.CurrentTick())
+	assert.Assert(t, sell.LowerTick > f.pool.CurrentTick())
+	assert.Equal(t, powerDenom, buy.TokensProvided[0].Denom)
+	assert.Equal(t, baseDenom, sell.TokensProvided[0].Denom)
+
+	status := f.bot.Status()
+	assert.Equal(t, string(engine.DecisionRebalanced), status.Decision)
+	assert.Equal(t, txs[0].Hash, status.TxHash)
+	assert.Equal(t, 0.0, status.Snapshot.Premium)
+	assert.Equal(t, "999000000uosmo,999000usqosmo", status.Idle.String())
+
+	// The positions now exist on chain so the next cycle replaces them
+	assert.Equal(t, 2, len(f.pool.Positions(testAddress)))
+	assert.NilError(t, f.bot.runCycle(ctx))
+
+	msgs := f.tx.Last()
+	assert.Equal(t, 4, len(msgs))
+	_, ok := msgs[0].(*cltypes.MsgWithdrawPosition)
+	assert.Assert(t, ok)
+	_, ok = msgs[1].(*cltypes.MsgWithdrawPosition)
+	assert.Assert(t, ok)
+	assert.Equal(t, 2, len(f.pool.Positions(testAddress)))
+	assert.Equal(t, 2, len(f.bot.Status().Positions))
+}
+
+func TestCycleOrientsReversedPool(t *testing.T) {
+	f := newFixture(t)
+
+	// The same market in a pool created with power as token0, priced in
+	// uosmo per power
+	tick, err := clmath.CalculatePriceToTick(osmomath.MustNewBigDecFromStr("0.001"))
+	assert.NilError(t, err)
+	pool, err := simulator.NewPool(2, powerDenom, baseDenom, 100, osmomath.MustNewDecFromStr("0.002"), tick)
+	assert.NilError(t, err)
+	f.chain.AddPool(pool)
+
+	assert.NilError(t, f.bot.runCycle(context.Background()))
+
+	msgs := f.tx.Last()
+	assert.Equal(t, 2, len(msgs))
+
+	buy := msgs[0].(*cltypes.MsgCreatePosition)
+	sell := msgs[1].(*cltypes.MsgCreatePosition)
+	assert.Assert(t, buy.UpperTick < pool.CurrentTick())
+	assert.Assert(t, sell.LowerTick > pool.CurrentTick())
+
+	// Each default amount stays with its configured denom
+	assert.Equal(t, sdk.NewInt64Coin(baseDenom, 1000000).String(), buy.TokensProvided.String())
+	assert.Equal(t, sdk.NewInt64Coin(powerDenom, 1000).String(), sell.TokensProvided.String())
+	assert.Equal(t, 0.0, f.bot.Status().Snapshot.Premium)
+}
+
+func TestCyclePlacesRangesBetweenPoolAndTarget(t *testing.T) {
+	// The target is 1000 usqosmo per uosmo, where mark equals the index
+	target, err := clmath.CalculatePriceToTick(osmomath.MustNewBigDecFromStr("1000"))
+	assert.NilError(t, err)
+
+	for _, tc := range []struct {
+		name      string
+		poolPrice string
+		mark      float64
+	}{
+		// Fewer power per uosmo than the target, power trades at a premium
+		{name: "premium", poolPrice: "800", mark: 125},
+		// More power per uosmo than the target, power trades at a discount
+		{name: "discount", poolPrice: "1250", mark: 80},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFixture(t)
+
+			tick, err := clmath.CalculatePriceToTick(osmomath.MustNewBigDecFromStr(tc.poolPrice))
+			assert.NilError(t, err)
+			pool, err := simulator.NewPool(2, baseDenom, powerDenom, 100, osmomath.MustNewDecFromStr("0.002"), tick)
+			assert.NilError(t, err)
+			f.chain.AddPool(pool)
+
+			assert.NilError(t, f.bot.runCycle(context.Background()))
+			assert.Equal(t, tc.mark, f.bot.Status().Snapshot.MarkPrice)
+
+			msgs := f.tx.Last()
+			assert.Equal(t, 2, len(msgs))
+
+			buy := msgs[0].(*cltypes.MsgCreatePosition)
+			sell := msgs[1].(*cltypes.MsgCreatePosition)
+			assert.Assert(t, buy.UpperTick < pool.CurrentTick())
+			assert.Assert(t, sell.LowerTick > pool.CurrentTick())
+
+			// The target bounds the range on its side of the pool price
+			if pool.CurrentTick() < target {
+				assert.Equal(t, target, sell.LowerTick)
+			} else {
+				assert.Equal(t, target, buy.UpperTick)
+			}
+		})
+	}
+}
+
+func TestCycleReadsTheMarketAtOneHeight(t *testing.T) {
+	f := newFixture(t)
+	blockTime := time.Unix(1700000000, 0).UTC()
+	f.chain.SetBlock(500, blockTime)
+
+	assert.NilError(t, f.bot.runCycle(context.Background()))
+
+	for _, method := range []string{
+		"/cosmwasm.wasm.v1.Query/SmartContractState",
+		"/osmosis.poolmanager.v1beta1.Query/SpotPrice",
+		"/osmosis.poolmanager.v1beta1.Query/Pool",
+		"/osmosis.concentratedliquidity.v1beta1.Query/UserPositions",
+		// Balances are read after the snapshot, sizing positions
+		"/cosmos.bank.v1beta1.Query/Balance",
+	} {
+		assert.Equal(t, int64(500), f.chain.QueryHeight(method), method)
+	}
+
+	snapshot := f.bot.Status().Snapshot
+	assert.Equal(t, int64(500), snapshot.Height)
+	assert.Equal(t, blockTime, snapshot.BlockTime)
+}
+
+func TestCycleRejectsUnsupportedContractVersion(t *testing.T) {
+	f := newFixture(t)
+
+	assert.NilError(t, f.chain.SetContractQuery(testContract, "config", types.GetConfigResponse{
+		PowerPool:  types.Pool{ID: 2, BaseDenom: powerDenom, QuoteDenom: baseDenom},
+		IndexScale: types.NewUint(10000),
+		Version:    "1.2.0",
+	}))
+
+	err := f.bot.runCycle(context.Background())
+	assert.ErrorContains(t, err, "unsupported power contract version 1.2.0")
+	assert.Equal(t, 0, len(f.tx.Txs()))
+}
+
+func TestCycleReportsFailures(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	f.chain.Fail("/osmosis.poolmanager.v1beta1.Query/SpotPrice", status.Error(codes.Unavailable, "node down"))
+
+	err := f.bot.runCycle(ctx)
+	assert.ErrorContains(t, err, "Failed to fetch spot prices")
+	assert.Equal(t, string(engine.DecisionFailed), f.bot.Status().Decision)
+
+	f.chain.Fail("/osmosis.poolmanager.v1beta1.Query/SpotPrice", nil)
+	f.tx.FailWith(errors.New("out of gas"))
+
+	err = f.bot.runCycle(ctx)
+	assert.ErrorContains(t, err, "out of gas")
+	assert.Equal(t, 0, len(f.tx.Txs()))
+	assert.Equal(t, 0, len(f.pool.Positions(testAddress)))
+}
+
+func TestCycleNamesEveryFailedQuery(t *testing.T) {
+	f := newFixture(t)
+
+	f.chain.Fail("/osmosis.poolmanager.v1beta1.Query/SpotPrice", status.Error(codes.Unavailable, "node down"))
+	f.chain.Fail("/osmosis.concentratedliquidity.v1beta1.Query/UserPositions", status.Error(codes.Internal, "store error"))
+
+	err := f.bot.runCycle(context.Background())
+	assert.ErrorContains(t, err, "Failed to fetch spot prices")
+	assert.ErrorContains(t, err, "base spot price: rpc error")
+	assert.ErrorContains(t, err, "power spot price: rpc error")
+	assert.ErrorContains(t, err, "user positions: rpc error: code = Internal desc = store error")
+}
+
+func TestCycleHedgesDelta(t *testing.T) {
+	f := newFixture(t)
+
+	// Replace the scripted base price with a pool deep enough to hedge against
+	tick, err := clmath.CalculatePriceToTick(osmomath.MustNewBigDecFromStr("10"))
+	assert.NilError(t, err)
+	basePool, err := simulator.NewPool(1, baseDenom, usdcDenom, 100, osmomath.MustNewDecFromStr("0.002"), tick)
+	assert.NilError(t, err)
+	_, err = basePool.CreatePosition("osmo1lp", 8_000_000, 10_000_000,
+		sdk.NewCoins(sdk.NewInt64Coin(baseDenom, 1_000_000_000_000), sdk.NewInt64Coin(usdcDenom, 1_000_000_000_000)))
+	assert.NilError(t, err)
+	f.chain.AddPool(basePool)
+
+	store := engine.NewMemoryStore(1)
+	f.bot.cycle.Store = store
+	f.bot.cycle.Config.Hedge = types.Hedge{Enabled: true, Band: types.RawAmount(sdkmath.NewInt(100_000)), MaxTrade: types.RawAmount(sdkmath.NewInt(1_000_000)), MaxSlippage: "0.05"}
+
+	// The idle uosmo balance is far outside the band so some is sold
+	assert.NilError(t, f.bot.runCycle(context.Background()))
+
+	msgs := f.tx.Last()
+	assert.Equal(t, 3, len(msgs))
+	swap, ok := msgs[2].(*pmtypes.MsgSwapExactAmountIn)
+	assert.Assert(t, ok)
+	assert.Equal(t, uint64(1), swap.Routes[0].PoolId)
+	assert.Equal(t, usdcDenom, swap.Routes[0].TokenOutDenom)
+	assert.Equal(t, "1000000"+baseDenom, swap.TokenIn.String())
+	assert.Assert(t, basePool.CurrentTick() < tick)
+
+	results, err := store.Recent(1)
+	assert.NilError(t, err)
+	trade := results[0].Hedge
+	assert.Assert(t, trade != nil)
+	assert.Assert(t, trade.Sell)
+	assert.Assert(t, trade.TokenOut.Amount.GTE(swap.TokenOutMinAmount))
+	assert.Assert(t, trade.TokenOut.Amount.LT(trade.ExpectedOut.Amount))
+	assert.Assert(t, trade.Cost > 0)
+}
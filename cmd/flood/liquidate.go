@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/margined-protocol/flood/internal/engine"
+	"github.com/margined-protocol/flood/internal/liquidation"
+	"github.com/margined-protocol/flood/internal/notify"
+)
+
+// runLiquidate implements the liquidate subcommand, it scans the vaults of
+// every configured power contract and liquidates the profitable ones
+func runLiquidate(args []string) error {
+	fs := flag.NewFlagSet("liquidate", flag.ExitOnError)
+	configPath := fs.String("c", "config.toml", "path to config file")
+	dryRun := fs.Bool("dry-run", false, "Price and simulate liquidations without broadcasting them")
+	_ = fs.Parse(args)
+
+	ctx := context.Background()
+
+	l, cfg, client, conn := initialize(ctx, *configPath)
+	defer conn.Close()
+
+	account, err := client.Account(cfg.SignerAccount)
+	if err != nil {
+		return fmt.Errorf("error fetching signer account: %w", err)
+	}
+
+	address, err := account.Address(cfg.AddressPrefix)
+	if err != nil {
+		return fmt.Errorf("error fetching signer address: %w", err)
+	}
+
+	n, err := notify.New(cfg.Notifier)
+	if err != nil {
+		return fmt.Errorf("failed to initialise notifier: %w", err)
+	}
+
+	liquidator := &liquidation.Liquidator{
+		Logger:  l,
+		Config:  cfg,
+		Account: account,
+		Address: address,
+		Querier: func(contract string) liquidation.Querier {
+			return engine.NewGRPCQuerier(conn, contract, cfg.Endpoints.QueryTimeout)
+		},
+		Broadcaster: client,
+		Simulator:   client,
+		Notifier:    n,
+		DryRun:      *dryRun,
+	}
+
+	results, err := liquidator.Run(ctx)
+	for _, res := range results {
+		l.Info("Liquidation result",
+			zap.String("contract", res.Contract),
+			zap.Uint64("vault_id", res.Liquidation.ID),
+			zap.String("tx_hash", res.TxHash),
+			zap.Error(res.Err),
+		)
+	}
+
+	return err
+}
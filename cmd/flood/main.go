@@ -6,27 +6,28 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"strconv"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"go.uber.org/zap"
 
-	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
-
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	feegranttypes "github.com/cosmos/cosmos-sdk/x/feegrant"
 
 	"github.com/margined-protocol/flood/internal/config"
-	"github.com/margined-protocol/flood/internal/liquidity"
+	"github.com/margined-protocol/flood/internal/endpoints"
+	"github.com/margined-protocol/flood/internal/engine"
+	"github.com/margined-protocol/flood/internal/feegrant"
 	"github.com/margined-protocol/flood/internal/logger"
-	"github.com/margined-protocol/flood/internal/maths"
-	"github.com/margined-protocol/flood/internal/power"
-	"github.com/margined-protocol/flood/internal/queries"
+	"github.com/margined-protocol/flood/internal/notify"
 	"github.com/margined-protocol/flood/internal/types"
 
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
 	"github.com/ignite/cli/ignite/pkg/cosmosaccount"
 	"github.com/ignite/cli/ignite/pkg/cosmosclient"
-	clquery "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/client/queryproto"
-	pmquery "github.com/osmosis-labs/osmosis/v21/x/poolmanager/client/queryproto"
+	cltypes "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/types"
+	pmtypes "github.com/osmosis-labs/osmosis/v21/x/poolmanager/types"
 )
 
 var (
@@ -35,18 +36,25 @@ var (
 	BuildDate   string
 	configPath  *string
 	showVersion *bool
+	daemon      *bool
+	dryRun      *bool
 )
 
+// resultHistory is the number of cycle results kept in memory
+const resultHistory = 100
+
 func parseFlags() {
 	configPath = flag.String("c", "config.toml", "path to config file")
 	showVersion = flag.Bool("v", false, "Print the version of the program")
+	daemon = flag.Bool("d", false, "Run continuously as a daemon with the admin API")
+	dryRun = flag.Bool("dry-run", false, "Build and log messages without broadcasting them")
 	flag.Parse()
 }
 
 // setup client initialises a cosmos client that maybe used to submit transactions
-func setupCosmosClient(ctx context.Context, cfg *types.Config) (*cosmosclient.Client, error) {
+func setupCosmosClient(ctx context.Context, cfg *types.Config, rpcAddress string) (*cosmosclient.Client, error) {
 	opts := []cosmosclient.Option{
-		cosmosclient.WithNodeAddress(cfg.RPCServerAddress),
+		cosmosclient.WithNodeAddress(rpcAddress),
 		cosmosclient.WithGas(cfg.Gas),
 		cosmosclient.WithGasAdjustment(cfg.GasAdjustment),
 		cosmosclient.WithAddressPrefix(cfg.AddressPrefix),
@@ -56,6 +64,15 @@ func setupCosmosClient(ctx context.Context, cfg *types.Config) (*cosmosclient.Cl
 		cosmosclient.WithKeyringServiceName(cfg.Key.AppName),
 	}
 
+	// Pay fees from the granter's allowance if one is configured
+	if cfg.FeeGranter != "" {
+		signer, err := feegrant.NewSigner(cfg.FeeGranter, cfg.AddressPrefix)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, cosmosclient.WithSigner(signer))
+	}
+
 	client, err := cosmosclient.New(ctx, opts...)
 	if err != nil {
 		return nil, err
@@ -64,17 +81,38 @@ func setupCosmosClient(ctx context.Context, cfg *types.Config) (*cosmosclient.Cl
 	return &client, nil
 }
 
-// setup GRPC connection establishes a GRPC connection
-func setupGRPCConnection(address string) (*grpc.ClientConn, error) {
-	return grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// selectRPC returns the preferred synced RPC endpoint
+func selectRPC(ctx context.Context, cfg *types.Config) (string, error) {
+	addresses := cfg.Endpoints.RPC
+	if len(addresses) == 0 {
+		addresses = []string{cfg.RPCServerAddress}
+	}
+
+	return endpoints.Select(ctx, addresses, cfg.Endpoints.MaxHeightLag, cfg.Endpoints.Timeout, endpoints.RPCStatus(cfg.WebsocketPath))
+}
+
+// setup GRPC connection connects to the gRPC endpoints that serve every
+// query and checks at least one is healthy
+func setupGRPCConnection(ctx context.Context, l *zap.Logger, cfg *types.Config) (*endpoints.Pool, error) {
+	pool, err := endpoints.Dial(l, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pool.Check(ctx); err != nil {
+		_ = pool.Close()
+		return nil, err
+	}
+
+	return pool, nil
 }
 
 // initialise performs the setup operations for the script
 // * initialise a logger
 // * load and parse config
-// * initialise a cosmosclient
-// * initilise a grpc connection
-func initialize(ctx context.Context, configPath string) (*zap.Logger, *types.Config, *cosmosclient.Client, *grpc.ClientConn) {
+// * initialise a cosmosclient on a synced RPC endpoint
+// * initilise the grpc connections
+func initialize(ctx context.Context, configPath string) (*zap.Logger, *types.Config, *rpcClient, *endpoints.Pool) {
 	l, err := logger.Setup()
 	if err != nil {
 		log.Fatalf("Failed to initialize zap logger: %v", err)
@@ -85,12 +123,13 @@ func initialize(ctx context.Context, configPath string) (*zap.Logger, *types.Con
 		l.Fatal("Failed to load config", zap.Error(err))
 	}
 
-	client, err := setupCosmosClient(ctx, cfg)
+	client, err := newRPCClient(ctx, l, cfg)
 	if err != nil {
 		l.Fatal("Failed to initialise cosmosclient", zap.Error(err))
 	}
+	l.Info("Using RPC endpoint", zap.String("endpoint", client.Address()))
 
-	conn, err := setupGRPCConnection(cfg.GRPCServerAddress)
+	conn, err := setupGRPCConnection(ctx, l, cfg)
 	if err != nil {
 		l.Fatal("Failed to connect to GRPC server", zap.Error(err))
 	}
@@ -98,7 +137,81 @@ func initialize(ctx context.Context, configPath string) (*zap.Logger, *types.Con
 	return l, cfg, client, conn
 }
 
+// checkFeeAllowance verifies that the fee granter has an allowance for the
+// signer that is unexpired and large enough to cover the configured fees
+func checkFeeAllowance(ctx context.Context, l *zap.Logger, cfg *types.Config, conn *endpoints.Pool, address string) error {
+	fgClient := feegranttypes.NewQueryClient(conn)
+
+	now := time.Now()
+	allowance, err := feegrant.GetAllowance(ctx, fgClient, cfg.FeeGranter, address, now)
+	if err != nil {
+		return err
+	}
+
+	if allowance.IsExpired(now) {
+		return fmt.Errorf("fee allowance from %s expired at %s", cfg.FeeGranter, allowance.Expiration)
+	}
+
+	fees, err := sdk.ParseCoinsNormalized(cfg.Fees)
+	if err != nil {
+		return err
+	}
+
+	if !allowance.Covers(fees) {
+		return fmt.Errorf("fee allowance %s from %s does not cover fees %s", allowance.Remaining, cfg.FeeGranter, fees)
+	}
+
+	required := []sdk.Msg{&cltypes.MsgCreatePosition{}, &cltypes.MsgWithdrawPosition{}}
+	if cfg.Position.Rebalance.Enabled || cfg.Hedge.Enabled || cfg.Arbitrage.Enabled {
+		required = append(required, &pmtypes.MsgSwapExactAmountIn{})
+	}
+	if cfg.Arbitrage.Enabled || cfg.Vaults.Enabled {
+		required = append(required, &wasmtypes.MsgExecuteContract{})
+	}
+
+	for _, msg := range required {
+		if typeURL := sdk.MsgTypeURL(msg); !allowance.AllowsMsg(typeURL) {
+			return fmt.Errorf("fee allowance from %s does not allow %s", cfg.FeeGranter, typeURL)
+		}
+	}
+
+	remaining := "unlimited"
+	if !allowance.IsUnlimited() {
+		remaining = allowance.Remaining.String()
+	}
+
+	expiration := "never"
+	if allowance.Expiration != nil {
+		expiration = allowance.Expiration.String()
+	}
+
+	l.Info("Fee allowance",
+		zap.String("granter", allowance.Granter),
+		zap.String("type", allowance.Type),
+		zap.String("remaining", remaining),
+		zap.String("expiration", expiration),
+	)
+
+	return nil
+}
+
 func main() {
+	// Subcommands parse their own flags
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "backtest":
+			if err := runBacktest(os.Args[2:]); err != nil {
+				log.Fatalf("Backtest failed: %v", err)
+			}
+			return
+		case "liquidate":
+			if err := runLiquidate(os.Args[2:]); err != nil {
+				log.Fatalf("Liquidate failed: %v", err)
+			}
+			return
+		}
+	}
+
 	parseFlags()
 	if *showVersion {
 		fmt.Printf("Version: %s\nBuild Date: %s\n", Version, BuildDate)
@@ -127,97 +240,67 @@ func main() {
 		)
 	}
 
-	// Initialise a wasm query client to read state from power contract
-	c := wasmtypes.NewQueryClient(client.Context())
-
-	// Initialise a poolmanager query client
-	pmClient := pmquery.NewQueryClient(client.Context())
-
-	// Initialise a concentrated liquidity query client
-	clClient := clquery.NewQueryClient(client.Context())
-
-	// Get the power config and state
-	powerConfig, powerState, err := power.GetConfigAndState(ctx, c, cfg.PowerPool.ContractAddress)
-	if err != nil {
-		log.Fatalf("Failed to get config and state: %v", err)
-	}
-
-	// Get the spotprices for base and power
-	baseSpotPrice, powerSpotPrice, err := queries.GetSpotPrices(ctx, pmClient, powerConfig)
-	if err != nil {
-		l.Fatal("Failed to fetch spot prices", zap.Error(err))
-	}
-
-	// Calculate the mark price
-	markPrice, err := maths.CalculateMarkPrice(baseSpotPrice, powerSpotPrice, powerState.NormalisationFactor, powerConfig.IndexScale)
+	// Initialise the notifier for alerts
+	n, err := notify.New(cfg.Notifier)
 	if err != nil {
-		l.Fatal("Failed to calculate mark price", zap.Error(err))
+		l.Fatal("Failed to initialise notifier", zap.Error(err))
 	}
+	a := alerter{ctx: ctx, l: l, n: n}
 
-	// Calcuate the index price
-	indexPrice, err := maths.CalculateIndexPrice(baseSpotPrice)
-	if err != nil {
-		l.Fatal("Failed to calculate index price", zap.Error(err))
+	// Check the fee granter will pay for our transactions
+	if cfg.FeeGranter != "" {
+		if err := checkFeeAllowance(ctx, l, cfg, conn, address); err != nil {
+			a.fatal(notify.EventLowGas, "Fee allowance check failed", err)
+		}
 	}
 
-	// Calculate the target price
-	targetPrice, err := maths.CalculateTargetPrice(baseSpotPrice, powerState.NormalisationFactor, powerConfig.IndexScale)
-	if err != nil {
-		l.Fatal("Failed to calculate target price", zap.Error(err))
+	// Keep cycle history on disk if configured so it survives oneshot runs
+	var store engine.Store = engine.NewMemoryStore(resultHistory)
+	if cfg.Store.Path != "" {
+		size := cfg.Store.Size
+		if size <= 0 {
+			size = resultHistory
+		}
+		store, err = engine.NewFileStore(cfg.Store.Path, size)
+		if err != nil {
+			l.Fatal("Failed to open store", zap.Error(err))
+		}
 	}
 
-	// Calculate the premium
-	premium := maths.CalculatePremium(markPrice, indexPrice)
-
-	// get inverse target and spot prices
-	floatPowerSpotPrice, err := strconv.ParseFloat(powerSpotPrice, 64)
+	b := newBot(&engine.Cycle{
+		Logger:      l,
+		Config:      cfg,
+		Account:     account,
+		Address:     address,
+		Querier:     engine.NewGRPCQuerier(conn, cfg.PowerPool.ContractAddress, cfg.Endpoints.QueryTimeout),
+		Broadcaster: client,
+		Simulator:   client,
+		Clock:       engine.SystemClock{},
+		Strategy:    engine.LiquidityStrategy{},
+		Store:       store,
+		Notifier:    n,
+		Endpoints:   conn,
+		DryRun:      *dryRun,
+	})
+
+	// Fail early rather than read one pool and write another
+	poolID, err := b.cycle.CheckPowerPool(ctx)
 	if err != nil {
-		l.Fatal("Failed to parse power spot price", zap.Error(err))
+		a.fatal(notify.EventCycleFailed, "Power pool check failed", err)
 	}
+	l.Info("Managing power pool", zap.Uint64("pool_id", poolID))
 
-	inverseTargetPrice := 1 / targetPrice
-	inversePowerPrice := 1 / floatPowerSpotPrice
-
-	// Now lets check if we have any open CL positions for the bot
-	userPositions, err := queries.GetUserPositions(ctx, clClient, powerConfig.PowerPool, address)
-	if err != nil {
-		l.Fatal("Failed to find user positions", zap.Error(err))
+	if !*daemon {
+		if err := b.runCycle(ctx); err != nil {
+			l.Fatal("Cycle failed", zap.Error(err))
+		}
+		return
 	}
 
-	currentTick, err := queries.GetCurrentTick(ctx, pmClient, powerConfig.PowerPool.ID)
-	if err != nil {
-		l.Fatal("Failed to get current tick", zap.Error(err))
-	}
-
-	// Sanity check computations
-	l.Debug("Summary data",
-		zap.Float64("mark_price", markPrice),
-		zap.Float64("target_price", targetPrice),
-		zap.Float64("inverse_target_price", inverseTargetPrice),
-		zap.String("power_price", powerSpotPrice),
-		zap.Float64("inverse_power_price", inversePowerPrice),
-		zap.Float64("premium", premium),
-		zap.String("normalization_factor", powerState.NormalisationFactor),
-		zap.Int64("current_tick", currentTick),
-	)
-
-	powerPriceStr := fmt.Sprintf("%f", inversePowerPrice)
-	targetPriceStr := fmt.Sprintf("%f", inverseTargetPrice)
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	msgs, err := liquidity.CreateUpdatePositionMsgs(l, *userPositions, cfg, currentTick, address, powerPriceStr, targetPriceStr)
-	if err != nil {
-		l.Fatal("Failed to create update position msgs", zap.Error(err))
-	}
-
-	txResp, err := client.BroadcastTx(ctx, account, msgs...)
-	if err != nil {
-		l.Error("Transaction error",
-			zap.Error(err),
-		)
-	} else {
-		l.Debug("tx response",
-			zap.String("transaction hash", txResp.TxHash),
-		)
+	if err := runDaemon(ctx, l, cfg, b); err != nil {
+		l.Fatal("Daemon failed", zap.Error(err))
 	}
-
 }
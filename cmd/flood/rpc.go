@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cosmos/cosmos-sdk/client"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/ignite/cli/ignite/pkg/cosmosaccount"
+	"github.com/ignite/cli/ignite/pkg/cosmosclient"
+	"go.uber.org/zap"
+
+	"github.com/margined-protocol/flood/internal/engine"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+// txClient is the part of the cosmos client transactions go through
+type txClient interface {
+	Account(nameOrAddress string) (cosmosaccount.Account, error)
+	Context() client.Context
+	BroadcastTx(ctx context.Context, account cosmosaccount.Account, msgs ...sdk.Msg) (cosmosclient.Response, error)
+}
+
+// rpcClient signs, simulates and broadcasts transactions through the
+// preferred synced RPC endpoint. After a broadcast fails it selects the
+// endpoint again and, if another is preferred, switches to it for the next
+// transaction. The failed transaction is not resent.
+type rpcClient struct {
+	l *zap.Logger
+	// selectRPC returns the preferred synced endpoint
+	selectRPC func(ctx context.Context) (string, error)
+	// connect returns a client of the endpoint
+	connect func(ctx context.Context, address string) (txClient, error)
+
+	mu      sync.Mutex
+	address string
+	client  txClient
+}
+
+// newRPCClient selects an RPC endpoint from the config and connects to it
+func newRPCClient(ctx context.Context, l *zap.Logger, cfg *types.Config) (*rpcClient, error) {
+	r := &rpcClient{
+		l: l,
+		selectRPC: func(ctx context.Context) (string, error) {
+			return selectRPC(ctx, cfg)
+		},
+		connect: func(ctx context.Context, address string) (txClient, error) {
+			return setupCosmosClient(ctx, cfg, address)
+		},
+	}
+
+	address, err := r.selectRPC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if r.client, err = r.connect(ctx, address); err != nil {
+		return nil, err
+	}
+	r.address = address
+
+	return r, nil
+}
+
+// Address is the RPC endpoint in use
+func (r *rpcClient) Address() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.address
+}
+
+func (r *rpcClient) current() txClient {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.client
+}
+
+func (r *rpcClient) Account(nameOrAddress string) (cosmosaccount.Account, error) {
+	return r.current().Account(nameOrAddress)
+}
+
+func (r *rpcClient) Simulate(ctx context.Context, account cosmosaccount.Account, msgs ...sdk.Msg) error {
+	return engine.ClientSimulator{Context: r.current().Context()}.Simulate(ctx, account, msgs...)
+}
+
+func (r *rpcClient) BroadcastTx(ctx context.Context, account cosmosaccount.Account, msgs ...sdk.Msg) (cosmosclient.Response, error) {
+	resp, err := r.current().BroadcastTx(ctx, account, msgs...)
+	if err != nil {
+		r.reselect(ctx)
+	}
+	return resp, err
+}
+
+// reselect switches to the preferred synced endpoint if it is not the one
+// in use, keeping the current one when none can be reached
+func (r *rpcClient) reselect(ctx context.Context) {
+	address, err := r.selectRPC(ctx)
+	if err != nil {
+		r.l.Warn("Failed to select RPC server", zap.Error(err))
+		return
+	}
+
+	current := r.Address()
+	if address == current {
+		return
+	}
+
+	c, err := r.connect(ctx, address)
+	if err != nil {
+		r.l.Warn("Failed to connect to RPC server", zap.String("endpoint", address), zap.Error(err))
+		return
+	}
+
+	r.mu.Lock()
+	r.address, r.client = address, c
+	r.mu.Unlock()
+
+	r.l.Info("Switched RPC endpoint", zap.String("from", current), zap.String("to", address))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/client"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/ignite/cli/ignite/pkg/cosmosaccount"
+	"github.com/ignite/cli/ignite/pkg/cosmosclient"
+	"go.uber.org/zap"
+	"gotest.tools/assert"
+)
+
+// fakeTxClient broadcasts through an endpoint, failing while it is down
+type fakeTxClient struct {
+	down bool
+	sent int
+}
+
+func (f *fakeTxClient) Account(string) (cosmosaccount.Account, error) {
+	return cosmosaccount.Account{}, nil
+}
+
+func (f *fakeTxClient) Context() client.Context { return client.Context{} }
+
+func (f *fakeTxClient) BroadcastTx(context.Context, cosmosaccount.Account, ...sdk.Msg) (cosmosclient.Response, error) {
+	if f.down {
+		return cosmosclient.Response{}, errors.New("connection refused")
+	}
+	f.sent++
+	return cosmosclient.Response{}, nil
+}
+
+func TestRPCClientSwitchesEndpointAfterBroadcastFails(t *testing.T) {
+	ctx := context.Background()
+	clients := map[string]*fakeTxClient{
+		"http://a:26657": {},
+		"http://b:26657": {},
+	}
+	preferred := "http://a:26657"
+
+	selections := 0
+	r := &rpcClient{
+		l: zap.NewNop(),
+		selectRPC: func(context.Context) (string, error) {
+			selections++
+			return preferred, nil
+		},
+		connect: func(_ context.Context, address string) (txClient, error) {
+			return clients[address], nil
+		},
+		address: "http://a:26657",
+		client:  clients["http://a:26657"],
+	}
+
+	// A successful broadcast keeps the endpoint without a check
+	_, err := r.BroadcastTx(ctx, cosmosaccount.Account{})
+	assert.NilError(t, err)
+	assert.Equal(t, 0, selections)
+
+	// A failure on the preferred endpoint keeps it when it is still preferred
+	clients["http://a:26657"].down = true
+	_, err = r.BroadcastTx(ctx, cosmosaccount.Account{})
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Equal(t, 1, selections)
+	assert.Equal(t, "http://a:26657", r.Address())
+
+	// Once another endpoint is preferred the next transaction goes through it
+	preferred = "http://b:26657"
+	_, err = r.BroadcastTx(ctx, cosmosaccount.Account{})
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Equal(t, "http://b:26657", r.Address())
+
+	_, err = r.BroadcastTx(ctx, cosmosaccount.Account{})
+	assert.NilError(t, err)
+	assert.Equal(t, 1, clients["http://b:26657"].sent)
+
+	// The endpoint is kept when selection fails
+	clients["http://b:26657"].down = true
+	r.selectRPC = func(context.Context) (string, error) { return "", errors.New("no synced RPC endpoints") }
+	_, err = r.BroadcastTx(ctx, cosmosaccount.Account{})
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Equal(t, "http://b:26657", r.Address())
+}
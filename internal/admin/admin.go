@@ -0,0 +1,150 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	model "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/model"
+	"go.uber.org/zap"
+
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+// Snapshot holds the market data read during a cycle.
+type Snapshot struct {
+	Height              int64     `json:"height"`
+	BlockTime           time.Time `json:"block_time"`
+	BaseSpotPrice       string    `json:"base_spot_price"`
+	PowerSpotPrice      string    `json:"power_spot_price"`
+	MarkPrice           float64   `json:"mark_price"`
+	IndexPrice          float64   `json:"index_price"`
+	TargetPrice         float64   `json:"target_price"`
+	Premium             float64   `json:"premium"`
+	NormalisationFactor string    `json:"normalisation_factor"`
+	CurrentTick         int64     `json:"current_tick"`
+}
+
+// Status is the state of the bot reported by GET /status.
+type Status struct {
+	Paused    bool                          `json:"paused"`
+	LastCycle time.Time                     `json:"last_cycle"`
+	Snapshot  *Snapshot                     `json:"snapshot,omitempty"`
+	Positions []model.FullPositionBreakdown `json:"positions"`
+	Decision  string                        `json:"decision"`
+	TxHash    string                        `json:"tx_hash,omitempty"`
+	Error     string                        `json:"error,omitempty"`
+	// Idle is the wallet balance of the pool's tokens left undeployed
+	Idle sdk.Coins `json:"idle,omitempty"`
+	// Endpoints are the gRPC endpoints that served the cycle
+	Endpoints []string `json:"endpoints,omitempty"`
+}
+
+// Controller is implemented by the bot to expose its state and actions.
+type Controller interface {
+	Status() Status
+	Pause()
+	Resume()
+	Rebalance(ctx context.Context) error
+	WithdrawAll(ctx context.Context) (string, error)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type txResponse struct {
+	TxHash string `json:"tx_hash"`
+}
+
+// Handler returns the admin API routes, every request must carry the token
+// as a bearer authorization header.
+func Handler(l *zap.Logger, token string, c Controller) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/status", method(http.MethodGet, func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, c.Status())
+	}))
+
+	mux.HandleFunc("/pause", method(http.MethodPost, func(w http.ResponseWriter, _ *http.Request) {
+		c.Pause()
+		l.Info("Paused by admin API")
+		writeJSON(w, http.StatusOK, c.Status())
+	}))
+
+	mux.HandleFunc("/resume", method(http.MethodPost, func(w http.ResponseWriter, _ *http.Request) {
+		c.Resume()
+		l.Info("Resumed by admin API")
+		writeJSON(w, http.StatusOK, c.Status())
+	}))
+
+	mux.HandleFunc("/rebalance", method(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		l.Info("Rebalance requested by admin API")
+		if err := c.Rebalance(r.Context()); err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, c.Status())
+	}))
+
+	mux.HandleFunc("/withdraw-all", method(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		l.Warn("Withdraw all requested by admin API")
+		txHash, err := c.WithdrawAll(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, txResponse{TxHash: txHash})
+	}))
+
+	return authenticate(token, mux)
+}
+
+// NewServer returns an http server for the admin API. It fails if no token is
+// configured as the API must never be exposed unauthenticated.
+func NewServer(l *zap.Logger, cfg types.Admin, c Controller) (*http.Server, error) {
+	if cfg.Token == "" {
+		return nil, errors.New("admin api token is not set")
+	}
+
+	return &http.Server{
+		Addr:              cfg.ListenAddress,
+		Handler:           Handler(l, cfg.Token, c),
+		ReadHeaderTimeout: 10 * time.Second,
+	}, nil
+}
+
+func authenticate(token string, next http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(strings.TrimSpace(r.Header.Get("Authorization")))
+		if subtle.ConstantTimeCompare(got, expected) != 1 {
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func method(m string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != m {
+			w.Header().Set("Allow", m)
+			writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+			return
+		}
+		h(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
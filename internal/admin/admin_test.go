@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	"gotest.tools/assert"
+)
+
+type fakeController struct {
+	status     Status
+	rebalances int
+}
+
+func (f *fakeController) Status() Status { return f.status }
+func (f *fakeController) Pause()         { f.status.Paused = true }
+func (f *fakeController) Resume()        { f.status.Paused = false }
+
+func (f *fakeController) Rebalance(context.Context) error {
+	f.rebalances++
+	f.status.Decision = "rebalanced"
+	return nil
+}
+
+func (f *fakeController) WithdrawAll(context.Context) (string, error) {
+	f.status.Paused = true
+	return "ABC", nil
+}
+
+func do(t *testing.T, h http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlerRequiresToken(t *testing.T) {
+	h := Handler(zap.NewNop(), "secret", &fakeController{})
+
+	assert.Equal(t, http.StatusUnauthorized, do(t, h, http.MethodGet, "/status", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(t, h, http.MethodGet, "/status", "wrong").Code)
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/status", "secret").Code)
+}
+
+func TestHandlerActions(t *testing.T) {
+	c := &fakeController{}
+	h := Handler(zap.NewNop(), "secret", c)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, do(t, h, http.MethodGet, "/pause", "secret").Code)
+
+	rec := do(t, h, http.MethodPost, "/pause", "secret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var status Status
+	assert.NilError(t, json.NewDecoder(rec.Body).Decode(&status))
+	assert.Assert(t, status.Paused)
+
+	do(t, h, http.MethodPost, "/resume", "secret")
+	assert.Assert(t, !c.status.Paused)
+
+	do(t, h, http.MethodPost, "/rebalance", "secret")
+	assert.Equal(t, 1, c.rebalances)
+
+	rec = do(t, h, http.MethodPost, "/withdraw-all", "secret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var tx txResponse
+	assert.NilError(t, json.NewDecoder(rec.Body).Decode(&tx))
+	assert.Equal(t, "ABC", tx.TxHash)
+	assert.Assert(t, c.status.Paused)
+}
@@ -0,0 +1,350 @@
+// Package arbitrage trades the power premium back towards zero through the
+// power contract's vaults. When power trades above the index it is minted
+// against collateral and sold, when it trades below it is bought and burned
+// to repay vault debt and release collateral.
+package arbitrage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	sdkmath "cosmossdk.io/math"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/osmosis-labs/osmosis/osmomath"
+	pmtypes "github.com/osmosis-labs/osmosis/v21/x/poolmanager/types"
+
+	"github.com/margined-protocol/flood/internal/fetch"
+	"github.com/margined-protocol/flood/internal/maths"
+	"github.com/margined-protocol/flood/internal/power"
+	"github.com/margined-protocol/flood/internal/queries"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+// Direction is the side of an arbitrage.
+type Direction string
+
+const (
+	DirectionMintAndSell Direction = "mint_and_sell"
+	DirectionBuyAndBurn  Direction = "buy_and_burn"
+)
+
+const (
+	defaultMinPremium      = "0.02"
+	defaultMaxImpact       = "0.01"
+	defaultCollateralRatio = "2"
+	defaultMaxSlippage     = "0.005"
+
+	// maxHalvings bounds the number of sizes estimated
+	maxHalvings = 8
+)
+
+// Market is the state of the power market an arbitrage is priced from. The
+// base price is the quote asset per base asset and the power price is power
+// per base asset, as returned by the spot price queries.
+type Market struct {
+	Premium             float64
+	BasePrice           string
+	PowerPrice          string
+	NormalisationFactor string
+	Power               maths.Power
+	// FeeRate is charged by the contract on the value minted
+	FeeRate string
+	// PoolID is the power pool, which swaps PowerDenom for BaseDenom
+	PoolID     uint64
+	PowerDenom string
+	BaseDenom  string
+}
+
+// Opportunity is a sized and priced arbitrage.
+type Opportunity struct {
+	Direction Direction `json:"direction"`
+	Premium   float64   `json:"premium"`
+	// Power is minted and sold, or bought and burned
+	Power sdk.Coin `json:"power"`
+	// Collateral is deposited when minting and withdrawn when burning
+	Collateral   sdk.Coin `json:"collateral"`
+	SwapIn       sdk.Coin `json:"swap_in"`
+	EstimatedOut sdk.Coin `json:"estimated_out"`
+	MinOut       sdk.Coin `json:"min_out"`
+	// FairValue of one power in the base asset at the index
+	FairValue float64 `json:"fair_value"`
+	// Impact is the shortfall of the average swap price against spot
+	Impact float64 `json:"impact"`
+	// Fee and Profit are in base asset units
+	Fee    float64 `json:"fee"`
+	Profit float64 `json:"profit"`
+}
+
+type params struct {
+	minPremium      float64
+	maxImpact       float64
+	collateralRatio float64
+	slippage        osmomath.Dec
+	feeRate         float64
+	minProfit       float64
+	maxSize         int64
+}
+
+func parseParams(cfg types.Arbitrage, feeRate string) (params, error) {
+	var p params
+	var err error
+
+	if p.minPremium, err = strconv.ParseFloat(types.OrDefault(cfg.MinPremium, defaultMinPremium), 64); err != nil {
+		return p, fmt.Errorf("invalid min premium: %w", err)
+	}
+	if p.maxImpact, err = strconv.ParseFloat(types.OrDefault(cfg.MaxImpact, defaultMaxImpact), 64); err != nil {
+		return p, fmt.Errorf("invalid max impact: %w", err)
+	}
+	if p.collateralRatio, err = strconv.ParseFloat(types.OrDefault(cfg.CollateralRatio, defaultCollateralRatio), 64); err != nil {
+		return p, fmt.Errorf("invalid collateral ratio: %w", err)
+	}
+	if p.slippage, err = osmomath.NewDecFromStr(types.OrDefault(cfg.MaxSlippage, defaultMaxSlippage)); err != nil {
+		return p, fmt.Errorf("invalid max slippage: %w", err)
+	}
+	if p.feeRate, err = strconv.ParseFloat(types.OrDefault(feeRate, "0"), 64); err != nil {
+		return p, fmt.Errorf("invalid fee rate: %w", err)
+	}
+	minProfit, err := cfg.MinProfit.Int()
+	if err != nil {
+		return p, fmt.Errorf("invalid min profit: %w", err)
+	}
+	p.minProfit, _ = minProfit.ToLegacyDec().Float64()
+	maxSize, err := cfg.MaxSize.Int()
+	if err != nil {
+		return p, fmt.Errorf("invalid max size: %w", err)
+	}
+	if !maxSize.IsInt64() {
+		return p, fmt.Errorf("max size is too large: %s", maxSize)
+	}
+	p.maxSize = maxSize.Int64()
+
+	switch {
+	case p.minPremium <= 0:
+		return p, fmt.Errorf("min premium must be positive")
+	case p.maxImpact <= 0 || p.maxImpact >= 1:
+		return p, fmt.Errorf("max impact must be between 0 and 1")
+	case p.collateralRatio < 1:
+		return p, fmt.Errorf("collateral ratio must be at least 1")
+	case p.slippage.IsNegative() || p.slippage.GTE(osmomath.OneDec()):
+		return p, fmt.Errorf("max slippage must be between 0 and 1")
+	case p.maxSize <= 0:
+		return p, fmt.Errorf("max size must be positive")
+	}
+
+	return p, nil
+}
+
+// Find sizes the arbitrage for the premium, estimating the swap at halving
+// sizes from the maximum, each bounded by the timeout, and taking the
+// largest whose price impact fits within the limit. It returns nil if the
+// premium is below the threshold or no size is profitable enough. Burning
+// needs the configured vault.
+func Find(ctx context.Context, est queries.Estimator, timeout time.Duration, cfg types.Arbitrage, market Market, vault *types.GetVaultResponse) (*Opportunity, error) {
+	p, err := parseParams(cfg, market.FeeRate)
+	if err != nil {
+		return nil, err
+	}
+
+	if math.Abs(market.Premium) < p.minPremium {
+		return nil, nil
+	}
+
+	for _, denom := range []string{market.PowerDenom, market.BaseDenom} {
+		if err := sdk.ValidateDenom(denom); err != nil {
+			return nil, fmt.Errorf("invalid power pool: %w", err)
+		}
+	}
+
+	fair, err := market.Power.PowerValue(market.BasePrice, market.NormalisationFactor)
+	if err != nil {
+		return nil, err
+	}
+
+	powerPrice, err := strconv.ParseFloat(market.PowerPrice, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid power price: %w", err)
+	}
+	if powerPrice <= 0 || fair <= 0 {
+		return nil, fmt.Errorf("power price and value must be positive")
+	}
+
+	if market.Premium > 0 {
+		return findMintAndSell(ctx, est, timeout, cfg, p, market, fair, powerPrice)
+	}
+
+	if vault == nil {
+		return nil, fmt.Errorf("buying and burning needs arbitrage.vault_id")
+	}
+
+	return findBuyAndBurn(ctx, est, timeout, cfg, p, market, fair, powerPrice, *vault)
+}
+
+func findMintAndSell(ctx context.Context, est queries.Estimator, timeout time.Duration, cfg types.Arbitrage, p params, market Market, fair, powerPrice float64) (*Opportunity, error) {
+	powerDenom, baseDenom := market.PowerDenom, market.BaseDenom
+
+	sizes := halvings(p.maxSize)
+	outs, err := estimate(ctx, est, timeout, market.PoolID, powerDenom, sizes, baseDenom)
+	if err != nil {
+		return nil, fmt.Errorf("failed to estimate sale: %w", err)
+	}
+
+	for i, size := range sizes {
+		tokenIn, out := sdk.NewInt64Coin(powerDenom, size), outs[i]
+		received, _ := out.ToLegacyDec().Float64()
+		impact := 1 - received/float64(size)*powerPrice
+		if impact > p.maxImpact {
+			continue
+		}
+
+		debtValue := float64(size) * fair
+		fee := debtValue * p.feeRate
+		profit := received - debtValue - fee
+
+		// Smaller sizes only earn less once the impact fits
+		if profit < p.minProfit {
+			return nil, nil
+		}
+
+		estimated := sdk.NewCoin(baseDenom, out)
+		return &Opportunity{
+			Direction:    DirectionMintAndSell,
+			Premium:      market.Premium,
+			Power:        tokenIn,
+			Collateral:   sdk.NewInt64Coin(baseDenom, int64(math.Ceil(debtValue*p.collateralRatio+fee))),
+			SwapIn:       tokenIn,
+			EstimatedOut: estimated,
+			MinOut:       minOut(estimated, p.slippage),
+			FairValue:    fair,
+			Impact:       impact,
+			Fee:          fee,
+			Profit:       profit,
+		}, nil
+	}
+
+	return nil, nil
+}
+
+func findBuyAndBurn(ctx context.Context, est queries.Estimator, timeout time.Duration, cfg types.Arbitrage, p params, market Market, fair, powerPrice float64, vault types.GetVaultResponse) (*Opportunity, error) {
+	powerDenom, baseDenom := market.PowerDenom, market.BaseDenom
+
+	debt, ok := sdkmath.NewIntFromString(vault.ShortAmount)
+	if !ok {
+		return nil, fmt.Errorf("invalid vault short amount: %s", vault.ShortAmount)
+	}
+	collateral, ok := sdkmath.NewIntFromString(vault.Collateral)
+	if !ok {
+		return nil, fmt.Errorf("invalid vault collateral: %s", vault.Collateral)
+	}
+	if !debt.IsPositive() {
+		return nil, nil
+	}
+
+	maxPower := p.maxSize
+	if debt.LT(sdkmath.NewInt(maxPower)) {
+		maxPower = debt.Int64()
+	}
+
+	sizes := halvings(int64(float64(maxPower) / powerPrice))
+	outs, err := estimate(ctx, est, timeout, market.PoolID, baseDenom, sizes, powerDenom)
+	if err != nil {
+		return nil, fmt.Errorf("failed to estimate purchase: %w", err)
+	}
+
+	for i, size := range sizes {
+		tokenIn, out := sdk.NewInt64Coin(baseDenom, size), outs[i]
+		bought, _ := out.ToLegacyDec().Float64()
+		impact := 1 - bought/float64(size)/powerPrice
+		if impact > p.maxImpact || out.GT(debt) {
+			continue
+		}
+
+		profit := bought*fair - float64(size)
+		if profit < p.minProfit {
+			return nil, nil
+		}
+
+		estimated := sdk.NewCoin(powerDenom, out)
+		burned := minOut(estimated, p.slippage)
+
+		// Release collateral in proportion to the debt repaid
+		withdraw := collateral.Mul(burned.Amount).Quo(debt)
+
+		return &Opportunity{
+			Direction:    DirectionBuyAndBurn,
+			Premium:      market.Premium,
+			Power:        burned,
+			Collateral:   sdk.NewCoin(baseDenom, withdraw),
+			SwapIn:       tokenIn,
+			EstimatedOut: estimated,
+			MinOut:       burned,
+			FairValue:    fair,
+			Impact:       impact,
+			Profit:       profit,
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// Msgs returns the legs of the arbitrage in execution order, the contract
+// leg first when minting and the swap first when burning.
+func (o *Opportunity) Msgs(sender, contract string, vaultID, powerPoolID uint64) ([]sdk.Msg, error) {
+	swap := &pmtypes.MsgSwapExactAmountIn{
+		Sender:            sender,
+		Routes:            []pmtypes.SwapAmountInRoute{{PoolId: powerPoolID, TokenOutDenom: o.EstimatedOut.Denom}},
+		TokenIn:           o.SwapIn,
+		TokenOutMinAmount: o.MinOut.Amount,
+	}
+
+	switch o.Direction {
+	case DirectionMintAndSell:
+		mint, err := power.MintPowerPerpMsg(sender, contract, o.Power.Amount, vaultID, o.Collateral)
+		if err != nil {
+			return nil, err
+		}
+		return []sdk.Msg{mint, swap}, nil
+	case DirectionBuyAndBurn:
+		burn, err := power.BurnPowerPerpMsg(sender, contract, o.Power, vaultID, o.Collateral.Amount)
+		if err != nil {
+			return nil, err
+		}
+		return []sdk.Msg{swap, burn}, nil
+	default:
+		return nil, fmt.Errorf("unknown direction %q", o.Direction)
+	}
+}
+
+func minOut(estimated sdk.Coin, slippage osmomath.Dec) sdk.Coin {
+	amount := estimated.Amount.ToLegacyDec().Mul(osmomath.OneDec().Sub(slippage)).TruncateInt()
+	return sdk.NewCoin(estimated.Denom, amount)
+}
+
+// halvings returns up to maxHalvings sizes halving from the largest
+func halvings(largest int64) []int64 {
+	var sizes []int64
+	for size := largest; len(sizes) < maxHalvings && size > 0; size /= 2 {
+		sizes = append(sizes, size)
+	}
+	return sizes
+}
+
+// estimate returns the amount out of swapping each size of the denom in,
+// estimated concurrently
+func estimate(ctx context.Context, est queries.Estimator, timeout time.Duration, poolID uint64, denomIn string, sizes []int64, denomOut string) ([]sdkmath.Int, error) {
+	outs := make([]sdkmath.Int, len(sizes))
+	fetches := make([]fetch.Query, len(sizes))
+	for i, size := range sizes {
+		i, tokenIn := i, sdk.NewInt64Coin(denomIn, size)
+		fetches[i] = fetch.Query{Name: tokenIn.String(), Run: func(ctx context.Context) (err error) {
+			outs[i], err = est.EstimateSwap(ctx, poolID, tokenIn, denomOut)
+			return err
+		}}
+	}
+	if err := fetch.All(ctx, timeout, fetches...); err != nil {
+		return nil, err
+	}
+	return outs, nil
+}
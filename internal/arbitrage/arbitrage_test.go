@@ -0,0 +1,213 @@
+package arbitrage
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	sdkmath "cosmossdk.io/math"
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/osmosis-labs/osmosis/osmomath"
+	clmath "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/math"
+	pmquery "github.com/osmosis-labs/osmosis/v21/x/poolmanager/client/queryproto"
+	pmtypes "github.com/osmosis-labs/osmosis/v21/x/poolmanager/types"
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/maths"
+	"github.com/margined-protocol/flood/internal/mock"
+	"github.com/margined-protocol/flood/internal/queries"
+	"github.com/margined-protocol/flood/internal/simulator"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+const (
+	baseDenom  = "uosmo"
+	powerDenom = "usqosmo"
+	sender     = "osmo1bot"
+	contract   = "osmo1power"
+)
+
+// estimator fills swaps at the spot price less an impact that grows with the
+// size, so large trades are too deep for the pool
+type estimator struct {
+	powerPrice float64
+	// depth is the size at which the impact reaches 100%
+	depth float64
+
+	mu    sync.Mutex
+	calls []sdk.Coin
+}
+
+func (e *estimator) EstimateSwap(_ context.Context, _ uint64, tokenIn sdk.Coin, _ string) (sdkmath.Int, error) {
+	e.mu.Lock()
+	e.calls = append(e.calls, tokenIn)
+	e.mu.Unlock()
+
+	amount := float64(tokenIn.Amount.Int64())
+	impact := amount / e.depth
+	if tokenIn.Denom == powerDenom {
+		return sdkmath.NewInt(int64(amount / e.powerPrice * (1 - impact))), nil
+	}
+	return sdkmath.NewInt(int64(amount * e.powerPrice * (1 - impact))), nil
+}
+
+func market(premium float64, powerPrice string) Market {
+	return Market{
+		Premium:             premium,
+		BasePrice:           "10",
+		PowerPrice:          powerPrice,
+		NormalisationFactor: "1",
+		Power:               maths.MustNewPower("2", 10000),
+		PoolID:              2,
+		PowerDenom:          powerDenom,
+		BaseDenom:           baseDenom,
+	}
+}
+
+// chainPowerPrice serves a power pool created with power as token0 at a
+// price in uosmo per usqosmo and returns the power spot price read from it
+func chainPowerPrice(t *testing.T, poolPrice string) string {
+	t.Helper()
+
+	chain := mock.NewChain()
+	chain.SetSpotPrice(1, baseDenom, "uusdc", "10")
+
+	tick, err := clmath.CalculatePriceToTick(osmomath.MustNewBigDecFromStr(poolPrice))
+	assert.NilError(t, err)
+	pool, err := simulator.NewPool(2, powerDenom, baseDenom, 100, osmomath.MustNewDecFromStr("0.002"), tick)
+	assert.NilError(t, err)
+	chain.AddPool(pool)
+
+	conn, err := chain.Start()
+	assert.NilError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+		chain.Stop()
+	})
+
+	_, powerPrice, err := queries.GetSpotPrices(context.Background(), pmquery.NewQueryClient(conn), types.GetConfigResponse{
+		PowerAsset: types.Asset{Denom: powerDenom},
+		BasePool:   types.Pool{ID: 1, BaseDenom: baseDenom, QuoteDenom: "uusdc"},
+		PowerPool:  types.Pool{ID: 2, BaseDenom: powerDenom, QuoteDenom: baseDenom},
+	}, 0)
+	assert.NilError(t, err)
+
+	return powerPrice
+}
+
+func TestFindMintAndSellSizesToDepth(t *testing.T) {
+	// Power at 900 per base is 11% above its fair value of 0.001 base
+	est := &estimator{powerPrice: 900, depth: 100_000_000}
+	cfg := types.Arbitrage{MaxSize: types.RawAmount(sdkmath.NewInt(8_000_000)), MaxImpact: "0.03", MinProfit: types.RawAmount(sdkmath.NewInt(10))}
+
+	opp, err := Find(context.Background(), est, time.Second, cfg, market(0.11, "900"), nil)
+	assert.NilError(t, err)
+
+	// Every halving is estimated at once, 8m and 4m move the price too
+	// far and 2m is within 3%
+	assert.Equal(t, 8, len(est.calls))
+	assert.Equal(t, DirectionMintAndSell, opp.Direction)
+	assert.Equal(t, "2000000"+powerDenom, opp.Power.String())
+	assert.Equal(t, "4000"+baseDenom, opp.Collateral.String())
+	assert.Equal(t, int64(2177), opp.EstimatedOut.Amount.Int64())
+	assert.Equal(t, int64(2166), opp.MinOut.Amount.Int64())
+	assert.Assert(t, opp.Profit > 170 && opp.Profit < 180)
+
+	msgs, err := opp.Msgs(sender, contract, 7, 2)
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(msgs))
+
+	mint := msgs[0].(*wasmtypes.MsgExecuteContract)
+	assert.Equal(t, contract, mint.Contract)
+	assert.Equal(t, "4000"+baseDenom, mint.Funds.String())
+	var execute map[string]map[string]interface{}
+	assert.NilError(t, json.Unmarshal(mint.Msg, &execute))
+	assert.Equal(t, "2000000", execute["mint_power_perp"]["amount"])
+	assert.Equal(t, 7.0, execute["mint_power_perp"]["vault_id"])
+
+	swap := msgs[1].(*pmtypes.MsgSwapExactAmountIn)
+	assert.Equal(t, opp.Power, swap.TokenIn)
+	assert.Equal(t, baseDenom, swap.Routes[0].TokenOutDenom)
+	assert.Equal(t, opp.MinOut.Amount.Int64(), swap.TokenOutMinAmount.Int64())
+}
+
+func TestFindBuyAndBurn(t *testing.T) {
+	// Power at 1100 per base is 9% below fair value
+	est := &estimator{powerPrice: 1100, depth: 1_000_000}
+	cfg := types.Arbitrage{MaxSize: types.RawAmount(sdkmath.NewInt(10_000_000)), MaxImpact: "0.01"}
+	vault := &types.GetVaultResponse{Collateral: "2000", ShortAmount: "1000000"}
+
+	_, err := Find(context.Background(), est, time.Second, cfg, market(-0.09, "1100"), nil)
+	assert.ErrorContains(t, err, "vault_id")
+
+	opp, err := Find(context.Background(), est, time.Second, cfg, market(-0.09, "1100"), vault)
+	assert.NilError(t, err)
+
+	// Sized from the vault debt rather than the max size
+	largest := est.calls[0].Amount
+	for _, call := range est.calls {
+		largest = sdkmath.MaxInt(largest, call.Amount)
+	}
+	assert.Equal(t, int64(909), largest.Int64())
+	assert.Equal(t, DirectionBuyAndBurn, opp.Direction)
+	assert.Equal(t, baseDenom, opp.SwapIn.Denom)
+	assert.Assert(t, opp.Power.Amount.LTE(opp.EstimatedOut.Amount))
+	assert.Assert(t, opp.Profit > 0)
+
+	// Collateral is released in proportion to the debt repaid
+	assert.Equal(t, opp.Power.Amount.MulRaw(2000).QuoRaw(1_000_000).Int64(), opp.Collateral.Amount.Int64())
+
+	msgs, err := opp.Msgs(sender, contract, 7, 2)
+	assert.NilError(t, err)
+	_, ok := msgs[0].(*pmtypes.MsgSwapExactAmountIn)
+	assert.Assert(t, ok)
+	burn := msgs[1].(*wasmtypes.MsgExecuteContract)
+	assert.Equal(t, opp.Power.String(), burn.Funds.String())
+}
+
+func TestFindSkips(t *testing.T) {
+	est := &estimator{powerPrice: 900, depth: 100_000_000}
+	cfg := types.Arbitrage{MaxSize: types.RawAmount(sdkmath.NewInt(1_000_000)), MinPremium: "0.2"}
+
+	opp, err := Find(context.Background(), est, time.Second, cfg, market(0.11, "900"), nil)
+	assert.NilError(t, err)
+	assert.Assert(t, opp == nil)
+	assert.Equal(t, 0, len(est.calls))
+
+	// Profitable on paper but not after the contract fee
+	cfg = types.Arbitrage{MaxSize: types.RawAmount(sdkmath.NewInt(1_000_000)), MinProfit: types.RawAmount(sdkmath.NewInt(1))}
+	m := market(0.11, "900")
+	m.FeeRate = "0.2"
+	opp, err = Find(context.Background(), est, time.Second, cfg, m, nil)
+	assert.NilError(t, err)
+	assert.Assert(t, opp == nil)
+
+	_, err = Find(context.Background(), est, time.Second, types.Arbitrage{}, market(0.11, "900"), nil)
+	assert.ErrorContains(t, err, "max size")
+}
+
+func TestFindWithChainSpotPrice(t *testing.T) {
+	// A pool price of 1/900 uosmo per usqosmo is 900 power per base
+	powerPrice := chainPowerPrice(t, "0.001111111111111111")
+	price, err := strconv.ParseFloat(powerPrice, 64)
+	assert.NilError(t, err)
+	assert.Assert(t, math.Abs(price-900) < 0.01, powerPrice)
+
+	est := &estimator{powerPrice: price, depth: 100_000_000}
+	cfg := types.Arbitrage{MaxSize: types.RawAmount(sdkmath.NewInt(8_000_000)), MaxImpact: "0.03", MinProfit: types.RawAmount(sdkmath.NewInt(10))}
+
+	opp, err := Find(context.Background(), est, time.Second, cfg, market(0.11, powerPrice), nil)
+	assert.NilError(t, err)
+
+	// Sized and priced as at a power price of 900
+	assert.Equal(t, DirectionMintAndSell, opp.Direction)
+	assert.Equal(t, "2000000"+powerDenom, opp.Power.String())
+	assert.Equal(t, "4000"+baseDenom, opp.Collateral.String())
+	assert.Equal(t, int64(2177), opp.EstimatedOut.Amount.Int64())
+	assert.Assert(t, opp.Impact > 0.019 && opp.Impact < 0.021)
+}
@@ -0,0 +1,347 @@
+package backtest
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	sdkmath "cosmossdk.io/math"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/osmosis-labs/osmosis/osmomath"
+	clmath "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/math"
+	cltypes "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/types"
+	"go.uber.org/zap"
+
+	"github.com/margined-protocol/flood/internal/liquidity"
+	"github.com/margined-protocol/flood/internal/maths"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+// Params configures a backtest run.
+type Params struct {
+	// Position configures the ranges placed, as in the [position] config
+	Position types.Position
+	// IndexScale of the power contract used to compute the target price
+	IndexScale int
+	// Exponent of the power perpetual, squared when empty
+	Exponent string
+	// SpreadFactor is the pool swap fee charged on volume through our ranges
+	SpreadFactor osmomath.Dec
+	// Token0 and Token1 are the initial inventory deployed
+	Token0 sdk.Coin
+	Token1 sdk.Coin
+}
+
+// Point records the inventory after a sample is processed.
+type Point struct {
+	Time        time.Time   `json:"time"`
+	Price       float64     `json:"price"`
+	TargetPrice float64     `json:"target_price"`
+	Tick        int64       `json:"tick"`
+	Amount0     sdkmath.Int `json:"amount0"`
+	Amount1     sdkmath.Int `json:"amount1"`
+	Value       float64     `json:"value"`
+	HodlValue   float64     `json:"hodl_value"`
+	Rebalanced  bool        `json:"rebalanced"`
+}
+
+// Report summarises a backtest. Values are denominated in token1 at the pool
+// price of the final sample.
+type Report struct {
+	Samples            int         `json:"samples"`
+	Rebalances         int         `json:"rebalances"`
+	Skipped            int         `json:"skipped"`
+	Fills              int         `json:"fills"`
+	FilledToken0       sdkmath.Int `json:"filled_token0"`
+	FeesToken0         sdkmath.Int `json:"fees_token0"`
+	FeesToken1         sdkmath.Int `json:"fees_token1"`
+	FeesValue          float64     `json:"fees_value"`
+	InitialValue       float64     `json:"initial_value"`
+	FinalValue         float64     `json:"final_value"`
+	HodlValue          float64     `json:"hodl_value"`
+	ImpermanentLoss    float64     `json:"impermanent_loss"`
+	ImpermanentLossPct float64     `json:"impermanent_loss_pct"`
+	Inventory          []Point     `json:"inventory"`
+}
+
+// position is a modelled CL position.
+type position struct {
+	lowerTick, upperTick int64
+	sqrtLower, sqrtUpper osmomath.BigDec
+	liquidity            osmomath.BigDec
+}
+
+// amounts returns the tokens held by the position at the sqrt price.
+func (p position) amounts(sqrtPrice osmomath.BigDec) (osmomath.BigDec, osmomath.BigDec) {
+	switch {
+	case sqrtPrice.LTE(p.sqrtLower):
+		return clmath.CalcAmount0Delta(p.liquidity, p.sqrtLower, p.sqrtUpper, false), osmomath.ZeroBigDec()
+	case sqrtPrice.GTE(p.sqrtUpper):
+		return osmomath.ZeroBigDec(), clmath.CalcAmount1Delta(p.liquidity, p.sqrtLower, p.sqrtUpper, false)
+	default:
+		return clmath.CalcAmount0Delta(p.liquidity, sqrtPrice, p.sqrtUpper, false),
+			clmath.CalcAmount1Delta(p.liquidity, p.sqrtLower, sqrtPrice, false)
+	}
+}
+
+// swapIn returns the tokens swapped into the position as the price moves
+// from one sqrt price to another, only one of the amounts is non zero.
+func (p position) swapIn(from, to osmomath.BigDec) (osmomath.BigDec, osmomath.BigDec) {
+	lo, hi := osmomath.MinBigDec(from, to), osmomath.MaxBigDec(from, to)
+	lo, hi = osmomath.MaxBigDec(lo, p.sqrtLower), osmomath.MinBigDec(hi, p.sqrtUpper)
+
+	if !lo.LT(hi) {
+		return osmomath.ZeroBigDec(), osmomath.ZeroBigDec()
+	}
+
+	// Price rising means token1 is swapped in for token0 and vice versa
+	if to.GT(from) {
+		return osmomath.ZeroBigDec(), clmath.CalcAmount1Delta(p.liquidity, lo, hi, true)
+	}
+	return clmath.CalcAmount0Delta(p.liquidity, lo, hi, true), osmomath.ZeroBigDec()
+}
+
+// state is the simulated wallet and positions.
+type state struct {
+	positions    []position
+	idle0, idle1 osmomath.BigDec
+	fees0, fees1 osmomath.BigDec
+}
+
+// holdings returns everything held in positions at the sqrt price.
+func (s *state) holdings(sqrtPrice osmomath.BigDec) (osmomath.BigDec, osmomath.BigDec) {
+	amount0, amount1 := osmomath.ZeroBigDec(), osmomath.ZeroBigDec()
+	for _, p := range s.positions {
+		a0, a1 := p.amounts(sqrtPrice)
+		amount0, amount1 = amount0.Add(a0), amount1.Add(a1)
+	}
+	return amount0, amount1
+}
+
+// Run replays the samples through liquidity.MarketMake, moving the pool price
+// to each sample in turn and recording fills, fees and inventory.
+//
+// The pool is modelled as if our ranges hold all of the liquidity, so every
+// price move is filled against our positions and earns the full spread
+// factor. As in the live bot, withdrawn position amounts are redeployed while
+// collected fees and rounding dust are left idle.
+func Run(l *zap.Logger, samples []Sample, p Params) (*Report, error) {
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no samples")
+	}
+
+	spreadFactor := osmomath.BigDecFromDec(p.SpreadFactor)
+
+	s := &state{
+		idle0: osmomath.BigDecFromSDKInt(p.Token0.Amount),
+		idle1: osmomath.BigDecFromSDKInt(p.Token1.Amount),
+		fees0: osmomath.ZeroBigDec(),
+		fees1: osmomath.ZeroBigDec(),
+	}
+
+	report := &Report{
+		Samples:      len(samples),
+		FilledToken0: sdkmath.ZeroInt(),
+	}
+
+	power, err := maths.NewPower(p.Exponent, big.NewInt(int64(p.IndexScale)), 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var prevSqrtPrice osmomath.BigDec
+	var price float64
+
+	for i, sample := range samples {
+		poolPrice, targetPrice, err := prices(sample, power)
+		if err != nil {
+			return nil, fmt.Errorf("sample %d: %w", i, err)
+		}
+		price = poolPrice
+
+		tick, sqrtPrice, err := priceToTick(poolPrice)
+		if err != nil {
+			return nil, fmt.Errorf("sample %d: %w", i, err)
+		}
+
+		// Fill positions as the price moves from the previous sample
+		if i > 0 {
+			for _, pos := range s.positions {
+				before0, _ := pos.amounts(prevSqrtPrice)
+				after0, _ := pos.amounts(sqrtPrice)
+				if !before0.Equal(after0) {
+					report.Fills++
+					report.FilledToken0 = report.FilledToken0.Add(before0.Sub(after0).Abs().Dec().TruncateInt())
+				}
+
+				in0, in1 := pos.swapIn(prevSqrtPrice, sqrtPrice)
+				s.fees0 = s.fees0.Add(in0.Mul(spreadFactor))
+				s.fees1 = s.fees1.Add(in1.Mul(spreadFactor))
+			}
+		}
+		prevSqrtPrice = sqrtPrice
+
+		rebalanced, err := rebalance(l, s, tick, sqrtPrice, poolPrice, targetPrice, p)
+		if err != nil {
+			l.Debug("Skipping rebalance", zap.Int("sample", i), zap.Error(err))
+			report.Skipped++
+		}
+		if rebalanced && i > 0 {
+			report.Rebalances++
+		}
+
+		amount0, amount1 := s.holdings(sqrtPrice)
+		amount0, amount1 = amount0.Add(s.idle0).Add(s.fees0), amount1.Add(s.idle1).Add(s.fees1)
+
+		report.Inventory = append(report.Inventory, Point{
+			Time:        sample.Time,
+			Price:       poolPrice,
+			TargetPrice: targetPrice,
+			Tick:        tick,
+			Amount0:     amount0.Dec().TruncateInt(),
+			Amount1:     amount1.Dec().TruncateInt(),
+			Value:       value(amount0, amount1, poolPrice),
+			HodlValue:   value(osmomath.BigDecFromSDKInt(p.Token0.Amount), osmomath.BigDecFromSDKInt(p.Token1.Amount), poolPrice),
+			Rebalanced:  rebalanced,
+		})
+	}
+
+	initial, final := report.Inventory[0], report.Inventory[len(report.Inventory)-1]
+
+	report.FeesToken0 = s.fees0.Dec().TruncateInt()
+	report.FeesToken1 = s.fees1.Dec().TruncateInt()
+	report.FeesValue = value(s.fees0, s.fees1, price)
+	report.InitialValue = value(osmomath.BigDecFromSDKInt(p.Token0.Amount), osmomath.BigDecFromSDKInt(p.Token1.Amount), initial.Price)
+	report.FinalValue = final.Value
+	report.HodlValue = final.HodlValue
+	report.ImpermanentLoss = report.FinalValue - report.FeesValue - report.HodlValue
+	if report.HodlValue != 0 {
+		report.ImpermanentLossPct = report.ImpermanentLoss / report.HodlValue
+	}
+
+	return report, nil
+}
+
+// rebalance asks MarketMake for new ranges and, if they differ from the open
+// positions, withdraws the old positions and opens the new ones.
+func rebalance(l *zap.Logger, s *state, tick int64, sqrtPrice osmomath.BigDec, poolPrice, targetPrice float64, p Params) (bool, error) {
+	// Redeploy withdrawn amounts, or the initial inventory on the first run
+	var token0, token1 sdkmath.Int
+	if len(s.positions) == 0 {
+		token0, token1 = s.idle0.Dec().TruncateInt(), s.idle1.Dec().TruncateInt()
+	} else {
+		amount0, amount1 := s.holdings(sqrtPrice)
+		token0, token1 = amount0.Dec().TruncateInt(), amount1.Dec().TruncateInt()
+	}
+
+	msgs, err := liquidity.Place(l, 0, tick,
+		fmt.Sprintf("%f", poolPrice), fmt.Sprintf("%f", targetPrice), p.Position,
+		sdk.NewCoin(p.Token0.Denom, token0), sdk.NewCoin(p.Token1.Denom, token1), "backtest")
+	if err != nil {
+		return false, err
+	}
+
+	var created []*cltypes.MsgCreatePosition
+	for _, msg := range msgs {
+		if m, ok := msg.(*cltypes.MsgCreatePosition); ok {
+			created = append(created, m)
+		}
+	}
+
+	if sameRanges(s.positions, created) {
+		return false, nil
+	}
+
+	// Withdraw existing positions into the idle balance
+	amount0, amount1 := s.holdings(sqrtPrice)
+	s.idle0, s.idle1 = s.idle0.Add(amount0), s.idle1.Add(amount1)
+	s.positions = nil
+
+	for _, m := range created {
+		pos, err := open(m, sqrtPrice, p.Token0.Denom, p.Token1.Denom)
+		if err != nil {
+			return false, err
+		}
+
+		used0, used1 := pos.amounts(sqrtPrice)
+		s.idle0, s.idle1 = s.idle0.Sub(used0), s.idle1.Sub(used1)
+		s.positions = append(s.positions, pos)
+	}
+
+	return true, nil
+}
+
+// open converts a create position message into a modelled position.
+func open(m *cltypes.MsgCreatePosition, sqrtPrice osmomath.BigDec, denom0, denom1 string) (position, error) {
+	sqrtLower, sqrtUpper, err := clmath.TicksToSqrtPrice(m.LowerTick, m.UpperTick)
+	if err != nil {
+		return position{}, err
+	}
+
+	liq := clmath.GetLiquidityFromAmounts(sqrtPrice, sqrtLower, sqrtUpper,
+		m.TokensProvided.AmountOf(denom0), m.TokensProvided.AmountOf(denom1))
+
+	return position{
+		lowerTick: m.LowerTick,
+		upperTick: m.UpperTick,
+		sqrtLower: sqrtLower,
+		sqrtUpper: sqrtUpper,
+		liquidity: osmomath.BigDecFromDec(liq),
+	}, nil
+}
+
+func sameRanges(positions []position, msgs []*cltypes.MsgCreatePosition) bool {
+	if len(positions) != len(msgs) {
+		return false
+	}
+	for i, m := range msgs {
+		if positions[i].lowerTick != m.LowerTick || positions[i].upperTick != m.UpperTick {
+			return false
+		}
+	}
+	return true
+}
+
+// prices returns the pool price and target price for a sample, quoted as
+// token1 per token0 with the base asset as token0 and power as token1, which
+// is power per base asset like the power spot price.
+func prices(sample Sample, power maths.Power) (float64, float64, error) {
+	targetPrice, err := power.TargetPrice(sample.BasePrice, sample.NormalisationFactor)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	powerPrice, err := osmomath.NewBigDecFromStr(sample.PowerPrice)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if !powerPrice.IsPositive() || targetPrice <= 0 {
+		return 0, 0, fmt.Errorf("prices must be positive")
+	}
+
+	return powerPrice.MustFloat64(), targetPrice, nil
+}
+
+func priceToTick(price float64) (int64, osmomath.BigDec, error) {
+	priceBigDec, err := osmomath.NewBigDecFromStr(fmt.Sprintf("%.18f", price))
+	if err != nil {
+		return 0, osmomath.BigDec{}, err
+	}
+
+	tick, err := clmath.CalculatePriceToTick(priceBigDec)
+	if err != nil {
+		return 0, osmomath.BigDec{}, err
+	}
+
+	sqrtPrice, err := clmath.TickToSqrtPrice(tick)
+	if err != nil {
+		return 0, osmomath.BigDec{}, err
+	}
+
+	return tick, sqrtPrice, nil
+}
+
+func value(amount0, amount1 osmomath.BigDec, price float64) float64 {
+	return amount0.MustFloat64()*price + amount1.MustFloat64()
+}
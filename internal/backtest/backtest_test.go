@@ -0,0 +1,65 @@
+package backtest
+
+import (
+	"strings"
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/osmosis-labs/osmosis/osmomath"
+	"go.uber.org/zap"
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+const series = `time,base_price,power_price,normalisation_factor
+2024-01-01T00:00:00Z,10,10,1
+2024-01-01T01:00:00Z,10,10,1
+2024-01-01T02:00:00Z,10,12.5,1
+2024-01-01T03:00:00Z,10,8,1
+`
+
+func params() Params {
+	return Params{
+		Position:     types.Position{Spread: "0.1"},
+		IndexScale:   100,
+		SpreadFactor: osmomath.MustNewDecFromStr("0.002"),
+		Token0:       sdk.NewInt64Coin("uosmo", 1_000_000_000),
+		Token1:       sdk.NewInt64Coin("sqosmo", 100_000_000),
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	samples, err := ReadCSV(strings.NewReader(series))
+	assert.NilError(t, err)
+	assert.Equal(t, 4, len(samples))
+	assert.Equal(t, "12.5", samples[2].PowerPrice)
+
+	_, err = ReadCSV(strings.NewReader("time,base_price\n1,2\n"))
+	assert.ErrorContains(t, err, "missing column")
+}
+
+func TestRunFlatPriceHasNoFills(t *testing.T) {
+	samples, err := ReadCSV(strings.NewReader(series))
+	assert.NilError(t, err)
+
+	report, err := Run(zap.NewNop(), samples[:2], params())
+	assert.NilError(t, err)
+
+	assert.Equal(t, 0, report.Fills)
+	assert.Equal(t, 0, report.Rebalances)
+	assert.Assert(t, report.FeesToken0.IsZero() && report.FeesToken1.IsZero())
+}
+
+func TestRunPriceMovesFillAndEarnFees(t *testing.T) {
+	samples, err := ReadCSV(strings.NewReader(series))
+	assert.NilError(t, err)
+
+	report, err := Run(zap.NewNop(), samples, params())
+	assert.NilError(t, err)
+
+	assert.Equal(t, 4, len(report.Inventory))
+	assert.Assert(t, report.Fills > 0)
+	assert.Assert(t, report.Rebalances > 0)
+	assert.Assert(t, report.FeesValue > 0)
+}
@@ -0,0 +1,99 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sample is a single observation of the market used to drive a backtest.
+// The power price is power per base asset, as recorded by the bot.
+type Sample struct {
+	Time                time.Time `json:"time"`
+	BasePrice           string    `json:"base_price"`
+	PowerPrice          string    `json:"power_price"`
+	NormalisationFactor string    `json:"normalisation_factor"`
+}
+
+var requiredColumns = []string{"time", "base_price", "power_price", "normalisation_factor"}
+
+// LoadCSV reads samples from a CSV file. The first row must be a header
+// containing the columns time, base_price, power_price and
+// normalisation_factor in any order. Times may be RFC3339 or unix seconds.
+func LoadCSV(path string) ([]Sample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadCSV(f)
+}
+
+// ReadCSV reads samples in the format described by LoadCSV.
+func ReadCSV(r io.Reader) ([]Sample, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, name := range requiredColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column: %s", name)
+		}
+	}
+
+	var samples []Sample
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		t, err := parseTime(record[columns["time"]])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		samples = append(samples, Sample{
+			Time:                t,
+			BasePrice:           record[columns["base_price"]],
+			PowerPrice:          record[columns["power_price"]],
+			NormalisationFactor: record[columns["normalisation_factor"]],
+		})
+	}
+
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no samples")
+	}
+
+	return samples, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if unix, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(unix, 0).UTC(), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time: %s", s)
+	}
+
+	return t, nil
+}
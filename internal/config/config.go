@@ -1,6 +1,8 @@
 package config
 
 import (
+	"errors"
+
 	"github.com/BurntSushi/toml"
 
 	"github.com/margined-protocol/flood/internal/types"
@@ -8,8 +10,15 @@ import (
 
 func LoadConfig(configPath string) (*types.Config, error) {
 	var config types.Config
-	if _, err := toml.DecodeFile(configPath, &config); err != nil {
+	md, err := toml.DecodeFile(configPath, &config)
+	if err != nil {
 		return nil, err
 	}
+
+	// lp_spread was never used, fail rather than silently ignore it
+	if md.IsDefined("position", "lp_spread") {
+		return nil, errors.New("position.lp_spread is not supported, use spread or buy_spread and sell_spread")
+	}
+
 	return &config, nil
 }
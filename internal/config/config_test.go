@@ -0,0 +1,70 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	assert.NilError(t, os.WriteFile(path, []byte(contents), 0o600))
+	return path
+}
+
+func TestLoadConfigPositionSpreads(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, `
+[position]
+spread      = "0.1"
+sell_spread = "0.2"
+inner_gap   = 300
+`))
+	assert.NilError(t, err)
+	assert.Equal(t, "0.1", cfg.Position.Spread)
+	assert.Equal(t, "", cfg.Position.BuySpread)
+	assert.Equal(t, "0.2", cfg.Position.SellSpread)
+	assert.Equal(t, int64(300), cfg.Position.InnerGap)
+}
+
+func TestLoadConfigRejectsLpSpread(t *testing.T) {
+	_, err := LoadConfig(writeConfig(t, `
+[position]
+spread    = "0.1"
+lp_spread = "0.05"
+`))
+	assert.ErrorContains(t, err, "lp_spread is not supported")
+}
+
+func TestLoadConfigAmounts(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, `
+[position]
+default_token_0_amount = 1000000
+default_token_1_amount = "1500.5"
+
+[[assets]]
+denom    = "uosmo"
+decimals = 6
+`))
+	assert.NilError(t, err)
+
+	amount0, err := cfg.Position.DefaultToken0Amount.Int()
+	assert.NilError(t, err)
+	assert.Equal(t, int64(1000000), amount0.Int64())
+
+	assert.Assert(t, cfg.Position.DefaultToken1Amount.IsWhole())
+	assert.Equal(t, "1500.5", cfg.Position.DefaultToken1Amount.Value())
+	_, err = cfg.Position.DefaultToken1Amount.Int()
+	assert.ErrorContains(t, err, "whole units")
+
+	assert.Equal(t, 1, len(cfg.Assets))
+	assert.Equal(t, uint64(6), cfg.Assets[0].Decimals)
+
+	_, err = LoadConfig(writeConfig(t, `
+[position]
+default_token_0_amount = 1.5
+`))
+	assert.ErrorContains(t, err, "amount must be an integer in raw units or a string in whole units")
+}
@@ -0,0 +1,430 @@
+// Package endpoints spreads queries over a list of nodes. Pool sends gRPC
+// queries to the preferred healthy endpoint and fails over to the next when
+// one is unreachable or trails the others' block height, Select picks the
+// RPC endpoint used for transactions.
+package endpoints
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	rpchttp "github.com/cometbft/cometbft/rpc/client/http"
+	"github.com/cosmos/cosmos-sdk/client/grpc/tmservice"
+	"github.com/cosmos/cosmos-sdk/codec"
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/margined-protocol/flood/internal/queries"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+const (
+	// DefaultMaxHeightLag is the number of blocks an endpoint may trail the
+	// highest before it is skipped
+	DefaultMaxHeightLag = 5
+	// DefaultTimeout bounds each health check
+	DefaultTimeout = 5 * time.Second
+)
+
+// Endpoint is a connection to a gRPC node.
+type Endpoint struct {
+	Address string
+	Conn    *grpc.ClientConn
+}
+
+type node struct {
+	Endpoint
+	height int64
+	// err is why the node was skipped at the last check or call, nil when
+	// healthy
+	err error
+}
+
+// Pool is a gRPC client connection over several endpoints. Calls go to the
+// first healthy endpoint in order of preference and move on to the next when
+// the endpoint is unavailable.
+type Pool struct {
+	l       *zap.Logger
+	maxLag  int64
+	timeout time.Duration
+
+	mu     sync.Mutex
+	nodes  []*node
+	served []string
+}
+
+// New returns a pool of the endpoints in order of preference, all of them
+// are healthy until checked.
+func New(l *zap.Logger, maxLag int64, timeout time.Duration, endpoints ...Endpoint) (*Pool, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("no gRPC endpoints")
+	}
+
+	if maxLag <= 0 {
+		maxLag = DefaultMaxHeightLag
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	p := &Pool{l: l, maxLag: maxLag, timeout: timeout}
+	for _, e := range endpoints {
+		p.nodes = append(p.nodes, &node{Endpoint: e})
+	}
+
+	return p, nil
+}
+
+// Dial connects to the configured gRPC endpoints, falling back to
+// grpc_server_address.
+func Dial(l *zap.Logger, cfg *types.Config) (*Pool, error) {
+	addresses := cfg.Endpoints.GRPC
+	if len(addresses) == 0 && cfg.GRPCServerAddress != "" {
+		addresses = []string{cfg.GRPCServerAddress}
+	}
+
+	var roots *x509.CertPool
+	if cfg.Endpoints.CAFile != "" {
+		pem, err := os.ReadFile(cfg.Endpoints.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca_file: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", cfg.Endpoints.CAFile)
+		}
+	}
+
+	// Queries carry gogoproto messages
+	cdc := codec.NewProtoCodec(codectypes.NewInterfaceRegistry())
+
+	var endpoints []Endpoint
+	for _, address := range addresses {
+		target, creds := transport(address, roots)
+		conn, err := grpc.Dial(target,
+			grpc.WithTransportCredentials(creds),
+			grpc.WithDefaultCallOptions(grpc.ForceCodec(cdc.GRPCCodec())),
+		)
+		if err != nil {
+			closeAll(endpoints)
+			return nil, fmt.Errorf("failed to dial %s: %w", address, err)
+		}
+		endpoints = append(endpoints, Endpoint{Address: address, Conn: conn})
+	}
+
+	return New(l, cfg.Endpoints.MaxHeightLag, cfg.Endpoints.Timeout, endpoints...)
+}
+
+// transport returns the dial target and credentials of an address, https://
+// connects with TLS on port 443 unless another is given.
+func transport(address string, roots *x509.CertPool) (string, credentials.TransportCredentials) {
+	if target, ok := strings.CutPrefix(address, "https://"); ok {
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			target = net.JoinHostPort(target, "443")
+		}
+		return target, credentials.NewTLS(&tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12})
+	}
+
+	return strings.TrimPrefix(address, "http://"), insecure.NewCredentials()
+}
+
+// Check queries the latest height of every endpoint. Endpoints that fail or
+// trail the highest by more than the allowed lag are skipped until the next
+// check. It errors when no endpoint is healthy.
+func (p *Pool) Check(ctx context.Context) error {
+	heights := make([]int64, len(p.nodes))
+	errs := make([]error, len(p.nodes))
+
+	var wg sync.WaitGroup
+	for i, n := range p.nodes {
+		wg.Add(1)
+		go func(i int, n *node) {
+			defer wg.Done()
+			heights[i], errs[i] = p.latestHeight(ctx, n.Conn)
+		}(i, n)
+	}
+	wg.Wait()
+
+	var highest int64
+	for i := range p.nodes {
+		if errs[i] == nil && heights[i] > highest {
+			highest = heights[i]
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	before := p.active()
+	p.served = nil
+
+	var unhealthy []error
+	for i, n := range p.nodes {
+		n.height = heights[i]
+		switch {
+		case errs[i] != nil:
+			n.err = errs[i]
+		case highest-heights[i] > p.maxLag:
+			n.err = fmt.Errorf("height %d is %d blocks behind %d", heights[i], highest-heights[i], highest)
+		default:
+			n.err = nil
+			continue
+		}
+
+		p.l.Warn("Skipping gRPC endpoint", zap.String("endpoint", n.Address), zap.Error(n.err))
+		unhealthy = append(unhealthy, fmt.Errorf("%s: %w", n.Address, n.err))
+	}
+
+	after := p.active()
+	if after == nil {
+		return fmt.Errorf("no healthy gRPC endpoint: %w", errors.Join(unhealthy...))
+	}
+
+	if before != after {
+		p.l.Info("Using gRPC endpoint", zap.String("endpoint", after.Address), zap.Int64("height", after.height))
+	}
+
+	return nil
+}
+
+func (p *Pool) latestHeight(ctx context.Context, conn *grpc.ClientConn) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	block, err := queries.GetLatestBlock(ctx, tmservice.NewServiceClient(conn))
+	if err != nil {
+		return 0, err
+	}
+
+	return block.Height, nil
+}
+
+// Invoke sends a unary call to the first healthy endpoint, failing over to
+// the next while endpoints are unavailable.
+func (p *Pool) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	var errs []error
+	for _, n := range p.healthy() {
+		err := n.Conn.Invoke(ctx, method, args, reply, opts...)
+		if err != nil && failover(ctx, err) {
+			p.skip(n, err)
+			errs = append(errs, fmt.Errorf("%s: %w", n.Address, err))
+			continue
+		}
+
+		p.serve(n)
+		return err
+	}
+
+	if len(errs) == 0 {
+		return errors.New("no healthy gRPC endpoint")
+	}
+
+	return errors.Join(errs...)
+}
+
+// NewStream opens a stream on the first healthy endpoint.
+func (p *Pool) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	nodes := p.healthy()
+	if len(nodes) == 0 {
+		return nil, errors.New("no healthy gRPC endpoint")
+	}
+
+	p.serve(nodes[0])
+	return nodes[0].Conn.NewStream(ctx, desc, method, opts...)
+}
+
+// Served returns the endpoints that answered calls since the last check, in
+// the order they were first used.
+func (p *Pool) Served() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.served...)
+}
+
+// Close closes the connections to every endpoint.
+func (p *Pool) Close() error {
+	var errs []error
+	for _, n := range p.nodes {
+		errs = append(errs, n.Conn.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// active returns the preferred healthy node, the caller holds the lock.
+func (p *Pool) active() *node {
+	for _, n := range p.nodes {
+		if n.err == nil {
+			return n
+		}
+	}
+	return nil
+}
+
+func (p *Pool) healthy() []*node {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var nodes []*node
+	for _, n := range p.nodes {
+		if n.err == nil {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+func (p *Pool) skip(n *node, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if n.err == nil {
+		p.l.Warn("Failing over from gRPC endpoint", zap.String("endpoint", n.Address), zap.Error(err))
+		n.err = err
+	}
+}
+
+func (p *Pool) serve(n *node) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, address := range p.served {
+		if address == n.Address {
+			return
+		}
+	}
+	p.served = append(p.served, n.Address)
+}
+
+// failover reports whether the error comes from the endpoint rather than the
+// query, so another endpoint may answer it. That includes a node that has
+// not reached, or has pruned, the height a query is pinned to.
+func failover(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	}
+
+	return heightUnavailable(err)
+}
+
+// heightUnavailableErrors are the messages of the cosmos SDK when a node
+// cannot answer at the requested height
+var heightUnavailableErrors = []string{
+	"cannot query with height in the future",
+	"failed to load state at height",
+	"version does not exist",
+}
+
+func heightUnavailable(err error) bool {
+	message := status.Convert(err).Message()
+	for _, e := range heightUnavailableErrors {
+		if strings.Contains(message, e) {
+			return true
+		}
+	}
+	return false
+}
+
+func closeAll(endpoints []Endpoint) {
+	for _, e := range endpoints {
+		_ = e.Conn.Close()
+	}
+}
+
+// StatusFunc returns the latest height of a node and whether it is still
+// catching up.
+type StatusFunc func(ctx context.Context, address string) (height int64, catchingUp bool, err error)
+
+// RPCStatus queries the status of a CometBFT RPC node.
+func RPCStatus(websocketPath string) StatusFunc {
+	return func(ctx context.Context, address string) (int64, bool, error) {
+		client, err := rpchttp.New(address, websocketPath)
+		if err != nil {
+			return 0, false, err
+		}
+
+		res, err := client.Status(ctx)
+		if err != nil {
+			return 0, false, err
+		}
+
+		return res.SyncInfo.LatestBlockHeight, res.SyncInfo.CatchingUp, nil
+	}
+}
+
+// Select returns the first address, in order of preference, whose node is
+// synced and within the allowed lag of the highest. A single address is
+// returned without a check.
+func Select(ctx context.Context, addresses []string, maxLag int64, timeout time.Duration, status StatusFunc) (string, error) {
+	switch len(addresses) {
+	case 0:
+		return "", errors.New("no RPC endpoints")
+	case 1:
+		return addresses[0], nil
+	}
+
+	if maxLag <= 0 {
+		maxLag = DefaultMaxHeightLag
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	heights := make([]int64, len(addresses))
+	errs := make([]error, len(addresses))
+
+	var wg sync.WaitGroup
+	for i, address := range addresses {
+		wg.Add(1)
+		go func(i int, address string) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			height, catchingUp, err := status(ctx, address)
+			if err == nil && catchingUp {
+				err = errors.New("node is catching up")
+			}
+			heights[i], errs[i] = height, err
+		}(i, address)
+	}
+	wg.Wait()
+
+	var highest int64
+	for i := range addresses {
+		if errs[i] == nil && heights[i] > highest {
+			highest = heights[i]
+		}
+	}
+
+	var unhealthy []error
+	for i, address := range addresses {
+		if errs[i] == nil && highest-heights[i] > maxLag {
+			errs[i] = fmt.Errorf("height %d is %d blocks behind %d", heights[i], highest-heights[i], highest)
+		}
+		if errs[i] == nil {
+			return address, nil
+		}
+		unhealthy = append(unhealthy, fmt.Errorf("%s: %w", address, errs[i]))
+	}
+
+	return "", fmt.Errorf("no healthy RPC endpoint: %w", errors.Join(unhealthy...))
+}
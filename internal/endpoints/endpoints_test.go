@@ -0,0 +1,207 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pmquery "github.com/osmosis-labs/osmosis/v21/x/poolmanager/client/queryproto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/mock"
+	"github.com/margined-protocol/flood/internal/queries"
+)
+
+const (
+	spotPrice     = "/osmosis.poolmanager.v1beta1.Query/SpotPrice"
+	latestBlock   = "/cosmos.base.tendermint.v1beta1.Service/GetLatestBlock"
+	firstAddress  = "first:9090"
+	secondAddress = "second:9090"
+)
+
+// newPool serves the same spot price from two chains, the first preferred
+func newPool(t *testing.T) (*Pool, *mock.Chain, *mock.Chain) {
+	t.Helper()
+
+	var endpoints []Endpoint
+	var chains []*mock.Chain
+	for _, address := range []string{firstAddress, secondAddress} {
+		chain := mock.NewChain()
+		chain.SetSpotPrice(1, "uosmo", "uusdc", "10")
+
+		conn, err := chain.Start()
+		assert.NilError(t, err)
+		t.Cleanup(chain.Stop)
+
+		endpoints = append(endpoints, Endpoint{Address: address, Conn: conn})
+		chains = append(chains, chain)
+	}
+
+	p, err := New(zap.NewNop(), 5, time.Second, endpoints...)
+	assert.NilError(t, err)
+	t.Cleanup(func() { _ = p.Close() })
+
+	return p, chains[0], chains[1]
+}
+
+func querySpotPrice(ctx context.Context, p *Pool) error {
+	_, err := pmquery.NewQueryClient(p).SpotPrice(ctx, &pmquery.SpotPriceRequest{
+		PoolId:          1,
+		BaseAssetDenom:  "uosmo",
+		QuoteAssetDenom: "uusdc",
+	})
+	return err
+}
+
+func TestPoolPrefersFirstEndpoint(t *testing.T) {
+	p, first, second := newPool(t)
+	ctx := context.Background()
+
+	assert.NilError(t, p.Check(ctx))
+	assert.NilError(t, querySpotPrice(ctx, p))
+	assert.DeepEqual(t, []string{firstAddress}, p.Served())
+	assert.Equal(t, 1, first.Calls(spotPrice))
+	assert.Equal(t, 0, second.Calls(spotPrice))
+}
+
+func TestPoolFailsOverWhenUnavailable(t *testing.T) {
+	p, first, second := newPool(t)
+	ctx := context.Background()
+
+	first.Fail(spotPrice, status.Error(codes.Unavailable, "node down"))
+
+	assert.NilError(t, querySpotPrice(ctx, p))
+	assert.DeepEqual(t, []string{secondAddress}, p.Served())
+
+	// The failed endpoint is skipped until the next check
+	assert.NilError(t, querySpotPrice(ctx, p))
+	assert.Equal(t, 1, first.Calls(spotPrice))
+	assert.Equal(t, 2, second.Calls(spotPrice))
+
+	first.Fail(spotPrice, nil)
+	assert.NilError(t, p.Check(ctx))
+	assert.NilError(t, querySpotPrice(ctx, p))
+	assert.DeepEqual(t, []string{firstAddress}, p.Served())
+}
+
+func TestPoolFailsOverBelowPinnedHeight(t *testing.T) {
+	p, first, second := newPool(t)
+	first.SetBlock(100, time.Now())
+	second.SetBlock(103, time.Now())
+
+	// The first endpoint has not reached the height yet
+	ctx := queries.AtHeight(context.Background(), 103)
+	assert.NilError(t, querySpotPrice(ctx, p))
+	assert.DeepEqual(t, []string{secondAddress}, p.Served())
+	assert.Equal(t, 1, first.Calls(spotPrice))
+	assert.Equal(t, int64(103), second.QueryHeight(spotPrice))
+}
+
+func TestPoolReturnsQueryErrors(t *testing.T) {
+	p, first, second := newPool(t)
+
+	first.Fail(spotPrice, status.Error(codes.NotFound, "no such pool"))
+
+	err := querySpotPrice(context.Background(), p)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, 0, second.Calls(spotPrice))
+}
+
+func TestPoolJoinsErrorsWhenAllEndpointsFail(t *testing.T) {
+	p, first, second := newPool(t)
+	ctx := context.Background()
+
+	first.Fail(spotPrice, status.Error(codes.Unavailable, "first down"))
+	second.Fail(spotPrice, status.Error(codes.Unavailable, "second down"))
+
+	err := querySpotPrice(ctx, p)
+	assert.ErrorContains(t, err, "first:9090")
+	assert.ErrorContains(t, err, "second down")
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	err = querySpotPrice(ctx, p)
+	assert.ErrorContains(t, err, "no healthy gRPC endpoint")
+}
+
+func TestCheckSkipsLaggingEndpoints(t *testing.T) {
+	p, first, second := newPool(t)
+	ctx := context.Background()
+
+	first.SetBlock(100, time.Time{})
+	second.SetBlock(110, time.Time{})
+
+	assert.NilError(t, p.Check(ctx))
+	assert.NilError(t, querySpotPrice(ctx, p))
+	assert.DeepEqual(t, []string{secondAddress}, p.Served())
+
+	// Within the allowed lag the preferred endpoint is used again
+	first.SetBlock(106, time.Time{})
+	assert.NilError(t, p.Check(ctx))
+	assert.NilError(t, querySpotPrice(ctx, p))
+	assert.DeepEqual(t, []string{firstAddress}, p.Served())
+}
+
+func TestCheckFailsWithoutHealthyEndpoint(t *testing.T) {
+	p, first, second := newPool(t)
+
+	first.Fail(latestBlock, status.Error(codes.Unavailable, "first down"))
+	second.Fail(latestBlock, status.Error(codes.Unavailable, "second down"))
+
+	err := p.Check(context.Background())
+	assert.ErrorContains(t, err, "no healthy gRPC endpoint")
+	assert.ErrorContains(t, err, "second:9090")
+}
+
+func TestTransport(t *testing.T) {
+	target, creds := transport("https://grpc.osmosis.zone", nil)
+	assert.Equal(t, "grpc.osmosis.zone:443", target)
+	assert.Equal(t, "tls", creds.Info().SecurityProtocol)
+
+	target, creds = transport("https://grpc.osmosis.zone:9443", nil)
+	assert.Equal(t, "grpc.osmosis.zone:9443", target)
+	assert.Equal(t, "tls", creds.Info().SecurityProtocol)
+
+	target, creds = transport("osmosis-grpc.polkachu.com:12590", nil)
+	assert.Equal(t, "osmosis-grpc.polkachu.com:12590", target)
+	assert.Equal(t, insecure.NewCredentials().Info().SecurityProtocol, creds.Info().SecurityProtocol)
+}
+
+func TestSelect(t *testing.T) {
+	nodes := map[string]struct {
+		height     int64
+		catchingUp bool
+		err        error
+	}{
+		"down":    {err: errors.New("connection refused")},
+		"syncing": {height: 120, catchingUp: true},
+		"behind":  {height: 90},
+		"synced":  {height: 100},
+	}
+	status := func(_ context.Context, address string) (int64, bool, error) {
+		n := nodes[address]
+		return n.height, n.catchingUp, n.err
+	}
+	ctx := context.Background()
+
+	address, err := Select(ctx, []string{"down", "syncing", "behind", "synced"}, 5, time.Second, status)
+	assert.NilError(t, err)
+	assert.Equal(t, "synced", address)
+
+	address, err = Select(ctx, []string{"behind", "synced"}, 20, time.Second, status)
+	assert.NilError(t, err)
+	assert.Equal(t, "behind", address)
+
+	_, err = Select(ctx, []string{"down", "syncing"}, 5, time.Second, status)
+	assert.ErrorContains(t, err, "no healthy RPC endpoint")
+	assert.ErrorContains(t, err, "syncing: node is catching up")
+
+	// A single endpoint is used without a check
+	address, err = Select(ctx, []string{"down"}, 5, time.Second, status)
+	assert.NilError(t, err)
+	assert.Equal(t, "down", address)
+}
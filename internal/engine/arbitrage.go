@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/margined-protocol/flood/internal/arbitrage"
+	"github.com/margined-protocol/flood/internal/notify"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+// arbitrage looks for a premium trade through the power contract and, when
+// one is profitable, simulates each leg and broadcasts them together. It
+// returns nil if there is nothing to trade.
+func (c *Cycle) arbitrage(ctx context.Context, market *Market, result *CycleResult) (*arbitrage.Opportunity, error) {
+	l, cfg := c.Logger, c.Config.Arbitrage
+
+	if c.Simulator == nil {
+		return nil, c.fail(ctx, notify.EventCycleFailed, "Invalid arbitrage config", errors.New("arbitrage needs a simulator"))
+	}
+
+	var vault *types.GetVaultResponse
+	if cfg.VaultID != 0 {
+		v, err := c.Querier.Vault(market.At(ctx), cfg.VaultID)
+		if err != nil {
+			return nil, c.fail(ctx, notify.EventQueryFailed, "Failed to get vault", err)
+		}
+		vault = &v
+	}
+
+	powerDenom, baseDenom, err := market.Config.PowerDenoms()
+	if err != nil {
+		return nil, c.fail(ctx, notify.EventCycleFailed, "Invalid power pool", err)
+	}
+
+	// The min profit is an amount of the base asset, the max size of power
+	if err := c.rawAmounts(ctx, baseDenom, &cfg.MinProfit); err != nil {
+		return nil, c.fail(ctx, notify.EventCycleFailed, "Invalid arbitrage config", fmt.Errorf("invalid min_profit: %w", err))
+	}
+	if err := c.rawAmounts(ctx, powerDenom, &cfg.MaxSize); err != nil {
+		return nil, c.fail(ctx, notify.EventCycleFailed, "Invalid arbitrage config", fmt.Errorf("invalid max_size: %w", err))
+	}
+
+	opp, err := arbitrage.Find(market.At(ctx), c.Querier, c.queryTimeout(), cfg, arbitrage.Market{
+		Premium:             market.Premium,
+		BasePrice:           market.BaseSpotPrice,
+		PowerPrice:          market.PowerSpotPrice,
+		NormalisationFactor: market.NormalisationFactor,
+		Power:               market.Power,
+		FeeRate:             market.Config.FeeRate,
+		PoolID:              market.Config.PowerPool.ID,
+		PowerDenom:          powerDenom,
+		BaseDenom:           baseDenom,
+	}, vault)
+	if err != nil {
+		return nil, c.fail(ctx, notify.EventCycleFailed, "Failed to size arbitrage", err)
+	}
+	if opp == nil {
+		return nil, nil
+	}
+
+	msgs, err := opp.Msgs(c.Address, c.Config.PowerPool.ContractAddress, cfg.VaultID, market.Config.PowerPool.ID)
+	if err != nil {
+		return nil, c.fail(ctx, notify.EventCycleFailed, "Failed to create arbitrage msgs", err)
+	}
+	result.Msgs = msgs
+
+	l.Info("Arbitrage opportunity",
+		zap.String("direction", string(opp.Direction)),
+		zap.Float64("premium", opp.Premium),
+		zap.String("power", opp.Power.String()),
+		zap.String("collateral", opp.Collateral.String()),
+		zap.String("swap_in", opp.SwapIn.String()),
+		zap.String("estimated_out", opp.EstimatedOut.String()),
+		zap.Float64("impact", opp.Impact),
+		zap.Float64("profit", opp.Profit),
+	)
+
+	// The first leg must succeed alone and the second on top of it
+	for i := range msgs {
+		if err := c.Simulator.Simulate(ctx, c.Account, msgs[:i+1]...); err != nil {
+			return nil, c.fail(ctx, notify.EventCycleFailed, "Arbitrage simulation failed", fmt.Errorf("leg %d: %w", i+1, err))
+		}
+	}
+
+	if c.DryRun {
+		l.Info("Dry run, not broadcasting", zap.Reflect("msgs", msgs))
+		result.Decision = DecisionDryRun
+		return opp, nil
+	}
+
+	txResp, err := c.broadcast(ctx, msgs)
+	if err != nil {
+		return nil, c.fail(ctx, notify.EventTxFailed, "Arbitrage transaction error", err)
+	}
+
+	c.send(ctx, notify.Message{
+		Event:    notify.EventArbitrage,
+		Severity: notify.SeverityInfo,
+		Title:    "Arbitraged premium",
+		Fields: map[string]string{
+			"tx_hash":   txResp.TxHash,
+			"direction": string(opp.Direction),
+			"premium":   fmt.Sprintf("%f", opp.Premium),
+			"power":     opp.Power.String(),
+			"profit":    fmt.Sprintf("%f", opp.Profit),
+		},
+	})
+
+	result.Decision = DecisionArbitraged
+	result.TxHash = txResp.TxHash
+
+	return opp, nil
+}
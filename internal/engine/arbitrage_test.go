@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	sdkmath "cosmossdk.io/math"
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	pmtypes "github.com/osmosis-labs/osmosis/v21/x/poolmanager/types"
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/arbitrage"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+func TestRunArbitragesPremium(t *testing.T) {
+	c, q, b, s, _ := newCycle()
+	sim := &fakeSimulator{}
+	c.Simulator = sim
+	c.Config.Arbitrage = types.Arbitrage{Enabled: true, MaxSize: types.RawAmount(sdkmath.NewInt(1_000_000)), MinProfit: types.RawAmount(sdkmath.NewInt(1)), MaxImpact: "0.05"}
+
+	// mark = 10 / 900 * 10000 = 111.1, an 11% premium over the index, and
+	// selling power fills 1% below spot
+	q.powerPrice = "900"
+	q.rate = 0.99 / 900
+
+	result := c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+	assert.Equal(t, DecisionArbitraged, result.Decision)
+	assert.Assert(t, s.market == nil, "liquidity is not placed in the same cycle")
+
+	opp := result.Arbitrage
+	assert.Equal(t, arbitrage.DirectionMintAndSell, opp.Direction)
+	assert.Equal(t, int64(1_000_000), opp.Power.Amount.Int64())
+
+	// Each leg is simulated on top of the previous one before broadcasting
+	assert.Equal(t, 2, len(sim.calls))
+	assert.Equal(t, 1, len(sim.calls[0]))
+	assert.Equal(t, 2, len(sim.calls[1]))
+
+	assert.Equal(t, 1, len(b.sent))
+	_, ok := b.sent[0][0].(*wasmtypes.MsgExecuteContract)
+	assert.Assert(t, ok)
+	_, ok = b.sent[0][1].(*pmtypes.MsgSwapExactAmountIn)
+	assert.Assert(t, ok)
+}
+
+func TestRunArbitrageSimulationFails(t *testing.T) {
+	c, q, b, _, _ := newCycle()
+	c.Simulator = &fakeSimulator{err: errors.New("insufficient collateral")}
+	c.Config.Arbitrage = types.Arbitrage{Enabled: true, MaxSize: types.RawAmount(sdkmath.NewInt(1_000_000)), MaxImpact: "0.05"}
+	q.powerPrice = "900"
+	q.rate = 0.99 / 900
+
+	result := c.Run(context.Background(), false)
+	assert.Equal(t, DecisionFailed, result.Decision)
+	assert.ErrorContains(t, result.Err, "Arbitrage simulation failed")
+	assert.Equal(t, 0, len(b.sent))
+}
+
+func TestRunSkipsArbitrageBelowThreshold(t *testing.T) {
+	c, _, b, s, _ := newCycle()
+	c.Simulator = &fakeSimulator{}
+	c.Config.Arbitrage = types.Arbitrage{Enabled: true, MaxSize: types.RawAmount(sdkmath.NewInt(1_000_000))}
+
+	result := c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+	assert.Equal(t, DecisionRebalanced, result.Decision)
+	assert.Assert(t, result.Arbitrage == nil)
+	assert.Assert(t, s.market != nil)
+	assert.Equal(t, 1, len(b.sent))
+}
@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	sdkmath "cosmossdk.io/math"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	model "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/model"
+	"go.uber.org/zap"
+
+	"github.com/margined-protocol/flood/internal/fetch"
+	"github.com/margined-protocol/flood/internal/liquidity"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+// Balances are the signer's wallet balances of the power pool's tokens and
+// how much of them new positions use.
+type Balances struct {
+	Wallet sdk.Coins `json:"wallet"`
+	// Reserve is kept back in the fee denom for gas
+	Reserve sdk.Coin `json:"reserve"`
+	// Available is the wallet less the reserve
+	Available sdk.Coins `json:"available"`
+	// Deployed is placed in new positions from the wallet
+	Deployed sdk.Coins `json:"deployed"`
+	// Idle is left in the wallet
+	Idle sdk.Coins `json:"idle"`
+	// Capped is set when the default amounts were cut to what is available
+	Capped bool `json:"capped,omitempty"`
+}
+
+// sizePositions reads the wallet balances and returns the config with the
+// default amounts, or the balance share, in raw units capped at the
+// available funds. Existing positions are redeployed as they are, so the
+// wallet is left idle.
+func (c *Cycle) sizePositions(ctx context.Context, cfg *types.Config, market *Market, positions []model.FullPositionBreakdown) (*types.Config, *Balances, error) {
+	l, position := c.Logger, cfg.Position
+	base, quote := liquidity.DefaultDenoms(cfg.PowerPool, market.Token0, market.Token1)
+
+	reserve, err := c.gasReserve(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wallet, err := c.walletBalances(ctx, market, base, quote)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b := &Balances{Wallet: wallet, Reserve: reserve}
+	b.Available = b.Wallet
+	if reserve.Denom != "" && reserve.IsPositive() {
+		if held := b.Wallet.AmountOf(reserve.Denom); held.IsPositive() {
+			b.Available = b.Wallet.Sub(sdk.NewCoin(reserve.Denom, sdkmath.MinInt(held, reserve.Amount)))
+		}
+	}
+
+	if len(positions) > 0 {
+		b.Idle = b.Wallet
+		c.logBalances(ctx, b)
+		return cfg, b, nil
+	}
+
+	var amount0, amount1 sdk.Coin
+	if position.BalanceShare != "" {
+		share, err := sdkmath.LegacyNewDecFromStr(position.BalanceShare)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid balance share: %w", err)
+		}
+		if !share.IsPositive() || share.GT(sdkmath.LegacyOneDec()) {
+			return nil, nil, fmt.Errorf("balance share must be above 0 and at most 1")
+		}
+		amount0 = sdk.Coin{Denom: base, Amount: share.MulInt(b.Available.AmountOf(base)).TruncateInt()}
+		amount1 = sdk.Coin{Denom: quote, Amount: share.MulInt(b.Available.AmountOf(quote)).TruncateInt()}
+	} else {
+		// Both denoms' metadata is read at once, Coin reports any failure
+		_ = c.registry().Load(ctx, c.queryTimeout(), base, quote)
+		if amount0, err = c.registry().Coin(ctx, base, position.DefaultToken0Amount); err != nil {
+			return nil, nil, fmt.Errorf("invalid default_token_0_amount: %w", err)
+		}
+		if amount1, err = c.registry().Coin(ctx, quote, position.DefaultToken1Amount); err != nil {
+			return nil, nil, fmt.Errorf("invalid default_token_1_amount: %w", err)
+		}
+	}
+
+	for _, amount := range []*sdk.Coin{&amount0, &amount1} {
+		if available := b.Available.AmountOf(amount.Denom); amount.Amount.GT(available) {
+			l.Warn("Not enough funds for the default amount, deploying what is available",
+				zap.String("amount", c.describe(ctx, *amount)),
+				zap.String("available", c.describe(ctx, sdk.Coin{Denom: amount.Denom, Amount: available})),
+			)
+			amount.Amount = available
+			b.Capped = true
+		}
+	}
+
+	b.Deployed = sdk.NewCoins(amount0, amount1)
+	b.Idle = b.Wallet.Sub(b.Deployed...)
+	c.logBalances(ctx, b)
+
+	adjusted := *cfg
+	adjusted.Position.DefaultToken0Amount = types.RawAmount(amount0.Amount)
+	adjusted.Position.DefaultToken1Amount = types.RawAmount(amount1.Amount)
+
+	return &adjusted, b, nil
+}
+
+// balances reads the signer's balances of the denoms concurrently
+func (c *Cycle) balances(ctx context.Context, denoms ...string) (sdk.Coins, error) {
+	balances := make([]sdk.Coin, len(denoms))
+	fetches := make([]fetch.Query, len(denoms))
+	for i, denom := range denoms {
+		i, denom := i, denom
+		fetches[i] = fetch.Query{Name: denom + " balance", Run: func(ctx context.Context) (err error) {
+			balances[i], err = c.Querier.Balance(ctx, c.Address, denom)
+			return err
+		}}
+	}
+	if err := fetch.All(ctx, c.queryTimeout(), fetches...); err != nil {
+		return nil, err
+	}
+
+	var coins sdk.Coins
+	for _, balance := range balances {
+		coins = coins.Add(balance)
+	}
+	return coins, nil
+}
+
+// walletBalances reads the signer's balances at the market height less what
+// earlier transactions of the cycle spent
+func (c *Cycle) walletBalances(ctx context.Context, market *Market, denoms ...string) (sdk.Coins, error) {
+	balances, err := c.balances(market.At(ctx), denoms...)
+	if err != nil {
+		return nil, err
+	}
+
+	coins := sdk.NewCoins()
+	for _, coin := range balances {
+		if left := coin.Amount.Sub(market.Spent.AmountOf(coin.Denom)); left.IsPositive() {
+			coins = coins.Add(sdk.NewCoin(coin.Denom, left))
+		}
+	}
+	return coins, nil
+}
+
+// gasReserve returns the configured gas reserve in the fee denom
+func (c *Cycle) gasReserve(ctx context.Context, cfg *types.Config) (sdk.Coin, error) {
+	reserve := cfg.Position.GasReserve
+	if !reserve.IsWhole() && reserve.Value() == "0" {
+		return sdk.Coin{}, nil
+	}
+
+	fees, err := sdk.ParseCoinsNormalized(cfg.Fees)
+	if err != nil || fees.Empty() {
+		return sdk.Coin{}, fmt.Errorf("gas_reserve needs the fee denom from fees")
+	}
+
+	coin, err := c.registry().Coin(ctx, fees[0].Denom, reserve)
+	if err != nil {
+		return sdk.Coin{}, fmt.Errorf("invalid gas_reserve: %w", err)
+	}
+
+	return coin, nil
+}
+
+func (c *Cycle) logBalances(ctx context.Context, b *Balances) {
+	fields := make([]zap.Field, 0, 2*len(b.Wallet))
+	for _, coin := range b.Wallet {
+		fields = append(fields,
+			zap.String("wallet_"+coin.Denom, c.describe(ctx, coin)),
+			zap.String("idle_"+coin.Denom, c.describe(ctx, sdk.Coin{Denom: coin.Denom, Amount: b.Idle.AmountOf(coin.Denom)})),
+		)
+	}
+	c.Logger.Info("Wallet balances", fields...)
+}
@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	sdkmath "cosmossdk.io/math"
+	model "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/model"
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+func defaultAmounts(t *testing.T, cfg *types.Config) (int64, int64) {
+	t.Helper()
+	amount0, err := cfg.Position.DefaultToken0Amount.Int()
+	assert.NilError(t, err)
+	amount1, err := cfg.Position.DefaultToken1Amount.Int()
+	assert.NilError(t, err)
+	return amount0.Int64(), amount1.Int64()
+}
+
+func TestRunCapsDefaultAmountsAtBalances(t *testing.T) {
+	c, q, _, s, _ := newCycle()
+	c.Config.Position.DefaultToken0Amount = types.RawAmount(sdkmath.NewInt(1_000_000))
+	c.Config.Position.DefaultToken1Amount = types.RawAmount(sdkmath.NewInt(5_000))
+	c.Config.Position.GasReserve = types.RawAmount(sdkmath.NewInt(100_000))
+	q.balances = map[string]int64{"uosmo": 600_000, "usqosmo": 20_000}
+
+	result := c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+
+	// uosmo is the fee denom so the reserve is kept back from it
+	amount0, amount1 := defaultAmounts(t, s.cfg)
+	assert.Equal(t, int64(500_000), amount0)
+	assert.Equal(t, int64(5_000), amount1)
+
+	b := result.Balances
+	assert.Assert(t, b.Capped)
+	assert.Equal(t, "100000uosmo", b.Reserve.String())
+	assert.Equal(t, "500000uosmo,20000usqosmo", b.Available.String())
+	assert.Equal(t, "100000uosmo,15000usqosmo", b.Idle.String())
+
+	// The config is unchanged for the next cycle
+	amount0, _ = defaultAmounts(t, c.Config)
+	assert.Equal(t, int64(1_000_000), amount0)
+}
+
+func TestRunSizesPositionsByBalanceShare(t *testing.T) {
+	c, q, _, s, _ := newCycle()
+	c.Config.Position.BalanceShare = "0.5"
+	q.balances = map[string]int64{"uosmo": 600_000, "usqosmo": 20_001}
+
+	result := c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+
+	amount0, amount1 := defaultAmounts(t, s.cfg)
+	assert.Equal(t, int64(300_000), amount0)
+	assert.Equal(t, int64(10_000), amount1)
+	assert.Assert(t, !result.Balances.Capped)
+	assert.Equal(t, "300000uosmo,10001usqosmo", result.Balances.Idle.String())
+
+	c.Config.Position.BalanceShare = "1.5"
+	result = c.Run(context.Background(), false)
+	assert.ErrorContains(t, result.Err, "balance share must be above 0 and at most 1")
+}
+
+func TestRunReportsIdleBalanceWithOpenPositions(t *testing.T) {
+	c, q, _, s, _ := newCycle()
+	c.Config.Position.DefaultToken0Amount = types.RawAmount(sdkmath.NewInt(1_000_000))
+	q.positions = []model.FullPositionBreakdown{{}}
+	q.balances = map[string]int64{"uosmo": 600_000}
+
+	result := c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+
+	// Open positions are redeployed as they are and the wallet is idle
+	assert.Equal(t, s.cfg, c.Config)
+	assert.Equal(t, "600000uosmo", result.Balances.Idle.String())
+	assert.Assert(t, result.Balances.Deployed.Empty())
+}
@@ -0,0 +1,248 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	sdkmath "cosmossdk.io/math"
+	"github.com/cosmos/cosmos-sdk/client"
+	"github.com/cosmos/cosmos-sdk/client/grpc/tmservice"
+	"github.com/cosmos/cosmos-sdk/client/tx"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	gogogrpc "github.com/cosmos/gogoproto/grpc"
+	"github.com/ignite/cli/ignite/pkg/cosmosaccount"
+	"github.com/ignite/cli/ignite/pkg/cosmosclient"
+	clquery "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/client/queryproto"
+	pmquery "github.com/osmosis-labs/osmosis/v21/x/poolmanager/client/queryproto"
+	"go.uber.org/zap"
+
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+
+	"github.com/margined-protocol/flood/internal/fetch"
+	"github.com/margined-protocol/flood/internal/liquidity"
+	"github.com/margined-protocol/flood/internal/power"
+	"github.com/margined-protocol/flood/internal/queries"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+// Querier reads the chain state a cycle needs.
+type Querier interface {
+	LatestBlock(ctx context.Context) (types.Block, error)
+	ConfigAndState(ctx context.Context) (types.GetConfigResponse, types.GetStateResponse, error)
+	SpotPrices(ctx context.Context, config types.GetConfigResponse) (string, string, error)
+	UserPositions(ctx context.Context, pool types.Pool, address string) (*clquery.UserPositionsResponse, error)
+	ConcentratedPool(ctx context.Context, poolID uint64) (types.ConcentratedPool, error)
+	Balance(ctx context.Context, address, denom string) (sdk.Coin, error)
+	Vault(ctx context.Context, vaultID uint64) (types.GetVaultResponse, error)
+	UserVaults(ctx context.Context, owner string) ([]types.UserVault, error)
+	PowerPrices(ctx context.Context, period uint64) (types.PowerPrices, error)
+	EstimateSwap(ctx context.Context, poolID uint64, tokenIn sdk.Coin, outDenom string) (sdkmath.Int, error)
+	DenomMetadata(ctx context.Context, denom string) (banktypes.Metadata, error)
+}
+
+// Endpoints fail over between the nodes answering queries, they are checked
+// before each cycle.
+type Endpoints interface {
+	// Check skips unhealthy or lagging endpoints until the next check
+	Check(ctx context.Context) error
+	// Served returns the endpoints that answered since the last check
+	Served() []string
+}
+
+// Broadcaster signs and sends transactions, it is satisfied by
+// cosmosclient.Client.
+type Broadcaster interface {
+	BroadcastTx(ctx context.Context, account cosmosaccount.Account, msgs ...sdk.Msg) (cosmosclient.Response, error)
+}
+
+// Simulator runs messages against the current chain state without
+// committing them, returning an error if they would fail.
+type Simulator interface {
+	Simulate(ctx context.Context, account cosmosaccount.Account, msgs ...sdk.Msg) error
+}
+
+// Clock returns the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// Strategy decides the messages to send given the market and the positions
+// currently held.
+type Strategy interface {
+	Msgs(l *zap.Logger, cfg *types.Config, market *Market, positions clquery.UserPositionsResponse, address string) ([]sdk.Msg, error)
+}
+
+// Store keeps the results of previous cycles.
+type Store interface {
+	Save(result CycleResult) error
+	// Recent returns up to n results, oldest first
+	Recent(n int) ([]CycleResult, error)
+}
+
+// GRPCQuerier queries the chain over a gRPC connection. Every query is
+// bounded by the timeout and the queries behind ConfigAndState, SpotPrices
+// and PowerPrices are fetched concurrently.
+type GRPCQuerier struct {
+	power      *power.Client
+	pmClient   pmquery.QueryClient
+	clClient   clquery.QueryClient
+	bankClient banktypes.QueryClient
+	tmClient   tmservice.ServiceClient
+	timeout    time.Duration
+}
+
+// NewGRPCQuerier returns a querier for the power contract at the address,
+// fetch.DefaultTimeout bounds each query when the timeout is not positive.
+func NewGRPCQuerier(conn gogogrpc.ClientConn, contractAddress string, timeout time.Duration) *GRPCQuerier {
+	if timeout <= 0 {
+		timeout = fetch.DefaultTimeout
+	}
+
+	return &GRPCQuerier{
+		power:      power.NewClient(wasmtypes.NewQueryClient(conn), contractAddress, timeout),
+		pmClient:   pmquery.NewQueryClient(conn),
+		clClient:   clquery.NewQueryClient(conn),
+		bankClient: banktypes.NewQueryClient(conn),
+		tmClient:   tmservice.NewServiceClient(conn),
+		timeout:    timeout,
+	}
+}
+
+func (q *GRPCQuerier) LatestBlock(ctx context.Context) (types.Block, error) {
+	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	defer cancel()
+	return queries.GetLatestBlock(ctx, q.tmClient)
+}
+
+func (q *GRPCQuerier) ConfigAndState(ctx context.Context) (types.GetConfigResponse, types.GetStateResponse, error) {
+	return q.power.ConfigAndState(ctx)
+}
+
+func (q *GRPCQuerier) SpotPrices(ctx context.Context, config types.GetConfigResponse) (string, string, error) {
+	return queries.GetSpotPrices(ctx, q.pmClient, config, q.timeout)
+}
+
+func (q *GRPCQuerier) UserPositions(ctx context.Context, pool types.Pool, address string) (*clquery.UserPositionsResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	defer cancel()
+	return queries.GetUserPositions(ctx, q.clClient, pool, address)
+}
+
+func (q *GRPCQuerier) ConcentratedPool(ctx context.Context, poolID uint64) (types.ConcentratedPool, error) {
+	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	defer cancel()
+	return queries.GetConcentratedPool(ctx, q.pmClient, poolID)
+}
+
+func (q *GRPCQuerier) Balance(ctx context.Context, address, denom string) (sdk.Coin, error) {
+	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	defer cancel()
+	return queries.GetBalance(ctx, q.bankClient, address, denom)
+}
+
+func (q *GRPCQuerier) Vault(ctx context.Context, vaultID uint64) (types.GetVaultResponse, error) {
+	return q.power.Vault(ctx, vaultID)
+}
+
+func (q *GRPCQuerier) UserVaults(ctx context.Context, owner string) ([]types.UserVault, error) {
+	return q.power.UserVaults(ctx, owner)
+}
+
+func (q *GRPCQuerier) PowerPrices(ctx context.Context, period uint64) (types.PowerPrices, error) {
+	return q.power.Prices(ctx, period)
+}
+
+func (q *GRPCQuerier) AllVaults(ctx context.Context, l *zap.Logger) ([]types.UserVault, error) {
+	return q.power.AllVaults(ctx, l)
+}
+
+func (q *GRPCQuerier) EstimateSwap(ctx context.Context, poolID uint64, tokenIn sdk.Coin, outDenom string) (sdkmath.Int, error) {
+	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	defer cancel()
+	return queries.EstimateSwap(ctx, q.pmClient, poolID, tokenIn, outDenom)
+}
+
+func (q *GRPCQuerier) DenomMetadata(ctx context.Context, denom string) (banktypes.Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	defer cancel()
+	return queries.GetDenomMetadata(ctx, q.bankClient, denom)
+}
+
+// ClientSimulator simulates transactions through the cosmos client context,
+// the same way gas is estimated before broadcasting.
+type ClientSimulator struct {
+	Context client.Context
+}
+
+func (s ClientSimulator) Simulate(_ context.Context, account cosmosaccount.Account, msgs ...sdk.Msg) error {
+	address, err := account.Record.GetAddress()
+	if err != nil {
+		return err
+	}
+
+	clientCtx := s.Context.WithFromName(account.Name).WithFromAddress(address)
+
+	txf, err := tx.Factory{}.
+		WithChainID(clientCtx.ChainID).
+		WithKeybase(clientCtx.Keyring).
+		WithTxConfig(clientCtx.TxConfig).
+		WithAccountRetriever(clientCtx.AccountRetriever).
+		WithSimulateAndExecute(true).
+		Prepare(clientCtx)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = tx.CalculateGas(clientCtx, txf, msgs...)
+	return err
+}
+
+// SystemClock is the wall clock.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time { return time.Now() }
+
+// LiquidityStrategy places a buy and a sell range around the power price and
+// target price in the pool's terms, replacing any positions already held.
+type LiquidityStrategy struct{}
+
+func (LiquidityStrategy) Msgs(l *zap.Logger, cfg *types.Config, market *Market, positions clquery.UserPositionsResponse, address string) ([]sdk.Msg, error) {
+	return liquidity.CreateUpdatePositionMsgs(l, positions, cfg, market.PowerPool(), address, market.PoolPowerPrice(), market.PoolTargetPrice())
+}
+
+// MemoryStore keeps the most recent results in memory.
+type MemoryStore struct {
+	mu      sync.Mutex
+	size    int
+	results []CycleResult
+}
+
+// NewMemoryStore returns a store holding at most size results.
+func NewMemoryStore(size int) *MemoryStore {
+	return &MemoryStore{size: size}
+}
+
+func (s *MemoryStore) Save(result CycleResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.results = append(s.results, result)
+	if s.size > 0 && len(s.results) > s.size {
+		s.results = s.results[len(s.results)-s.size:]
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Recent(n int) ([]CycleResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n <= 0 || n > len(s.results) {
+		n = len(s.results)
+	}
+
+	return append([]CycleResult(nil), s.results[len(s.results)-n:]...), nil
+}
@@ -0,0 +1,641 @@
+// Package engine runs a single market making cycle: it reads the market,
+// asks the strategy for messages and broadcasts them. Every dependency is an
+// interface so the same cycle serves oneshot runs, daemon mode, dry runs
+// and tests.
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/ignite/cli/ignite/pkg/cosmosaccount"
+	clquery "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/client/queryproto"
+	model "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/model"
+	"go.uber.org/zap"
+
+	"github.com/margined-protocol/flood/internal/arbitrage"
+	"github.com/margined-protocol/flood/internal/fetch"
+	"github.com/margined-protocol/flood/internal/hedge"
+	"github.com/margined-protocol/flood/internal/liquidity"
+	"github.com/margined-protocol/flood/internal/maths"
+	"github.com/margined-protocol/flood/internal/notify"
+	"github.com/margined-protocol/flood/internal/power"
+	"github.com/margined-protocol/flood/internal/queries"
+	"github.com/margined-protocol/flood/internal/types"
+	"github.com/margined-protocol/flood/internal/units"
+	"github.com/margined-protocol/flood/internal/vault"
+)
+
+// Decision records what a cycle did.
+type Decision string
+
+const (
+	DecisionRebalanced  Decision = "rebalanced"
+	DecisionDryRun      Decision = "dry run: messages not broadcast"
+	DecisionNoop        Decision = "skipped: nothing to do"
+	DecisionAdminPaused Decision = "skipped: paused by admin"
+	DecisionFailed      Decision = "failed"
+	DecisionWithdrawn   Decision = "withdrew all positions"
+	DecisionArbitraged  Decision = "arbitraged premium"
+)
+
+// Market is the market data derived from a cycle's snapshot. The base spot
+// price is the quote asset per base asset, the power spot price and the
+// target price are power per base asset.
+type Market struct {
+	// Height and BlockTime are the block every price was read at
+	Height              int64                   `json:"height"`
+	BlockTime           time.Time               `json:"block_time"`
+	Config              types.GetConfigResponse `json:"-"`
+	State               types.GetStateResponse  `json:"-"`
+	Power               maths.Power             `json:"-"`
+	BaseSpotPrice       string                  `json:"base_spot_price"`
+	PowerSpotPrice      string                  `json:"power_spot_price"`
+	MarkPrice           float64                 `json:"mark_price"`
+	IndexPrice          float64                 `json:"index_price"`
+	TargetPrice         float64                 `json:"target_price"`
+	Premium             float64                 `json:"premium"`
+	NormalisationFactor string                  `json:"normalisation_factor"`
+	CurrentTick         int64                   `json:"current_tick"`
+	// PoolID is the contract's power pool, Token0 and Token1 are its denoms
+	// and its price is token1 per token0
+	PoolID uint64 `json:"pool_id"`
+	Token0 string `json:"token0"`
+	Token1 string `json:"token1"`
+	// PowerIsToken0 is set when power is the pool's token0
+	PowerIsToken0 bool `json:"power_is_token0"`
+	// Protocol is set when protocol prices are enabled
+	Protocol *ProtocolPrices `json:"protocol,omitempty"`
+	// Spent is paid out by earlier transactions of the cycle, which the
+	// balances read at Height do not include
+	Spent sdk.Coins `json:"spent,omitempty"`
+}
+
+// PoolPowerPrice returns the power spot price as the pool price, token1 per
+// token0, formatted for the strategy. The spot price is power per base asset
+// so it is inverted when power is token0.
+func (m *Market) PoolPowerPrice() string {
+	price, err := strconv.ParseFloat(m.PowerSpotPrice, 64)
+	if err != nil || price == 0 {
+		return ""
+	}
+	return m.poolPrice(price)
+}
+
+// PoolTargetPrice returns the target price as the pool price formatted for
+// the strategy.
+func (m *Market) PoolTargetPrice() string {
+	if m.TargetPrice == 0 {
+		return ""
+	}
+	return m.poolPrice(m.TargetPrice)
+}
+
+// PowerPool returns the power pool at the current tick.
+func (m *Market) PowerPool() types.ConcentratedPool {
+	return types.ConcentratedPool{ID: m.PoolID, Token0: m.Token0, Token1: m.Token1, CurrentTick: m.CurrentTick}
+}
+
+// At returns a context whose queries are answered at the market's height.
+func (m *Market) At(ctx context.Context) context.Context {
+	return queries.AtHeight(ctx, m.Height)
+}
+
+func (m *Market) poolPrice(price float64) string {
+	if m.PowerIsToken0 {
+		return fmt.Sprintf("%f", 1/price)
+	}
+	return fmt.Sprintf("%f", price)
+}
+
+// CycleResult is the outcome of a cycle.
+type CycleResult struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Decision Decision  `json:"decision"`
+	Market   *Market   `json:"market,omitempty"`
+	// Volatility is set when volatility sizing is enabled
+	Volatility *VolatilityEstimate `json:"volatility,omitempty"`
+	// Hedge is set when a hedge trade was sent or planned in a dry run
+	Hedge *hedge.Trade `json:"hedge,omitempty"`
+	// Arbitrage is set when a premium trade was sent or planned in a dry run
+	Arbitrage *arbitrage.Opportunity `json:"arbitrage,omitempty"`
+	// Balances are the wallet balances of the power pool's tokens
+	Balances *Balances `json:"balances,omitempty"`
+	// Vaults is set when the vault manager is enabled
+	Vaults    []vault.Status                `json:"vaults,omitempty"`
+	Positions []model.FullPositionBreakdown `json:"positions"`
+	Msgs      []sdk.Msg                     `json:"-"`
+	TxHash    string                        `json:"tx_hash,omitempty"`
+	Err       error                         `json:"-"`
+	// Endpoints are the gRPC endpoints that served the cycle's queries
+	Endpoints []string `json:"endpoints,omitempty"`
+}
+
+// Cycle holds the dependencies of a market making cycle. Clock, Store,
+// Notifier and Endpoints are optional, Simulator is needed for arbitrage.
+type Cycle struct {
+	Logger  *zap.Logger
+	Config  *types.Config
+	Account cosmosaccount.Account
+	Address string
+
+	Querier     Querier
+	Broadcaster Broadcaster
+	Simulator   Simulator
+	Clock       Clock
+	Strategy    Strategy
+	Store       Store
+	Notifier    notify.Notifier
+	Endpoints   Endpoints
+
+	// DryRun builds the messages without broadcasting them
+	DryRun bool
+
+	// units caches the decimals of denoms across cycles
+	units *units.Registry
+}
+
+// Run executes one cycle. When paused the market is still read but no
+// messages are sent. Failures are reported in the result, Run never exits
+// the process.
+func (c *Cycle) Run(ctx context.Context, paused bool) CycleResult {
+	result := CycleResult{Start: c.now()}
+
+	if err := c.run(ctx, paused, &result); err != nil {
+		result.Decision = DecisionFailed
+		result.Err = err
+	}
+
+	result.Endpoints = c.served()
+	result.End = c.now()
+	c.save(result)
+
+	return result
+}
+
+func (c *Cycle) run(ctx context.Context, paused bool, result *CycleResult) error {
+	l, cfg := c.Logger, c.Config
+
+	// Denom metadata that failed to load is only queried again next cycle
+	c.registry().Retry()
+
+	if err := c.checkEndpoints(ctx); err != nil {
+		return err
+	}
+
+	// Warn if the account paying fees is running low
+	c.checkGasBalance(ctx)
+
+	// Read the chain state once, at a single height
+	snapshot, err := c.snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	powerConfig, powerState := snapshot.Config(), snapshot.State()
+
+	// Positions are only ever managed in the contract's power pool
+	if _, err := power.PoolID(cfg.PowerPool.PoolId, powerConfig); err != nil {
+		return c.fail(ctx, notify.EventCycleFailed, "Power pool mismatch", err)
+	}
+
+	// Let operators know the power contract is paused
+	if powerState.IsPaused {
+		l.Warn("Power contract is paused", zap.String("last_pause", powerState.LastPause))
+		c.send(ctx, notify.Message{
+			Event:    notify.EventPaused,
+			Severity: notify.SeverityWarning,
+			Title:    "Power contract is paused",
+			Fields: map[string]string{
+				"contract":   cfg.PowerPool.ContractAddress,
+				"last_pause": powerState.LastPause,
+			},
+		})
+	}
+
+	market, err := c.readMarket(ctx, snapshot)
+	if err != nil {
+		return err
+	}
+	result.Market = market
+
+	// Keep the bot's vaults away from liquidation, a failure is reported but
+	// liquidity is still managed
+	if cfg.Vaults.Enabled {
+		statuses, err := c.manageVaults(ctx, market, paused)
+		if err != nil {
+			l.Error("Failed to manage vaults", zap.Error(err))
+			c.send(ctx, notify.Message{
+				Event:    notify.EventVault,
+				Severity: notify.SeverityCritical,
+				Title:    "Failed to manage vaults",
+				Text:     err.Error(),
+			})
+		}
+		result.Vaults = statuses
+	}
+
+	// Scale the range widths with recent volatility
+	strategyConfig, estimate, err := c.adaptSpreads(market, result.Start)
+	if err != nil {
+		return c.fail(ctx, notify.EventCycleFailed, "Invalid volatility config", err)
+	}
+	result.Volatility = estimate
+
+	userPositions := clquery.UserPositionsResponse{Positions: snapshot.Positions()}
+	result.Positions = userPositions.Positions
+
+	// Size new positions to the wallet, keeping the gas reserve back
+	strategyConfig, result.Balances, err = c.sizePositions(ctx, strategyConfig, market, userPositions.Positions)
+	if err != nil {
+		return c.fail(ctx, notify.EventCycleFailed, "Failed to size positions", err)
+	}
+
+	// Sanity check computations
+	l.Debug("Summary data",
+		zap.Int64("height", market.Height),
+		zap.Float64("mark_price", market.MarkPrice),
+		zap.Float64("target_price", market.TargetPrice),
+		zap.String("pool_target_price", market.PoolTargetPrice()),
+		zap.String("power_price", market.PowerSpotPrice),
+		zap.String("pool_power_price", market.PoolPowerPrice()),
+		zap.Bool("power_is_token0", market.PowerIsToken0),
+		zap.Float64("premium", market.Premium),
+		zap.String("normalization_factor", market.NormalisationFactor),
+		zap.Int64("current_tick", market.CurrentTick),
+	)
+
+	// Trade a large premium through the power contract, liquidity is placed
+	// on the next cycle once prices have moved
+	if cfg.Arbitrage.Enabled && !paused {
+		opp, err := c.arbitrage(ctx, market, result)
+		if err != nil {
+			return err
+		}
+		if opp != nil {
+			result.Arbitrage = opp
+			return nil
+		}
+	}
+
+	// Leave positions untouched while paused through the admin API
+	if paused {
+		l.Info("Paused, not placing liquidity")
+		result.Decision = DecisionAdminPaused
+		return nil
+	}
+
+	msgs, err := c.Strategy.Msgs(l, strategyConfig, market, userPositions, c.Address)
+	if err != nil {
+		return c.fail(ctx, notify.EventCycleFailed, "Failed to create update position msgs", err)
+	}
+
+	// Keep the base asset delta of the inventory within the band
+	if cfg.Hedge.Enabled {
+		trade, hedgeMsg, err := c.planHedge(ctx, market, userPositions.Positions, msgs, result.Balances)
+		if err != nil {
+			return c.fail(ctx, notify.EventCycleFailed, "Failed to plan hedge", err)
+		}
+		if hedgeMsg != nil {
+			msgs = append(msgs, hedgeMsg)
+			result.Hedge = trade
+		}
+	}
+	result.Msgs = msgs
+
+	if len(msgs) == 0 {
+		result.Decision = DecisionNoop
+		return nil
+	}
+
+	if c.DryRun {
+		l.Info("Dry run, not broadcasting", zap.Reflect("msgs", msgs))
+		result.Decision = DecisionDryRun
+		return nil
+	}
+
+	txResp, err := c.broadcast(ctx, msgs)
+	if err != nil {
+		return c.fail(ctx, notify.EventTxFailed, "Transaction error", err)
+	}
+	txHash := txResp.TxHash
+
+	fields := map[string]string{
+		"tx_hash":      txHash,
+		"current_tick": strconv.FormatInt(market.CurrentTick, 10),
+		"premium":      fmt.Sprintf("%f", market.Premium),
+	}
+
+	if trade := result.Hedge; trade != nil {
+		if !trade.Settle(txResp.Events, market.Config.BasePool.ID) {
+			l.Warn("Hedge swap not found in transaction events", zap.String("tx_hash", txHash))
+		}
+		l.Info("Hedge trade",
+			zap.Float64("delta", trade.Delta),
+			zap.String("token_in", c.describe(ctx, trade.TokenIn)),
+			zap.String("token_out", c.describe(ctx, trade.TokenOut)),
+			zap.Float64("cost", trade.Cost),
+		)
+		fields["hedge"] = fmt.Sprintf("%s for %s", trade.TokenIn, trade.TokenOut)
+	}
+
+	c.send(ctx, notify.Message{
+		Event:    notify.EventRebalanced,
+		Severity: notify.SeverityInfo,
+		Title:    "Rebalanced liquidity",
+		Fields:   fields,
+	})
+
+	result.Decision = DecisionRebalanced
+	result.TxHash = txHash
+
+	return nil
+}
+
+// readMarket derives the mark, index and target prices from the snapshot
+func (c *Cycle) readMarket(ctx context.Context, snapshot *MarketSnapshot) (*Market, error) {
+	powerConfig, powerState := snapshot.Config(), snapshot.State()
+	baseSpotPrice, powerSpotPrice := snapshot.SpotPrices()
+	pool := snapshot.Pool()
+
+	pricing, err := power.Pricing(c.Config.PowerPool.Exponent, powerConfig)
+	if err != nil {
+		return nil, c.fail(ctx, notify.EventCycleFailed, "Invalid power perpetual", err)
+	}
+
+	// Calculate the mark price
+	markPrice, err := pricing.MarkPrice(baseSpotPrice, powerSpotPrice, powerState.NormalisationFactor)
+	if err != nil {
+		return nil, c.fail(ctx, notify.EventCycleFailed, "Failed to calculate mark price", err)
+	}
+
+	// Calcuate the index price
+	indexPrice, err := pricing.IndexPrice(baseSpotPrice)
+	if err != nil {
+		return nil, c.fail(ctx, notify.EventCycleFailed, "Failed to calculate index price", err)
+	}
+
+	// Calculate the target price
+	targetPrice, err := pricing.TargetPrice(baseSpotPrice, powerState.NormalisationFactor)
+	if err != nil {
+		return nil, c.fail(ctx, notify.EventCycleFailed, "Failed to calculate target price", err)
+	}
+
+	if _, err := strconv.ParseFloat(powerSpotPrice, 64); err != nil {
+		return nil, c.fail(ctx, notify.EventCycleFailed, "Failed to parse power spot price", err)
+	}
+
+	// Orient prices and tokens by the order the pool was created in
+	powerIsToken0, err := powerIsToken0(pool, powerConfig)
+	if err != nil {
+		return nil, c.fail(ctx, notify.EventCycleFailed, "Invalid power pool", err)
+	}
+
+	market := &Market{
+		Height:              snapshot.Height(),
+		BlockTime:           snapshot.BlockTime(),
+		Config:              powerConfig,
+		State:               powerState,
+		Power:               pricing,
+		BaseSpotPrice:       baseSpotPrice,
+		PowerSpotPrice:      powerSpotPrice,
+		MarkPrice:           markPrice,
+		IndexPrice:          indexPrice,
+		TargetPrice:         targetPrice,
+		Premium:             maths.CalculatePremium(markPrice, indexPrice),
+		NormalisationFactor: powerState.NormalisationFactor,
+		CurrentTick:         pool.CurrentTick,
+		PoolID:              pool.ID,
+		Token0:              pool.Token0,
+		Token1:              pool.Token1,
+		PowerIsToken0:       powerIsToken0,
+	}
+
+	// Cross check against the prices the protocol uses for funding
+	if c.Config.ProtocolPrices.Enabled {
+		if err := c.checkProtocolPrices(snapshot.At(ctx), market); err != nil {
+			return nil, err
+		}
+	}
+
+	return market, nil
+}
+
+// CheckPowerPool verifies at startup that the pool ID in the config, if
+// any, is the power contract's pool and returns the pool ID.
+func (c *Cycle) CheckPowerPool(ctx context.Context) (uint64, error) {
+	powerConfig, _, err := c.Querier.ConfigAndState(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get config and state: %w", err)
+	}
+	return power.PoolID(c.Config.PowerPool.PoolId, powerConfig)
+}
+
+// powerIsToken0 reports whether power is the pool's token0, the pool must
+// hold power and the base asset
+func powerIsToken0(pool types.ConcentratedPool, config types.GetConfigResponse) (bool, error) {
+	power, base, err := config.PowerDenoms()
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case pool.Token0 == power && pool.Token1 == base:
+		return true, nil
+	case pool.Token0 == base && pool.Token1 == power:
+		return false, nil
+	default:
+		return false, fmt.Errorf("pool %d holds %s/%s, not %s and %s", pool.ID, pool.Token0, pool.Token1, power, base)
+	}
+}
+
+// WithdrawAll withdraws every position held in the power pool.
+func (c *Cycle) WithdrawAll(ctx context.Context) CycleResult {
+	result := CycleResult{Start: c.now()}
+
+	err := func() error {
+		if err := c.checkEndpoints(ctx); err != nil {
+			return err
+		}
+
+		powerConfig, _, err := c.Querier.ConfigAndState(ctx)
+		if err != nil {
+			return c.fail(ctx, notify.EventQueryFailed, "Failed to get config and state", err)
+		}
+		if _, err := power.PoolID(c.Config.PowerPool.PoolId, powerConfig); err != nil {
+			return c.fail(ctx, notify.EventCycleFailed, "Power pool mismatch", err)
+		}
+
+		userPositions, err := c.Querier.UserPositions(ctx, powerConfig.PowerPool, c.Address)
+		if err != nil {
+			return c.fail(ctx, notify.EventQueryFailed, "Failed to find user positions", err)
+		}
+
+		if len(userPositions.Positions) == 0 {
+			return errors.New("no positions to withdraw")
+		}
+
+		result.Msgs = liquidity.RemovePreviousPositions(c.Logger, userPositions.Positions)
+
+		txResp, err := c.broadcast(ctx, result.Msgs)
+		if err != nil {
+			return c.fail(ctx, notify.EventTxFailed, "Withdraw all transaction error", err)
+		}
+		txHash := txResp.TxHash
+
+		c.send(ctx, notify.Message{
+			Event:    notify.EventRebalanced,
+			Severity: notify.SeverityWarning,
+			Title:    "Withdrew all positions",
+			Fields:   map[string]string{"tx_hash": txHash},
+		})
+
+		result.Decision = DecisionWithdrawn
+		result.TxHash = txHash
+
+		return nil
+	}()
+	if err != nil {
+		result.Decision = DecisionFailed
+		result.Err = err
+	}
+
+	result.Endpoints = c.served()
+	result.End = c.now()
+	c.save(result)
+
+	return result
+}
+
+// checkEndpoints health checks the endpoints so the cycle is served by a
+// synced node.
+func (c *Cycle) checkEndpoints(ctx context.Context) error {
+	if c.Endpoints == nil {
+		return nil
+	}
+
+	if err := c.Endpoints.Check(ctx); err != nil {
+		return c.fail(ctx, notify.EventQueryFailed, "No healthy endpoint", err)
+	}
+
+	return nil
+}
+
+func (c *Cycle) served() []string {
+	if c.Endpoints == nil {
+		return nil
+	}
+	return c.Endpoints.Served()
+}
+
+func (c *Cycle) broadcast(ctx context.Context, msgs []sdk.Msg) (*sdk.TxResponse, error) {
+	txResp, err := c.Broadcaster.BroadcastTx(ctx, c.Account, msgs...)
+	if err != nil {
+		return nil, err
+	}
+	if txResp.TxResponse == nil {
+		return nil, errors.New("empty transaction response")
+	}
+
+	c.Logger.Debug("tx response",
+		zap.String("transaction hash", txResp.TxHash),
+	)
+
+	return txResp.TxResponse, nil
+}
+
+// checkGasBalance alerts if the account paying fees holds less of the fee
+// denom than the configured threshold
+func (c *Cycle) checkGasBalance(ctx context.Context) {
+	cfg := c.Config
+	if cfg.Notifier.LowGasThreshold.Value() == "0" {
+		return
+	}
+
+	fees, err := sdk.ParseCoinsNormalized(cfg.Fees)
+	if err != nil || fees.Empty() {
+		c.Logger.Warn("Unable to determine fee denom", zap.Error(err))
+		return
+	}
+
+	threshold, err := c.registry().Coin(ctx, fees[0].Denom, cfg.Notifier.LowGasThreshold)
+	if err != nil {
+		c.Logger.Warn("Invalid low_gas_threshold", zap.Error(err))
+		return
+	}
+
+	payer := c.Address
+	if cfg.FeeGranter != "" {
+		payer = cfg.FeeGranter
+	}
+
+	balance, err := c.Querier.Balance(ctx, payer, fees[0].Denom)
+	if err != nil {
+		c.Logger.Warn("Failed to fetch gas balance", zap.Error(err))
+		return
+	}
+
+	if balance.Amount.LT(threshold.Amount) {
+		c.Logger.Warn("Low gas balance", zap.String("payer", payer), zap.String("balance", c.describe(ctx, balance)))
+		c.send(ctx, notify.Message{
+			Event:    notify.EventLowGas,
+			Severity: notify.SeverityWarning,
+			Title:    "Low gas balance",
+			Fields: map[string]string{
+				"payer":     payer,
+				"balance":   balance.String(),
+				"threshold": threshold.String(),
+			},
+		})
+	}
+}
+
+// send forwards a message to the notifier, delivery failures are logged but
+// never stop the cycle
+func (c *Cycle) send(ctx context.Context, msg notify.Message) {
+	if c.Notifier == nil {
+		return
+	}
+	if err := c.Notifier.Notify(ctx, msg); err != nil {
+		c.Logger.Warn("Failed to send notification", zap.Error(err))
+	}
+}
+
+// fail sends a critical alert and returns the error annotated with the title
+func (c *Cycle) fail(ctx context.Context, event notify.Event, title string, err error) error {
+	c.send(ctx, notify.Message{
+		Event:    event,
+		Severity: notify.SeverityCritical,
+		Title:    title,
+		Text:     err.Error(),
+	})
+	return fmt.Errorf("%s: %w", title, err)
+}
+
+func (c *Cycle) now() time.Time {
+	if c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock.Now()
+}
+
+// queryTimeout bounds each query of a concurrent fetch
+func (c *Cycle) queryTimeout() time.Duration {
+	if c.Config.Endpoints.QueryTimeout > 0 {
+		return c.Config.Endpoints.QueryTimeout
+	}
+	return fetch.DefaultTimeout
+}
+
+func (c *Cycle) save(result CycleResult) {
+	if c.Store == nil {
+		return
+	}
+	if err := c.Store.Save(result); err != nil {
+		c.Logger.Warn("Failed to save cycle result", zap.Error(err))
+	}
+}
@@ -0,0 +1,319 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sdkmath "cosmossdk.io/math"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/ignite/cli/ignite/pkg/cosmosaccount"
+	"github.com/ignite/cli/ignite/pkg/cosmosclient"
+	clquery "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/client/queryproto"
+	model "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/model"
+	cltypes "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/types"
+	"go.uber.org/zap"
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/notify"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+type fakeQuerier struct {
+	block      types.Block
+	state      types.GetStateResponse
+	basePrice  string
+	powerPrice string
+	positions  []model.FullPositionBreakdown
+	vault      types.GetVaultResponse
+	vaults     []types.UserVault
+	balances   map[string]int64
+	prices     types.PowerPrices
+	metadata   map[string]banktypes.Metadata
+	// powerIsToken0 serves a power pool created with power as token0
+	powerIsToken0 bool
+	// rate converts swaps at a fixed price when estimating
+	rate float64
+	err  error
+}
+
+func (q *fakeQuerier) LatestBlock(context.Context) (types.Block, error) {
+	return q.block, nil
+}
+
+func (q *fakeQuerier) ConfigAndState(context.Context) (types.GetConfigResponse, types.GetStateResponse, error) {
+	return types.GetConfigResponse{
+		PowerAsset: types.Asset{Denom: "usqosmo"},
+		BaseAsset:  types.Asset{Denom: "uosmo"},
+		BasePool:   types.Pool{ID: 1, BaseDenom: "uosmo", QuoteDenom: "uusdc"},
+		PowerPool:  types.Pool{ID: 2, BaseDenom: "usqosmo", QuoteDenom: "uosmo"},
+		IndexScale: types.NewUint(10000),
+	}, q.state, q.err
+}
+
+func (q *fakeQuerier) SpotPrices(context.Context, types.GetConfigResponse) (string, string, error) {
+	if q.powerPrice == "" {
+		return q.basePrice, "1000", nil
+	}
+	return q.basePrice, q.powerPrice, nil
+}
+
+func (q *fakeQuerier) UserPositions(context.Context, types.Pool, string) (*clquery.UserPositionsResponse, error) {
+	return &clquery.UserPositionsResponse{Positions: q.positions}, nil
+}
+
+func (q *fakeQuerier) ConcentratedPool(_ context.Context, poolID uint64) (types.ConcentratedPool, error) {
+	if q.powerIsToken0 {
+		return types.ConcentratedPool{ID: poolID, Token0: "usqosmo", Token1: "uosmo", CurrentTick: -27000000}, nil
+	}
+	return types.ConcentratedPool{ID: poolID, Token0: "uosmo", Token1: "usqosmo", CurrentTick: 27000000}, nil
+}
+
+func (q *fakeQuerier) Balance(_ context.Context, _ string, denom string) (sdk.Coin, error) {
+	return sdk.NewInt64Coin(denom, q.balances[denom]), nil
+}
+
+func (q *fakeQuerier) Vault(context.Context, uint64) (types.GetVaultResponse, error) {
+	return q.vault, nil
+}
+
+func (q *fakeQuerier) UserVaults(context.Context, string) ([]types.UserVault, error) {
+	return q.vaults, nil
+}
+
+func (q *fakeQuerier) PowerPrices(context.Context, uint64) (types.PowerPrices, error) {
+	return q.prices, nil
+}
+
+func (q *fakeQuerier) EstimateSwap(_ context.Context, _ uint64, tokenIn sdk.Coin, _ string) (sdkmath.Int, error) {
+	return sdkmath.NewInt(int64(float64(tokenIn.Amount.Int64()) * q.rate)), nil
+}
+
+func (q *fakeQuerier) DenomMetadata(_ context.Context, denom string) (banktypes.Metadata, error) {
+	metadata, ok := q.metadata[denom]
+	if !ok {
+		return banktypes.Metadata{}, errors.New("denom metadata not found")
+	}
+	return metadata, nil
+}
+
+type fakeSimulator struct {
+	calls [][]sdk.Msg
+	err   error
+}
+
+func (s *fakeSimulator) Simulate(_ context.Context, _ cosmosaccount.Account, msgs ...sdk.Msg) error {
+	s.calls = append(s.calls, msgs)
+	return s.err
+}
+
+type fakeBroadcaster struct {
+	sent [][]sdk.Msg
+	err  error
+}
+
+func (b *fakeBroadcaster) BroadcastTx(_ context.Context, _ cosmosaccount.Account, msgs ...sdk.Msg) (cosmosclient.Response, error) {
+	if b.err != nil {
+		return cosmosclient.Response{}, b.err
+	}
+	b.sent = append(b.sent, msgs)
+	return cosmosclient.Response{TxResponse: &sdk.TxResponse{TxHash: "HASH"}}, nil
+}
+
+type fakeStrategy struct {
+	cfg    *types.Config
+	market *Market
+	err    error
+}
+
+func (s *fakeStrategy) Msgs(_ *zap.Logger, cfg *types.Config, market *Market, _ clquery.UserPositionsResponse, address string) ([]sdk.Msg, error) {
+	s.cfg, s.market = cfg, market
+	return []sdk.Msg{&cltypes.MsgCreatePosition{Sender: address}}, s.err
+}
+
+type fakeEndpoints struct {
+	checks int
+	err    error
+	served []string
+}
+
+func (e *fakeEndpoints) Check(context.Context) error {
+	e.checks++
+	return e.err
+}
+
+func (e *fakeEndpoints) Served() []string { return e.served }
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func newCycle() (*Cycle, *fakeQuerier, *fakeBroadcaster, *fakeStrategy, *MemoryStore) {
+	q := &fakeQuerier{state: types.GetStateResponse{NormalisationFactor: "1"}, basePrice: "10"}
+	b := &fakeBroadcaster{}
+	s := &fakeStrategy{}
+	store := NewMemoryStore(2)
+
+	return &Cycle{
+		Logger:      zap.NewNop(),
+		Config:      &types.Config{Fees: "10000uosmo"},
+		Address:     "osmo1bot",
+		Querier:     q,
+		Broadcaster: b,
+		Clock:       fixedClock(time.Unix(1700000000, 0)),
+		Strategy:    s,
+		Store:       store,
+	}, q, b, s, store
+}
+
+func TestRunRebalances(t *testing.T) {
+	c, _, b, s, store := newCycle()
+
+	result := c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+	assert.Equal(t, DecisionRebalanced, result.Decision)
+	assert.Equal(t, "HASH", result.TxHash)
+	assert.Equal(t, 1, len(b.sent))
+	assert.Equal(t, time.Unix(1700000000, 0), result.Start)
+
+	// mark = 10 / 1000 * 10000 = 100 = index
+	assert.Equal(t, 100.0, s.market.MarkPrice)
+	assert.Equal(t, 0.0, s.market.Premium)
+	assert.Equal(t, "1000.000000", s.market.PoolTargetPrice())
+	assert.Equal(t, "1000.000000", s.market.PoolPowerPrice())
+
+	saved, err := store.Recent(0)
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(saved))
+	assert.Equal(t, DecisionRebalanced, saved[0].Decision)
+}
+
+func TestRunOrientsPricesToThePool(t *testing.T) {
+	c, q, _, s, _ := newCycle()
+
+	// With power as token0 the pool price is the base asset per power
+	q.powerIsToken0 = true
+	result := c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+	assert.Assert(t, s.market.PowerIsToken0)
+	assert.Equal(t, "usqosmo", s.market.Token0)
+	assert.Equal(t, "0.001000", s.market.PoolTargetPrice())
+	assert.Equal(t, "0.001000", s.market.PoolPowerPrice())
+}
+
+func TestRunRejectsOtherPowerPool(t *testing.T) {
+	c, _, b, _, _ := newCycle()
+	ctx := context.Background()
+
+	id, err := c.CheckPowerPool(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, uint64(2), id)
+
+	c.Config.PowerPool.PoolId = 3
+	_, err = c.CheckPowerPool(ctx)
+	assert.ErrorContains(t, err, "configured pool_id 3 is not the power contract's pool 2")
+
+	result := c.Run(ctx, false)
+	assert.ErrorContains(t, result.Err, "Power pool mismatch")
+	assert.Equal(t, 0, len(b.sent))
+
+	result = c.WithdrawAll(ctx)
+	assert.ErrorContains(t, result.Err, "Power pool mismatch")
+}
+
+func TestRunDryRunAndPause(t *testing.T) {
+	c, _, b, _, _ := newCycle()
+
+	c.DryRun = true
+	result := c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+	assert.Equal(t, DecisionDryRun, result.Decision)
+	assert.Equal(t, 1, len(result.Msgs))
+	assert.Equal(t, 0, len(b.sent))
+
+	result = c.Run(context.Background(), true)
+	assert.Equal(t, DecisionAdminPaused, result.Decision)
+	assert.Equal(t, 0, len(result.Msgs))
+}
+
+func TestRunReturnsFailures(t *testing.T) {
+	c, q, b, s, store := newCycle()
+	ctx := context.Background()
+
+	q.err = errors.New("node down")
+	result := c.Run(ctx, false)
+	assert.Equal(t, DecisionFailed, result.Decision)
+	assert.ErrorContains(t, result.Err, "Failed to get config and state: node down")
+	assert.Assert(t, result.Market == nil)
+
+	q.err = nil
+	s.err = errors.New("ticks are in the incorrect order")
+	result = c.Run(ctx, false)
+	assert.Equal(t, DecisionFailed, result.Decision)
+	assert.ErrorContains(t, result.Err, "incorrect order")
+	assert.Assert(t, result.Market != nil)
+
+	s.err = nil
+	b.err = errors.New("out of gas")
+	result = c.Run(ctx, false)
+	assert.ErrorContains(t, result.Err, "Transaction error: out of gas")
+
+	// The store only keeps the last two results
+	saved, err := store.Recent(5)
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(saved))
+	assert.ErrorContains(t, saved[1].Err, "out of gas")
+}
+
+func TestRunRecordsEndpoints(t *testing.T) {
+	c, _, b, _, store := newCycle()
+	e := &fakeEndpoints{served: []string{"https://grpc.osmosis.zone"}}
+	c.Endpoints = e
+	ctx := context.Background()
+
+	result := c.Run(ctx, false)
+	assert.NilError(t, result.Err)
+	assert.Equal(t, 1, e.checks)
+	assert.DeepEqual(t, []string{"https://grpc.osmosis.zone"}, result.Endpoints)
+
+	saved, err := store.Recent(1)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, result.Endpoints, saved[0].Endpoints)
+
+	e.err = errors.New("no healthy gRPC endpoint")
+	result = c.Run(ctx, false)
+	assert.Equal(t, DecisionFailed, result.Decision)
+	assert.ErrorContains(t, result.Err, "No healthy endpoint: no healthy gRPC endpoint")
+	assert.Equal(t, 1, len(b.sent))
+}
+
+func TestRunAlertsWhenContractPaused(t *testing.T) {
+	c, q, b, _, _ := newCycle()
+	n := &recordingNotifier{}
+	c.Notifier = n
+	q.state.IsPaused = true
+
+	// Liquidity in the pool is still managed
+	result := c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+	assert.Equal(t, DecisionRebalanced, result.Decision)
+	assert.Equal(t, 1, len(b.sent))
+
+	assert.Equal(t, notify.EventPaused, n.msgs[0].Event)
+	assert.Equal(t, notify.SeverityWarning, n.msgs[0].Severity)
+}
+
+func TestWithdrawAll(t *testing.T) {
+	c, q, b, _, _ := newCycle()
+
+	result := c.WithdrawAll(context.Background())
+	assert.ErrorContains(t, result.Err, "no positions to withdraw")
+
+	q.positions = []model.FullPositionBreakdown{{Position: model.Position{PositionId: 7, Address: "osmo1bot"}}}
+	result = c.WithdrawAll(context.Background())
+	assert.NilError(t, result.Err)
+	assert.Equal(t, DecisionWithdrawn, result.Decision)
+	assert.Equal(t, uint64(7), b.sent[0][0].(*cltypes.MsgWithdrawPosition).PositionId)
+}
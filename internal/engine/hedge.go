@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	model "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/model"
+	"go.uber.org/zap"
+
+	"github.com/margined-protocol/flood/internal/hedge"
+)
+
+// planHedge measures the base asset delta of the positions and idle balances
+// after msgs execute and returns a base pool trade if it is outside the band.
+// The trade only spends what is left idle once the new positions in b and
+// the gas reserve are taken out, as it goes in the same transaction.
+func (c *Cycle) planHedge(ctx context.Context, market *Market, positions []model.FullPositionBreakdown, msgs []sdk.Msg, b *Balances) (*hedge.Trade, sdk.Msg, error) {
+	powerDenom, baseDenom, err := market.Config.PowerDenoms()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	denoms := []string{baseDenom, powerDenom}
+	if quote := market.Config.BasePool.QuoteDenom; quote != baseDenom && quote != powerDenom {
+		denoms = append(denoms, quote)
+	}
+
+	balances, err := c.walletBalances(ctx, market, denoms...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch balances: %w", err)
+	}
+
+	idle := sdk.NewCoins()
+	for _, coin := range balances {
+		amount := coin.Amount.Sub(b.Deployed.AmountOf(coin.Denom))
+		if b.Reserve.Denom == coin.Denom {
+			amount = amount.Sub(b.Reserve.Amount)
+		}
+		if amount.IsPositive() {
+			idle = idle.Add(sdk.NewCoin(coin.Denom, amount))
+		}
+	}
+
+	powerDelta, err := market.Power.PowerDelta(market.BaseSpotPrice, market.NormalisationFactor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The target, band and max trade are amounts of the base asset
+	cfg := c.Config.Hedge
+	if err := c.rawAmounts(ctx, baseDenom, &cfg.Target, &cfg.Band, &cfg.MaxTrade); err != nil {
+		return nil, nil, fmt.Errorf("invalid hedge amounts: %w", err)
+	}
+
+	inventory := hedge.Inventory(positions, balances, msgs)
+	delta := hedge.Delta(inventory, baseDenom, powerDenom, powerDelta)
+
+	c.Logger.Info("Inventory delta",
+		zap.Float64("delta", delta),
+		zap.String("target", cfg.Target.Value()),
+		zap.String("band", cfg.Band.Value()),
+		zap.String("inventory", inventory.String()),
+		zap.String("idle", idle.String()),
+	)
+
+	return hedge.Plan(cfg, market.Config.BasePool, market.BaseSpotPrice, delta, idle, c.Address)
+}
@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/margined-protocol/flood/internal/maths"
+	"github.com/margined-protocol/flood/internal/notify"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+// defaultMaxDeviation is the relative difference between protocol and local
+// prices tolerated without an alert
+const defaultMaxDeviation = "0.02"
+
+// ProtocolPrices are the index and mark reported by the power contract and
+// their relative difference from the local calculations.
+type ProtocolPrices struct {
+	IndexPrice float64 `json:"index_price"`
+	IndexTwap  float64 `json:"index_twap"`
+	MarkPrice  float64 `json:"mark_price"`
+	// MarkTwap is the mark used for funding
+	MarkTwap float64 `json:"mark_twap"`
+	Premium  float64 `json:"premium"`
+	// IndexDeviation and MarkDeviation are (protocol - local) / local
+	IndexDeviation float64 `json:"index_deviation"`
+	MarkDeviation  float64 `json:"mark_deviation"`
+}
+
+// checkProtocolPrices queries the protocol's index and mark and compares
+// them with the local prices, alerting if either deviates by more than the
+// configured maximum. With use_protocol the market is priced from the
+// protocol's values.
+func (c *Cycle) checkProtocolPrices(ctx context.Context, market *Market) error {
+	l, cfg := c.Logger, c.Config.ProtocolPrices
+
+	maxDeviation, err := strconv.ParseFloat(types.OrDefault(cfg.MaxDeviation, defaultMaxDeviation), 64)
+	if err != nil {
+		return c.fail(ctx, notify.EventCycleFailed, "Invalid protocol prices config", fmt.Errorf("invalid max deviation: %w", err))
+	}
+
+	raw, err := c.Querier.PowerPrices(ctx, uint64(cfg.TwapPeriod.Seconds()))
+	if err != nil {
+		return c.fail(ctx, notify.EventQueryFailed, "Failed to get protocol prices", err)
+	}
+
+	var p ProtocolPrices
+	for _, v := range []struct {
+		name  string
+		value string
+		out   *float64
+	}{
+		{"index", raw.Index, &p.IndexPrice},
+		{"index twap", raw.IndexTwap, &p.IndexTwap},
+		{"mark", raw.Mark, &p.MarkPrice},
+		{"mark twap", raw.MarkTwap, &p.MarkTwap},
+	} {
+		if *v.out, err = strconv.ParseFloat(v.value, 64); err != nil {
+			return c.fail(ctx, notify.EventCycleFailed, "Failed to parse protocol prices", fmt.Errorf("invalid %s: %w", v.name, err))
+		}
+	}
+
+	p.Premium = maths.CalculatePremium(p.MarkPrice, p.IndexPrice)
+	p.IndexDeviation = deviation(p.IndexPrice, market.IndexPrice)
+	p.MarkDeviation = deviation(p.MarkPrice, market.MarkPrice)
+	market.Protocol = &p
+
+	l.Info("Protocol prices",
+		zap.Float64("index_price", p.IndexPrice),
+		zap.Float64("local_index_price", market.IndexPrice),
+		zap.Float64("index_deviation", p.IndexDeviation),
+		zap.Float64("mark_price", p.MarkPrice),
+		zap.Float64("local_mark_price", market.MarkPrice),
+		zap.Float64("mark_deviation", p.MarkDeviation),
+		zap.Float64("index_twap", p.IndexTwap),
+		zap.Float64("mark_twap", p.MarkTwap),
+	)
+
+	if math.Abs(p.IndexDeviation) > maxDeviation || math.Abs(p.MarkDeviation) > maxDeviation {
+		l.Warn("Protocol prices deviate from local prices", zap.Float64("max_deviation", maxDeviation))
+		c.send(ctx, notify.Message{
+			Event:    notify.EventPriceDeviation,
+			Severity: notify.SeverityWarning,
+			Title:    "Protocol prices deviate from local prices",
+			Fields: map[string]string{
+				"index_price":       fmt.Sprintf("%f", p.IndexPrice),
+				"local_index_price": fmt.Sprintf("%f", market.IndexPrice),
+				"mark_price":        fmt.Sprintf("%f", p.MarkPrice),
+				"local_mark_price":  fmt.Sprintf("%f", market.MarkPrice),
+				"max_deviation":     fmt.Sprintf("%f", maxDeviation),
+			},
+		})
+	}
+
+	if cfg.UseProtocol {
+		market.IndexPrice = p.IndexPrice
+		market.MarkPrice = p.MarkPrice
+		market.Premium = p.Premium
+	}
+
+	return nil
+}
+
+// deviation returns the relative difference of value from reference
+func deviation(value, reference float64) float64 {
+	if reference == 0 {
+		return 0
+	}
+	return (value - reference) / reference
+}
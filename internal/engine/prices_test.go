@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/notify"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+type recordingNotifier struct {
+	msgs []notify.Message
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, msg notify.Message) error {
+	n.msgs = append(n.msgs, msg)
+	return nil
+}
+
+func TestRunChecksProtocolPrices(t *testing.T) {
+	c, q, _, s, _ := newCycle()
+	n := &recordingNotifier{}
+	c.Notifier = n
+	c.Config.ProtocolPrices = types.ProtocolPrices{Enabled: true, TwapPeriod: time.Hour}
+
+	// Locally the mark and index are both 100
+	q.prices = types.PowerPrices{Index: "100.5", IndexTwap: "99", Mark: "104", MarkTwap: "103"}
+
+	result := c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+
+	p := result.Market.Protocol
+	assert.Equal(t, 100.5, p.IndexPrice)
+	assert.Equal(t, 103.0, p.MarkTwap)
+	assert.Assert(t, p.IndexDeviation > 0.0049 && p.IndexDeviation < 0.0051)
+	assert.Assert(t, p.MarkDeviation > 0.0399 && p.MarkDeviation < 0.0401)
+
+	// The mark is 4% away, beyond the default 2%, before the rebalance
+	assert.Equal(t, 2, len(n.msgs))
+	assert.Equal(t, notify.EventPriceDeviation, n.msgs[0].Event)
+	assert.Equal(t, notify.EventRebalanced, n.msgs[1].Event)
+
+	// The local prices are still used
+	assert.Equal(t, 0.0, s.market.Premium)
+}
+
+func TestRunUsesProtocolPrices(t *testing.T) {
+	c, q, _, s, _ := newCycle()
+	c.Config.ProtocolPrices = types.ProtocolPrices{Enabled: true, UseProtocol: true, MaxDeviation: "0.05"}
+	q.prices = types.PowerPrices{Index: "100", IndexTwap: "100", Mark: "104", MarkTwap: "104"}
+
+	result := c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+	assert.Equal(t, 104.0, s.market.MarkPrice)
+	assert.Assert(t, s.market.Premium > 0.0399 && s.market.Premium < 0.0401)
+
+	q.prices.Mark = "not a number"
+	result = c.Run(context.Background(), false)
+	assert.ErrorContains(t, result.Err, "invalid mark")
+}
@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	clquery "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/client/queryproto"
+	model "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/model"
+
+	"github.com/margined-protocol/flood/internal/fetch"
+	"github.com/margined-protocol/flood/internal/notify"
+	"github.com/margined-protocol/flood/internal/queries"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+// MarketSnapshot is the chain state a cycle starts from. Every query is
+// answered at the same block so the contract state, prices, pool and
+// positions agree. It is read through methods and never changed once taken.
+//
+// The cycle's later reads, the wallet balances, vaults and swap estimates,
+// are pinned to the same height through Market.At. The gas balance check
+// runs before the snapshot and denom metadata does not change between
+// blocks, so both are read at the latest height, as are the simulation and
+// broadcast of transactions, which execute on the latest state.
+type MarketSnapshot struct {
+	block          types.Block
+	config         types.GetConfigResponse
+	state          types.GetStateResponse
+	baseSpotPrice  string
+	powerSpotPrice string
+	pool           types.ConcentratedPool
+	positions      []model.FullPositionBreakdown
+}
+
+// Height is the block the snapshot was read at.
+func (s *MarketSnapshot) Height() int64 { return s.block.Height }
+
+// BlockTime is the time of the snapshot's block.
+func (s *MarketSnapshot) BlockTime() time.Time { return s.block.Time }
+
+// Config is the power contract config.
+func (s *MarketSnapshot) Config() types.GetConfigResponse { return s.config }
+
+// State is the power contract state.
+func (s *MarketSnapshot) State() types.GetStateResponse { return s.state }
+
+// SpotPrices are the base and power spot prices.
+func (s *MarketSnapshot) SpotPrices() (string, string) {
+	return s.baseSpotPrice, s.powerSpotPrice
+}
+
+// Pool is the power pool.
+func (s *MarketSnapshot) Pool() types.ConcentratedPool { return s.pool }
+
+// Positions returns a copy of the bot's positions in the power pool.
+func (s *MarketSnapshot) Positions() []model.FullPositionBreakdown {
+	return append([]model.FullPositionBreakdown(nil), s.positions...)
+}
+
+// At returns a context whose queries are answered at the snapshot's height.
+func (s *MarketSnapshot) At(ctx context.Context) context.Context {
+	return queries.AtHeight(ctx, s.block.Height)
+}
+
+// snapshotFailures titles the alert by the first snapshot query that failed
+var snapshotFailures = map[string]string{
+	"spot prices":    "Failed to fetch spot prices",
+	"power pool":     "Failed to get power pool",
+	"user positions": "Failed to find user positions",
+}
+
+// snapshot fetches the latest height once and reads the power contract,
+// spot prices, power pool and positions at that height
+func (c *Cycle) snapshot(ctx context.Context) (*MarketSnapshot, error) {
+	block, err := c.Querier.LatestBlock(ctx)
+	if err != nil {
+		return nil, c.fail(ctx, notify.EventQueryFailed, "Failed to get latest block", err)
+	}
+
+	s := &MarketSnapshot{block: block}
+	at := s.At(ctx)
+
+	// Get the power config and state
+	s.config, s.state, err = c.Querier.ConfigAndState(at)
+	if err != nil {
+		return nil, c.fail(ctx, notify.EventQueryFailed, "Failed to get config and state", err)
+	}
+
+	// The rest only depends on the config so it is read concurrently
+	var userPositions *clquery.UserPositionsResponse
+	err = fetch.All(at, c.queryTimeout(),
+		fetch.Query{Name: "spot prices", Run: func(ctx context.Context) (err error) {
+			s.baseSpotPrice, s.powerSpotPrice, err = c.Querier.SpotPrices(ctx, s.config)
+			return err
+		}},
+		fetch.Query{Name: "power pool", Run: func(ctx context.Context) (err error) {
+			s.pool, err = c.Querier.ConcentratedPool(ctx, s.config.PowerPool.ID)
+			return err
+		}},
+		fetch.Query{Name: "user positions", Run: func(ctx context.Context) (err error) {
+			userPositions, err = c.Querier.UserPositions(ctx, s.config.PowerPool, c.Address)
+			return err
+		}},
+	)
+	if err != nil {
+		query, _ := fetch.Failed(err)
+		return nil, c.fail(ctx, notify.EventQueryFailed, snapshotFailures[query], err)
+	}
+	s.positions = userPositions.Positions
+
+	return s, nil
+}
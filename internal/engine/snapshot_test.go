@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	model "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/model"
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+func TestRunTagsMarketWithSnapshotBlock(t *testing.T) {
+	c, q, _, s, _ := newCycle()
+	blockTime := time.Unix(1699999990, 0).UTC()
+	q.block = types.Block{Height: 1234, Time: blockTime}
+
+	result := c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+	assert.Equal(t, int64(1234), result.Market.Height)
+	assert.Equal(t, blockTime, result.Market.BlockTime)
+	assert.Equal(t, int64(1234), s.market.Height)
+}
+
+func TestSnapshotIsReadAtOneHeight(t *testing.T) {
+	c, q, _, _, _ := newCycle()
+	q.block = types.Block{Height: 42}
+	q.positions = []model.FullPositionBreakdown{{Position: model.Position{PositionId: 7}}}
+
+	snapshot, err := c.snapshot(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, int64(42), snapshot.Height())
+	assert.Equal(t, uint64(2), snapshot.Pool().ID)
+
+	base, power := snapshot.SpotPrices()
+	assert.Equal(t, "10", base)
+	assert.Equal(t, "1000", power)
+
+	// Callers get a copy of the positions
+	positions := snapshot.Positions()
+	positions[0].Position.PositionId = 8
+	assert.Equal(t, uint64(7), snapshot.Positions()[0].Position.PositionId)
+}
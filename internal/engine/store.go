@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileStore keeps the most recent results in a JSON file so history
+// survives between oneshot runs. Messages and errors are not persisted.
+type FileStore struct {
+	mu      sync.Mutex
+	path    string
+	size    int
+	results []CycleResult
+}
+
+// NewFileStore loads any results already saved at the path.
+func NewFileStore(path string, size int) (*FileStore, error) {
+	s := &FileStore{path: path, size: size}
+
+	bz, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(bz, &s.results); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) Save(result CycleResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.results = append(s.results, result)
+	if s.size > 0 && len(s.results) > s.size {
+		s.results = s.results[len(s.results)-s.size:]
+	}
+
+	bz, err := json.Marshal(s.results)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves it truncated
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(bz); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (s *FileStore) Recent(n int) ([]CycleResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n <= 0 || n > len(s.results) {
+		n = len(s.results)
+	}
+
+	return append([]CycleResult(nil), s.results[len(s.results)-n:]...), nil
+}
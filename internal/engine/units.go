@@ -0,0 +1,36 @@
+package engine
+
+import (
+	"context"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+
+	"github.com/margined-protocol/flood/internal/types"
+	"github.com/margined-protocol/flood/internal/units"
+)
+
+// registry returns the decimals of denoms from the config, falling back to
+// the bank module's denom metadata
+func (c *Cycle) registry() *units.Registry {
+	if c.units == nil {
+		c.units = units.NewRegistry(c.Config.Assets, c.Querier)
+	}
+	return c.units
+}
+
+// rawAmounts converts config amounts of the denom to raw units in place
+func (c *Cycle) rawAmounts(ctx context.Context, denom string, amounts ...*types.Amount) error {
+	for _, amount := range amounts {
+		coin, err := c.registry().Coin(ctx, denom, *amount)
+		if err != nil {
+			return err
+		}
+		*amount = types.RawAmount(coin.Amount)
+	}
+	return nil
+}
+
+// describe returns the coin in raw and whole units for logs and alerts
+func (c *Cycle) describe(ctx context.Context, coin sdk.Coin) string {
+	return c.registry().Describe(ctx, coin)
+}
@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/notify"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+func TestRunConvertsWholeAmounts(t *testing.T) {
+	c, q, _, s, _ := newCycle()
+	c.Config.PowerPool = types.PowerPool{BaseAsset: "usqosmo", QuoteAsset: "uosmo"}
+	c.Config.Position.DefaultToken0Amount = types.WholeAmount("1500.5")
+	c.Config.Position.DefaultToken1Amount = types.WholeAmount("2")
+	c.Config.Assets = []types.Asset{{Denom: "usqosmo", Decimals: 6}}
+	q.balances = map[string]int64{"usqosmo": 2_000_000_000, "uosmo": 3_000_000}
+
+	// The quote asset has no decimals in the config
+	result := c.Run(context.Background(), false)
+	assert.ErrorContains(t, result.Err, "Failed to size positions: invalid default_token_1_amount: decimals of uosmo are unknown")
+
+	q.metadata = map[string]banktypes.Metadata{"uosmo": {
+		Base:    "uosmo",
+		Display: "osmo",
+		DenomUnits: []*banktypes.DenomUnit{
+			{Denom: "uosmo", Exponent: 0},
+			{Denom: "osmo", Exponent: 6},
+		},
+	}}
+
+	result = c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+
+	amount0, err := s.cfg.Position.DefaultToken0Amount.Int()
+	assert.NilError(t, err)
+	assert.Equal(t, int64(1500500000), amount0.Int64())
+	amount1, err := s.cfg.Position.DefaultToken1Amount.Int()
+	assert.NilError(t, err)
+	assert.Equal(t, int64(2000000), amount1.Int64())
+
+	// The config itself is left in whole units
+	assert.Assert(t, c.Config.Position.DefaultToken0Amount.IsWhole())
+}
+
+func TestRunConvertsWholeGasThreshold(t *testing.T) {
+	c, q, _, _, _ := newCycle()
+	n := &recordingNotifier{}
+	c.Notifier = n
+	c.Config.Notifier.LowGasThreshold = types.WholeAmount("1.5")
+	c.Config.Assets = []types.Asset{{Denom: "uosmo", Decimals: 6}}
+	q.balances = map[string]int64{"uosmo": 1_000_000}
+
+	result := c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+
+	assert.Equal(t, notify.EventLowGas, n.msgs[0].Event)
+	assert.Equal(t, "1500000uosmo", n.msgs[0].Fields["threshold"])
+}
@@ -0,0 +1,143 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"go.uber.org/zap"
+
+	"github.com/margined-protocol/flood/internal/fetch"
+	"github.com/margined-protocol/flood/internal/notify"
+	"github.com/margined-protocol/flood/internal/types"
+	"github.com/margined-protocol/flood/internal/vault"
+)
+
+// manageVaults measures the collateral ratio of every vault the bot operates
+// and tops up those near liquidation in their own transaction, so a failure
+// never blocks the liquidity update. Top ups are only planned while paused
+// or in a dry run. What a sent top up pays is recorded as spent in the market.
+func (c *Cycle) manageVaults(ctx context.Context, market *Market, paused bool) ([]vault.Status, error) {
+	l, cfg := c.Logger, c.Config
+	powerDenom, baseDenom, err := market.Config.PowerDenoms()
+	if err != nil {
+		return nil, err
+	}
+
+	// The balances are read alongside the vaults, even if there are none.
+	// Each page of vaults and each balance has its own deadline.
+	var (
+		vaults   []types.UserVault
+		balances sdk.Coins
+	)
+	at := market.At(ctx)
+	err = fetch.All(at, 0,
+		fetch.Query{Name: "vaults", Run: func(ctx context.Context) (err error) {
+			vaults, err = c.Querier.UserVaults(ctx, c.Address)
+			return err
+		}},
+		fetch.Query{Name: "balances", Run: func(ctx context.Context) (err error) {
+			balances, err = c.balances(ctx, baseDenom, powerDenom)
+			return err
+		}},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vaults: %w", err)
+	}
+	if len(vaults) == 0 {
+		return nil, nil
+	}
+
+	statuses, err := vault.Plan(cfg.Vaults, vaults, vault.Market{
+		BaseDenom:           baseDenom,
+		PowerDenom:          powerDenom,
+		BasePrice:           market.BaseSpotPrice,
+		NormalisationFactor: market.NormalisationFactor,
+		Power:               market.Power,
+	}, balances)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []sdk.Msg
+	for _, s := range statuses {
+		l.Info("Vault",
+			zap.Uint64("id", s.ID),
+			zap.String("collateral", c.describe(ctx, sdk.Coin{Denom: baseDenom, Amount: s.Collateral})),
+			zap.String("short_amount", c.describe(ctx, sdk.Coin{Denom: powerDenom, Amount: s.ShortAmount})),
+			zap.Float64("ratio", s.Ratio),
+			zap.String("action", string(s.Action)),
+		)
+
+		if s.Liquidatable {
+			c.send(ctx, notify.Message{
+				Event:    notify.EventVault,
+				Severity: notify.SeverityCritical,
+				Title:    "Vault below the liquidation ratio",
+				Text:     "The vault can be liquidated until it is topped up",
+				Fields:   vaultFields(s),
+			})
+		}
+		if s.Shortfall {
+			c.send(ctx, notify.Message{
+				Event:    notify.EventVault,
+				Severity: notify.SeverityCritical,
+				Title:    "Vault at risk of liquidation",
+				Text:     "The wallet cannot restore the target collateral ratio",
+				Fields:   vaultFields(s),
+			})
+		}
+
+		msg, err := s.Msg(c.Address, cfg.PowerPool.ContractAddress)
+		if err != nil {
+			return statuses, err
+		}
+		if msg != nil {
+			msgs = append(msgs, msg)
+		}
+	}
+
+	if len(msgs) == 0 {
+		return statuses, nil
+	}
+
+	if paused || c.DryRun {
+		l.Info("Not topping up vaults", zap.Bool("paused", paused), zap.Reflect("msgs", msgs))
+		return statuses, nil
+	}
+
+	txResp, err := c.broadcast(ctx, msgs)
+	if err != nil {
+		return statuses, fmt.Errorf("vault transaction error: %w", err)
+	}
+
+	for _, s := range statuses {
+		if s.Action == vault.ActionNone {
+			continue
+		}
+		market.Spent = market.Spent.Add(s.Amount)
+
+		fields := vaultFields(s)
+		fields["tx_hash"] = txResp.TxHash
+		c.send(ctx, notify.Message{
+			Event:    notify.EventVault,
+			Severity: notify.SeverityWarning,
+			Title:    "Topped up vault",
+			Fields:   fields,
+		})
+	}
+
+	return statuses, nil
+}
+
+func vaultFields(s vault.Status) map[string]string {
+	fields := map[string]string{
+		"vault_id": strconv.FormatUint(s.ID, 10),
+		"ratio":    fmt.Sprintf("%f", s.Ratio),
+	}
+	if s.Action != vault.ActionNone {
+		fields[string(s.Action)] = s.Amount.String()
+	}
+	return fields
+}
@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	cltypes "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/types"
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/notify"
+	"github.com/margined-protocol/flood/internal/types"
+	"github.com/margined-protocol/flood/internal/vault"
+)
+
+func vaultCycle() (*Cycle, *fakeBroadcaster) {
+	c, q, b, _, _ := newCycle()
+	c.Config.Vaults = types.Vaults{Enabled: true}
+	c.Config.PowerPool.ContractAddress = "osmo1power"
+
+	// Power is worth 0.001 base, so the first vault is at a ratio of 1.6
+	q.vaults = []types.UserVault{
+		{ID: 1, GetVaultResponse: types.GetVaultResponse{Collateral: "1600", ShortAmount: "1000000"}},
+		{ID: 2, GetVaultResponse: types.GetVaultResponse{Collateral: "5000", ShortAmount: "1000000"}},
+	}
+	q.balances = map[string]int64{"uosmo": 1000}
+
+	return c, b
+}
+
+func TestRunTopsUpVaults(t *testing.T) {
+	c, b := vaultCycle()
+
+	result := c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+	assert.Equal(t, DecisionRebalanced, result.Decision)
+
+	assert.Equal(t, 2, len(result.Vaults))
+	assert.Equal(t, vault.ActionDeposit, result.Vaults[0].Action)
+	assert.Equal(t, vault.ActionNone, result.Vaults[1].Action)
+
+	// The top up is sent before and apart from the liquidity update
+	assert.Equal(t, 2, len(b.sent))
+	assert.Equal(t, 1, len(b.sent[0]))
+	deposit := b.sent[0][0].(*wasmtypes.MsgExecuteContract)
+	assert.Equal(t, "osmo1power", deposit.Contract)
+	assert.Equal(t, "400uosmo", deposit.Funds.String())
+	_, ok := b.sent[1][0].(*cltypes.MsgCreatePosition)
+	assert.Assert(t, ok)
+
+	// Positions are sized to what the deposit left in the wallet
+	assert.Equal(t, "400uosmo", result.Market.Spent.String())
+	assert.Equal(t, "600uosmo", result.Balances.Wallet.String())
+}
+
+func TestRunAlertsOnLiquidatableVaults(t *testing.T) {
+	titles := func(n *recordingNotifier) []string {
+		var titles []string
+		for _, msg := range n.msgs {
+			if msg.Severity == notify.SeverityCritical {
+				titles = append(titles, msg.Title)
+			}
+		}
+		return titles
+	}
+
+	// A liquidatable vault the wallet tops up is not reported as a shortfall
+	c, _ := vaultCycle()
+	c.Querier.(*fakeQuerier).vaults[0].Collateral = "1400"
+	n := &recordingNotifier{}
+	c.Notifier = n
+
+	result := c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+	assert.Assert(t, result.Vaults[0].Liquidatable && !result.Vaults[0].Shortfall)
+	assert.DeepEqual(t, []string{"Vault below the liquidation ratio"}, titles(n))
+
+	// One the wallet cannot restore is reported as both
+	c, _ = vaultCycle()
+	c.Querier.(*fakeQuerier).vaults[0].Collateral = "1400"
+	c.Querier.(*fakeQuerier).balances = map[string]int64{"uosmo": 100}
+	n = &recordingNotifier{}
+	c.Notifier = n
+
+	result = c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+	assert.Assert(t, result.Vaults[0].Shortfall)
+	assert.DeepEqual(t, []string{"Vault below the liquidation ratio", "Vault at risk of liquidation"}, titles(n))
+}
+
+func TestRunPlansVaultsWhenPaused(t *testing.T) {
+	c, b := vaultCycle()
+
+	result := c.Run(context.Background(), true)
+	assert.NilError(t, result.Err)
+	assert.Equal(t, DecisionAdminPaused, result.Decision)
+	assert.Equal(t, vault.ActionDeposit, result.Vaults[0].Action)
+	assert.Equal(t, 0, len(b.sent))
+}
+
+func TestRunContinuesWhenVaultsFail(t *testing.T) {
+	c, b := vaultCycle()
+	c.Config.Vaults.Action = "sell"
+
+	result := c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+	assert.Equal(t, DecisionRebalanced, result.Decision)
+	assert.Equal(t, 1, len(b.sent))
+}
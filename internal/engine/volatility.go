@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/margined-protocol/flood/internal/types"
+	"github.com/margined-protocol/flood/internal/volatility"
+)
+
+// Defaults for the [volatility] config
+const (
+	defaultVolatilitySamples    = 48
+	defaultVolatilityMinSamples = 10
+	defaultVolatilityHorizon    = 24 * time.Hour
+	defaultVolatilityMultiplier = "2"
+	defaultVolatilityMinSpread  = "0.01"
+	defaultVolatilityMaxSpread  = "0.5"
+)
+
+// maxBuySpread is the widest buy side, the range must stay above a price of 0
+const maxBuySpread = 0.999999
+
+// VolatilityEstimate is the realised volatility measured in a cycle and the
+// spread it produced.
+type VolatilityEstimate struct {
+	PowerVolatility float64 `json:"power_volatility"`
+	BaseVolatility  float64 `json:"base_volatility"`
+	Returns         int     `json:"returns"`
+	// Spread is empty when there were too few samples and the configured
+	// spreads were used
+	Spread string `json:"spread,omitempty"`
+}
+
+// volatilityParams are the parsed [volatility] settings
+type volatilityParams struct {
+	samples, minSamples int
+	horizon             time.Duration
+	multiplier          float64
+	minSpread           float64
+	maxSpread           float64
+}
+
+func parseVolatility(cfg types.Volatility) (volatilityParams, error) {
+	p := volatilityParams{
+		samples:    cfg.Samples,
+		minSamples: cfg.MinSamples,
+		horizon:    cfg.Horizon,
+	}
+	if p.samples <= 0 {
+		p.samples = defaultVolatilitySamples
+	}
+	if p.minSamples <= 0 {
+		p.minSamples = defaultVolatilityMinSamples
+	}
+	if p.horizon <= 0 {
+		p.horizon = defaultVolatilityHorizon
+	}
+
+	values := []struct {
+		name, value, fallback string
+		out                   *float64
+	}{
+		{"multiplier", cfg.Multiplier, defaultVolatilityMultiplier, &p.multiplier},
+		{"min_spread", cfg.MinSpread, defaultVolatilityMinSpread, &p.minSpread},
+		{"max_spread", cfg.MaxSpread, defaultVolatilityMaxSpread, &p.maxSpread},
+	}
+	for _, v := range values {
+		if v.value == "" {
+			v.value = v.fallback
+		}
+		f, err := strconv.ParseFloat(v.value, 64)
+		if err != nil || f <= 0 {
+			return p, fmt.Errorf("invalid %s: %s", v.name, v.value)
+		}
+		*v.out = f
+	}
+
+	if p.minSpread > p.maxSpread {
+		return p, fmt.Errorf("min_spread %f is above max_spread %f", p.minSpread, p.maxSpread)
+	}
+
+	return p, nil
+}
+
+// adaptSpreads returns the config to pass to the strategy. When volatility
+// sizing is enabled and enough samples are stored, the spread is replaced by
+// the volatility scaled width and any per side spreads keep their ratio to
+// it, clamped to the same bounds.
+func (c *Cycle) adaptSpreads(market *Market, now time.Time) (*types.Config, *VolatilityEstimate, error) {
+	cfg := c.Config
+	if !cfg.Volatility.Enabled {
+		return cfg, nil, nil
+	}
+
+	p, err := parseVolatility(cfg.Volatility)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var history []CycleResult
+	if c.Store != nil {
+		history, err = c.Store.Recent(p.samples)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var power, base []volatility.Sample
+	add := func(t time.Time, m *Market) {
+		if price, err := strconv.ParseFloat(m.PowerSpotPrice, 64); err == nil {
+			power = append(power, volatility.Sample{Time: t, Price: price})
+		}
+		if price, err := strconv.ParseFloat(m.BaseSpotPrice, 64); err == nil {
+			base = append(base, volatility.Sample{Time: t, Price: price})
+		}
+	}
+	for _, r := range history {
+		if r.Market != nil {
+			add(r.Start, r.Market)
+		}
+	}
+	add(now, market)
+
+	estimate := &VolatilityEstimate{}
+	estimate.BaseVolatility, _, _ = volatility.Realised(base, p.horizon)
+	estimate.PowerVolatility, estimate.Returns, err = volatility.Realised(power, p.horizon)
+
+	if err != nil || estimate.Returns < p.minSamples {
+		c.Logger.Info("Not enough samples for a volatility estimate, using the configured spread",
+			zap.Int("returns", estimate.Returns),
+			zap.Int("min_samples", p.minSamples),
+		)
+		return cfg, estimate, nil
+	}
+
+	width := volatility.Width(estimate.PowerVolatility, p.multiplier, p.minSpread, p.maxSpread)
+	estimate.Spread = strconv.FormatFloat(width, 'f', 6, 64)
+
+	adjusted := *cfg
+	adjusted.Position.BuySpread = scaleSpread(cfg.Position.BuySpread, cfg.Position.Spread, width, p.minSpread, math.Min(p.maxSpread, maxBuySpread))
+	adjusted.Position.SellSpread = scaleSpread(cfg.Position.SellSpread, cfg.Position.Spread, width, p.minSpread, p.maxSpread)
+	adjusted.Position.Spread = estimate.Spread
+
+	c.Logger.Info("Volatility estimate",
+		zap.Float64("power_volatility", estimate.PowerVolatility),
+		zap.Float64("base_volatility", estimate.BaseVolatility),
+		zap.Int("returns", estimate.Returns),
+		zap.Duration("horizon", p.horizon),
+		zap.String("spread", estimate.Spread),
+		zap.String("buy_spread", adjusted.Position.BuySpread),
+		zap.String("sell_spread", adjusted.Position.SellSpread),
+	)
+
+	return &adjusted, estimate, nil
+}
+
+// scaleSpread keeps a per side spread's ratio to the base spread when the
+// base spread becomes width, clamped between lo and hi with hi taking
+// precedence. Unset or unparsable spreads are left alone.
+func scaleSpread(side, spread string, width, lo, hi float64) string {
+	if side == "" {
+		return side
+	}
+
+	s, err := strconv.ParseFloat(side, 64)
+	if err != nil {
+		return side
+	}
+
+	base, err := strconv.ParseFloat(spread, 64)
+	if err != nil || base <= 0 {
+		return side
+	}
+
+	scaled := math.Min(hi, math.Max(lo, s*width/base))
+	return strconv.FormatFloat(scaled, 'f', 6, 64)
+}
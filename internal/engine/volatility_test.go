@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+// seedStore saves hourly results with the power price alternating by 1%
+func seedStore(t *testing.T, store Store, start time.Time, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		price := 1000.0
+		if i%2 == 1 {
+			price = 1000 * math.Exp(0.01)
+		}
+		assert.NilError(t, store.Save(CycleResult{
+			Start:    start.Add(time.Duration(i) * time.Hour),
+			Decision: DecisionRebalanced,
+			Market:   &Market{BaseSpotPrice: "10", PowerSpotPrice: fmt.Sprintf("%f", price)},
+		}))
+	}
+}
+
+func TestVolatilityScalesSpreads(t *testing.T) {
+	c, _, _, s, store := newCycle()
+	store.size = 0
+	c.Config.Position = types.Position{Spread: "0.1", SellSpread: "0.2"}
+	c.Config.Volatility = types.Volatility{
+		Enabled:    true,
+		MinSamples: 4,
+		Horizon:    time.Hour,
+		Multiplier: "3",
+		MinSpread:  "0.01",
+		MaxSpread:  "0.5",
+	}
+
+	// Too little history keeps the configured spread
+	result := c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+	assert.Equal(t, "", result.Volatility.Spread)
+	assert.Equal(t, "0.1", s.cfg.Position.Spread)
+
+	// The clock is fixed so seed history ending an hour before it, the
+	// current price of 1000 continues the alternation
+	now := time.Unix(1700000000, 0)
+	store.results = nil
+	seedStore(t, store, now.Add(-6*time.Hour), 6)
+
+	result = c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+	assert.Equal(t, 6, result.Volatility.Returns)
+	assert.Assert(t, math.Abs(result.Volatility.PowerVolatility-0.01) < 1e-6)
+	assert.Assert(t, result.Volatility.BaseVolatility == 0)
+
+	// 3 standard deviations of 1%, with the sell side kept at twice the buy
+	assert.Equal(t, "0.030000", s.cfg.Position.Spread)
+	assert.Equal(t, "", s.cfg.Position.BuySpread)
+	assert.Equal(t, "0.060000", s.cfg.Position.SellSpread)
+
+	// The cycle's own config is untouched
+	assert.Equal(t, "0.1", c.Config.Position.Spread)
+}
+
+func TestVolatilityClampsSideSpreads(t *testing.T) {
+	c, _, _, s, store := newCycle()
+	store.size = 0
+	c.Config.Position = types.Position{Spread: "0.01", BuySpread: "0.5", SellSpread: "0.001"}
+	c.Config.Volatility = types.Volatility{
+		Enabled:    true,
+		MinSamples: 4,
+		Horizon:    time.Hour,
+		Multiplier: "3",
+		MinSpread:  "0.01",
+		MaxSpread:  "2",
+	}
+	seedStore(t, store, time.Unix(1700000000, 0).Add(-6*time.Hour), 6)
+
+	// Tripling the spread would take the buy side to 1.5 and the sell side
+	// below the minimum, the buy side stays below 1
+	result := c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+	assert.Equal(t, "0.030000", s.cfg.Position.Spread)
+	assert.Equal(t, "0.999999", s.cfg.Position.BuySpread)
+	assert.Equal(t, "0.010000", s.cfg.Position.SellSpread)
+
+	// Within max_spread when it is below 1
+	c.Config.Volatility.MaxSpread = "0.5"
+	result = c.Run(context.Background(), false)
+	assert.NilError(t, result.Err)
+	assert.Equal(t, "0.500000", s.cfg.Position.BuySpread)
+}
+
+func TestVolatilityRejectsInvalidConfig(t *testing.T) {
+	c, _, _, _, _ := newCycle()
+	c.Config.Volatility = types.Volatility{Enabled: true, MinSpread: "0.5", MaxSpread: "0.1"}
+
+	result := c.Run(context.Background(), false)
+	assert.ErrorContains(t, result.Err, "Invalid volatility config")
+}
+
+func TestFileStorePersistsResults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.json")
+
+	store, err := NewFileStore(path, 3)
+	assert.NilError(t, err)
+	seedStore(t, store, time.Unix(1700000000, 0).UTC(), 5)
+
+	reopened, err := NewFileStore(path, 3)
+	assert.NilError(t, err)
+
+	results, err := reopened.Recent(0)
+	assert.NilError(t, err)
+	assert.Equal(t, 3, len(results))
+	assert.Equal(t, time.Unix(1700000000, 0).UTC().Add(2*time.Hour), results[0].Start)
+	assert.Equal(t, "10", results[2].Market.BaseSpotPrice)
+	assert.Equal(t, DecisionRebalanced, results[2].Decision)
+}
@@ -0,0 +1,170 @@
+package feegrant
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/client"
+	"github.com/cosmos/cosmos-sdk/client/tx"
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	feegranttypes "github.com/cosmos/cosmos-sdk/x/feegrant"
+)
+
+// Signer attaches a fee granter to every transaction before it is signed so
+// that fees are deducted from the granter rather than the signing account.
+// It satisfies the cosmosclient.Signer interface.
+type Signer struct {
+	Granter sdk.AccAddress
+}
+
+// NewSigner parses the bech32 granter address and returns a Signer for it.
+func NewSigner(granter, prefix string) (*Signer, error) {
+	addr, err := sdk.GetFromBech32(granter, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fee granter address %s: %w", granter, err)
+	}
+
+	return &Signer{Granter: addr}, nil
+}
+
+// Sign sets the fee granter on the transaction and signs it.
+func (s *Signer) Sign(txf tx.Factory, name string, txBuilder client.TxBuilder, overwriteSig bool) error {
+	txBuilder.SetFeeGranter(s.Granter)
+	return tx.Sign(txf, name, txBuilder, overwriteSig)
+}
+
+// Allowance summarises a fee allowance granted to the signer.
+type Allowance struct {
+	Granter string
+	Grantee string
+	// Type is the proto message name of the underlying allowance.
+	Type string
+	// Remaining is the amount that can still be spent, nil means unlimited
+	// and empty means nothing is left.
+	Remaining sdk.Coins
+	// Expiration is the time the allowance expires, nil means never.
+	Expiration *time.Time
+	// AllowedMessages restricts which messages may use the allowance, empty
+	// means all messages are allowed.
+	AllowedMessages []string
+}
+
+// IsUnlimited returns true if the allowance has no spend limit.
+func (a Allowance) IsUnlimited() bool {
+	return a.Remaining == nil
+}
+
+// IsExpired returns true if the allowance expired before now.
+func (a Allowance) IsExpired(now time.Time) bool {
+	return a.Expiration != nil && !a.Expiration.After(now)
+}
+
+// Covers returns true if the remaining allowance is sufficient to pay fees.
+func (a Allowance) Covers(fees sdk.Coins) bool {
+	return a.IsUnlimited() || a.Remaining.IsAllGTE(fees)
+}
+
+// AllowsMsg returns true if the allowance may be used for the message type url.
+func (a Allowance) AllowsMsg(typeURL string) bool {
+	if len(a.AllowedMessages) == 0 {
+		return true
+	}
+
+	for _, m := range a.AllowedMessages {
+		if m == typeURL {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetAllowance queries the fee allowance from granter to grantee, with the
+// remaining spend as it stands at now.
+func GetAllowance(ctx context.Context, client feegranttypes.QueryClient, granter, grantee string, now time.Time) (*Allowance, error) {
+	res, err := client.Allowance(ctx, &feegranttypes.QueryAllowanceRequest{
+		Granter: granter,
+		Grantee: grantee,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Allowance == nil || res.Allowance.Allowance == nil {
+		return nil, fmt.Errorf("no fee allowance from %s to %s", granter, grantee)
+	}
+
+	registry := codectypes.NewInterfaceRegistry()
+	feegranttypes.RegisterInterfaces(registry)
+
+	var fa feegranttypes.FeeAllowanceI
+	if err := registry.UnpackAny(res.Allowance.Allowance, &fa); err != nil {
+		return nil, err
+	}
+
+	allowance := Allowance{
+		Granter: res.Allowance.Granter,
+		Grantee: res.Allowance.Grantee,
+		Type:    res.Allowance.Allowance.TypeUrl,
+	}
+
+	if err := summarise(&allowance, fa, now); err != nil {
+		return nil, err
+	}
+
+	return &allowance, nil
+}
+
+// summarise fills in the remaining spend and expiration from the allowance
+// at now, descending into filtered allowances.
+func summarise(a *Allowance, fa feegranttypes.FeeAllowanceI, now time.Time) error {
+	switch t := fa.(type) {
+	case *feegranttypes.BasicAllowance:
+		a.Remaining = nilIfEmpty(t.SpendLimit)
+		a.Expiration = t.Expiration
+	case *feegranttypes.PeriodicAllowance:
+		// The chain refills the period on the first use after the reset, an
+		// empty amount left in the period is spent rather than unlimited
+		remaining := append(sdk.Coins{}, t.PeriodCanSpend...)
+		if !now.Before(t.PeriodReset) {
+			remaining = append(sdk.Coins{}, t.PeriodSpendLimit...)
+		}
+		if limit := nilIfEmpty(t.Basic.SpendLimit); limit != nil {
+			remaining = minCoins(remaining, limit)
+		}
+		a.Remaining = remaining
+		a.Expiration = t.Basic.Expiration
+	case *feegranttypes.AllowedMsgAllowance:
+		a.AllowedMessages = t.AllowedMessages
+		inner, err := t.GetAllowance()
+		if err != nil {
+			return err
+		}
+		return summarise(a, inner, now)
+	default:
+		return fmt.Errorf("unsupported fee allowance type %T", fa)
+	}
+
+	return nil
+}
+
+func nilIfEmpty(coins sdk.Coins) sdk.Coins {
+	if coins.Empty() {
+		return nil
+	}
+	return coins
+}
+
+// minCoins returns the denom-wise minimum of two coin sets, denoms only in one
+// set are dropped as they cannot be spent.
+func minCoins(a, b sdk.Coins) sdk.Coins {
+	out := sdk.NewCoins()
+	for _, c := range a {
+		if amt := b.AmountOf(c.Denom); amt.IsPositive() {
+			out = out.Add(sdk.NewCoin(c.Denom, sdk.MinInt(c.Amount, amt)))
+		}
+	}
+	return out
+}
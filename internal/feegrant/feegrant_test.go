@@ -0,0 +1,214 @@
+package feegrant
+
+import (
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	feegranttypes "github.com/cosmos/cosmos-sdk/x/feegrant"
+	"gotest.tools/assert"
+)
+
+const (
+	swapMsg     = "/osmosis.poolmanager.v1beta1.MsgSwapExactAmountIn"
+	positionMsg = "/osmosis.concentratedliquidity.v1beta1.MsgCreatePosition"
+)
+
+var (
+	now      = time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	tomorrow = now.Add(24 * time.Hour)
+	lastWeek = now.Add(-7 * 24 * time.Hour)
+)
+
+func coins(s string) sdk.Coins {
+	c, err := sdk.ParseCoinsNormalized(s)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func allowed(t *testing.T, inner feegranttypes.FeeAllowanceI, msgs ...string) feegranttypes.FeeAllowanceI {
+	t.Helper()
+	a, err := feegranttypes.NewAllowedMsgAllowance(inner, msgs)
+	assert.NilError(t, err)
+	return a
+}
+
+func TestSummarise(t *testing.T) {
+	periodic := func(canSpend, spendLimit, basicLimit string, reset time.Time) *feegranttypes.PeriodicAllowance {
+		return &feegranttypes.PeriodicAllowance{
+			Basic:            feegranttypes.BasicAllowance{SpendLimit: coins(basicLimit), Expiration: &tomorrow},
+			Period:           24 * time.Hour,
+			PeriodSpendLimit: coins(spendLimit),
+			PeriodCanSpend:   coins(canSpend),
+			PeriodReset:      reset,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		allowance  feegranttypes.FeeAllowanceI
+		remaining  sdk.Coins
+		expiration *time.Time
+		msgs       []string
+	}{
+		{
+			name:      "basic unlimited",
+			allowance: &feegranttypes.BasicAllowance{},
+		},
+		{
+			name:       "basic limited",
+			allowance:  &feegranttypes.BasicAllowance{SpendLimit: coins("500uosmo"), Expiration: &tomorrow},
+			remaining:  coins("500uosmo"),
+			expiration: &tomorrow,
+		},
+		{
+			name:       "periodic within the period",
+			allowance:  periodic("40uosmo", "100uosmo", "", tomorrow),
+			remaining:  coins("40uosmo"),
+			expiration: &tomorrow,
+		},
+		{
+			name:       "periodic spent within the period",
+			allowance:  periodic("", "100uosmo", "", tomorrow),
+			remaining:  sdk.Coins{},
+			expiration: &tomorrow,
+		},
+		{
+			name:       "periodic after the reset",
+			allowance:  periodic("", "100uosmo", "", lastWeek),
+			remaining:  coins("100uosmo"),
+			expiration: &tomorrow,
+		},
+		{
+			name:       "periodic capped by the basic limit",
+			allowance:  periodic("40uosmo", "100uosmo", "30uosmo", tomorrow),
+			remaining:  coins("30uosmo"),
+			expiration: &tomorrow,
+		},
+		{
+			name:       "periodic reset capped by the basic limit",
+			allowance:  periodic("", "100uosmo", "60uosmo", now),
+			remaining:  coins("60uosmo"),
+			expiration: &tomorrow,
+		},
+		{
+			name:      "allowed messages",
+			allowance: allowed(t, &feegranttypes.BasicAllowance{SpendLimit: coins("500uosmo")}, swapMsg),
+			remaining: coins("500uosmo"),
+			msgs:      []string{swapMsg},
+		},
+		{
+			name:       "allowed messages of a periodic allowance",
+			allowance:  allowed(t, periodic("", "100uosmo", "", lastWeek), swapMsg, positionMsg),
+			remaining:  coins("100uosmo"),
+			expiration: &tomorrow,
+			msgs:       []string{swapMsg, positionMsg},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var a Allowance
+			assert.NilError(t, summarise(&a, tt.allowance, now))
+			assert.DeepEqual(t, tt.remaining, a.Remaining)
+			assert.Equal(t, tt.expiration, a.Expiration)
+			assert.DeepEqual(t, tt.msgs, a.AllowedMessages)
+		})
+	}
+}
+
+func TestMinCoins(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{"40uosmo", "100uosmo", "40uosmo"},
+		{"100uosmo,5uion", "30uosmo,10uion", "5uion,30uosmo"},
+		// Denoms only in one set cannot be spent
+		{"100uosmo,5uion", "30uosmo", "30uosmo"},
+		{"5uion", "30uosmo", ""},
+	}
+
+	for _, tt := range tests {
+		got := minCoins(coins(tt.a), coins(tt.b))
+		assert.Assert(t, got != nil, "%s %s", tt.a, tt.b)
+		assert.Equal(t, tt.want, got.String(), "%s %s", tt.a, tt.b)
+	}
+}
+
+func TestAllowance(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowance Allowance
+		fees      sdk.Coins
+		covers    bool
+		swap      bool
+		expired   bool
+	}{
+		{
+			name:      "unlimited",
+			allowance: Allowance{},
+			fees:      coins("10000uosmo"),
+			covers:    true,
+			swap:      true,
+		},
+		{
+			name:      "enough left",
+			allowance: Allowance{Remaining: coins("10000uosmo"), Expiration: &tomorrow},
+			fees:      coins("10000uosmo"),
+			covers:    true,
+			swap:      true,
+		},
+		{
+			name:      "too little left",
+			allowance: Allowance{Remaining: coins("9999uosmo")},
+			fees:      coins("10000uosmo"),
+			swap:      true,
+		},
+		{
+			name:      "spent",
+			allowance: Allowance{Remaining: sdk.Coins{}},
+			fees:      coins("10000uosmo"),
+			swap:      true,
+		},
+		{
+			name:      "other denom",
+			allowance: Allowance{Remaining: coins("10000uion")},
+			fees:      coins("10000uosmo"),
+			swap:      true,
+		},
+		{
+			name:      "expired now",
+			allowance: Allowance{Expiration: &now},
+			fees:      coins("10000uosmo"),
+			covers:    true,
+			swap:      true,
+			expired:   true,
+		},
+		{
+			name:      "positions only",
+			allowance: Allowance{AllowedMessages: []string{positionMsg}},
+			fees:      coins("10000uosmo"),
+			covers:    true,
+		},
+		{
+			name:      "swaps allowed",
+			allowance: Allowance{AllowedMessages: []string{positionMsg, swapMsg}, Expiration: &lastWeek},
+			fees:      coins("10000uosmo"),
+			covers:    true,
+			swap:      true,
+			expired:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.covers, tt.allowance.Covers(tt.fees))
+			assert.Equal(t, tt.swap, tt.allowance.AllowsMsg(swapMsg))
+			assert.Equal(t, tt.expired, tt.allowance.IsExpired(now))
+		})
+	}
+}
@@ -0,0 +1,75 @@
+// Package fetch runs chain queries concurrently. Each query writes only its
+// own results, gets its own deadline and fails with an error naming it, so
+// a cycle can read several values at once without sharing state between
+// goroutines.
+package fetch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds a query when no timeout is configured.
+const DefaultTimeout = 10 * time.Second
+
+// Query is a named read. Run must only write variables no other query of
+// the same fetch touches.
+type Query struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Error is the failure of a named query.
+type Error struct {
+	Query string
+	Err   error
+}
+
+func (e *Error) Error() string { return e.Query + ": " + e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// All runs the queries concurrently, each with its own timeout when the
+// timeout is positive, and waits for all of them. It returns nil when every
+// query succeeds, otherwise the failures joined in the order the queries
+// were given.
+func All(ctx context.Context, timeout time.Duration, queries ...Query) error {
+	errs := make([]error, len(queries))
+
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		wg.Add(1)
+		go func(i int, q Query) {
+			defer wg.Done()
+
+			ctx, cancel := withTimeout(ctx, timeout)
+			defer cancel()
+
+			if err := q.Run(ctx); err != nil {
+				errs[i] = &Error{Query: q.Name, Err: err}
+			}
+		}(i, q)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// Failed returns the name of the first query that failed in an error
+// returned by All, and false when the error does not come from a query.
+func Failed(err error) (string, bool) {
+	var e *Error
+	if !errors.As(err, &e) {
+		return "", false
+	}
+	return e.Query, true
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,88 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestAllRunsQueriesConcurrently(t *testing.T) {
+	started := make(chan struct{})
+	var first, second string
+
+	// Each query waits for the other to start, so they must run together
+	err := All(context.Background(), time.Second,
+		Query{Name: "first", Run: func(ctx context.Context) error {
+			select {
+			case started <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			first = "a"
+			return nil
+		}},
+		Query{Name: "second", Run: func(ctx context.Context) error {
+			select {
+			case <-started:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			second = "b"
+			return nil
+		}},
+	)
+	assert.NilError(t, err)
+	assert.Equal(t, "a", first)
+	assert.Equal(t, "b", second)
+}
+
+func TestAllNamesFailedQueries(t *testing.T) {
+	down := errors.New("node down")
+
+	err := All(context.Background(), time.Second,
+		Query{Name: "config", Run: func(context.Context) error { return nil }},
+		Query{Name: "state", Run: func(context.Context) error { return down }},
+		Query{Name: "spot price", Run: func(context.Context) error { return errors.New("no pool") }},
+	)
+	assert.Error(t, err, "state: node down\nspot price: no pool")
+	assert.Assert(t, errors.Is(err, down))
+
+	query, ok := Failed(err)
+	assert.Assert(t, ok)
+	assert.Equal(t, "state", query)
+
+	_, ok = Failed(down)
+	assert.Assert(t, !ok)
+}
+
+func TestAllGivesEachQueryADeadline(t *testing.T) {
+	var bounded bool
+
+	err := All(context.Background(), 10*time.Millisecond,
+		Query{Name: "slow", Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+		Query{Name: "fast", Run: func(ctx context.Context) error {
+			_, bounded = ctx.Deadline()
+			return nil
+		}},
+	)
+	assert.ErrorContains(t, err, "slow: context deadline exceeded")
+	assert.Assert(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Assert(t, bounded)
+}
+
+func TestAllWithoutTimeout(t *testing.T) {
+	var bounded bool
+
+	err := All(context.Background(), 0, Query{Name: "query", Run: func(ctx context.Context) error {
+		_, bounded = ctx.Deadline()
+		return nil
+	}})
+	assert.NilError(t, err)
+	assert.Assert(t, !bounded)
+}
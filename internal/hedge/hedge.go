@@ -0,0 +1,198 @@
+// Package hedge keeps the base asset exposure of the inventory within a band
+// by trading the base pool. Power is roughly twice as sensitive to the base
+// price as the base asset itself, so holding it leaves a large delta.
+package hedge
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	abci "github.com/cometbft/cometbft/abci/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/osmosis-labs/osmosis/osmomath"
+	model "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/model"
+	pmtypes "github.com/osmosis-labs/osmosis/v21/x/poolmanager/types"
+
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+const (
+	defaultMaxSlippage = "0.01"
+	// eventTokenSwapped is emitted by poolmanager for every pool swapped
+	eventTokenSwapped = "token_swapped"
+)
+
+// Trade is a hedge against the base pool. TokenOut and Cost are set once
+// the trade has executed.
+type Trade struct {
+	// Delta is the net base asset delta before the trade
+	Delta  float64 `json:"delta"`
+	Target float64 `json:"target"`
+	// Sell is true when selling the base asset for the quote asset
+	Sell        bool     `json:"sell"`
+	BasePrice   string   `json:"base_price"`
+	TokenIn     sdk.Coin `json:"token_in"`
+	ExpectedOut sdk.Coin `json:"expected_out"`
+	MinOut      sdk.Coin `json:"min_out"`
+	TokenOut    sdk.Coin `json:"token_out"`
+	// Cost is the shortfall against the spot price in the quote asset,
+	// covering the pool fee and price impact
+	Cost float64 `json:"cost"`
+}
+
+// Inventory sums the assets held in positions and idle balances, adjusted for
+// swaps in msgs as if they fill at their minimum amount out.
+func Inventory(positions []model.FullPositionBreakdown, balances sdk.Coins, msgs []sdk.Msg) sdk.Coins {
+	inventory := sdk.NewCoins(balances...)
+
+	for _, p := range positions {
+		inventory = inventory.Add(p.Asset0, p.Asset1)
+	}
+
+	for _, msg := range msgs {
+		swap, ok := msg.(*pmtypes.MsgSwapExactAmountIn)
+		if !ok || len(swap.Routes) == 0 {
+			continue
+		}
+		out := swap.Routes[len(swap.Routes)-1].TokenOutDenom
+		inventory = inventory.Add(sdk.NewCoin(out, swap.TokenOutMinAmount))
+		if remaining, negative := inventory.SafeSub(swap.TokenIn); !negative {
+			inventory = remaining
+		}
+	}
+
+	return inventory
+}
+
+// Delta returns the net base asset delta of the inventory given the delta of
+// one unit of power.
+func Delta(inventory sdk.Coins, baseDenom, powerDenom string, powerDelta float64) float64 {
+	base, _ := inventory.AmountOf(baseDenom).ToLegacyDec().Float64()
+	power, _ := inventory.AmountOf(powerDenom).ToLegacyDec().Float64()
+
+	return base + power*powerDelta
+}
+
+// Plan returns a swap through the base pool that brings the delta back to the
+// target, or nil if it is within the band. The base pool price is the quote
+// asset per base asset. The swap is capped at the max trade and at the idle
+// balance of the token in, so it never spends what the positions deploy.
+// The config amounts must be in raw units.
+func Plan(cfg types.Hedge, basePool types.Pool, basePrice string, delta float64, idle sdk.Coins, addr string) (*Trade, sdk.Msg, error) {
+	slippage, err := osmomath.NewDecFromStr(types.OrDefault(cfg.MaxSlippage, defaultMaxSlippage))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid max slippage: %w", err)
+	}
+	if slippage.IsNegative() || slippage.GTE(osmomath.OneDec()) {
+		return nil, nil, fmt.Errorf("max slippage must be between 0 and 1")
+	}
+
+	var amounts [3]float64
+	for i, amount := range []types.Amount{cfg.Target, cfg.Band, cfg.MaxTrade} {
+		raw, err := amount.Int()
+		if err != nil {
+			return nil, nil, err
+		}
+		amounts[i], _ = raw.ToLegacyDec().Float64()
+	}
+	target, band, maxTrade := amounts[0], amounts[1], amounts[2]
+
+	price, err := strconv.ParseFloat(basePrice, 64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid base price: %w", err)
+	}
+	if price <= 0 {
+		return nil, nil, fmt.Errorf("base price must be positive")
+	}
+
+	excess := delta - target
+	if math.Abs(excess) <= band {
+		return nil, nil, nil
+	}
+
+	amount := math.Abs(excess)
+	if maxTrade > 0 && amount > maxTrade {
+		amount = maxTrade
+	}
+
+	trade := &Trade{Delta: delta, Target: target, BasePrice: basePrice}
+
+	// Sell base for quote when long, buy it back when short
+	trade.Sell = excess > 0
+	if trade.Sell {
+		available, _ := idle.AmountOf(basePool.BaseDenom).ToLegacyDec().Float64()
+		amount = math.Min(amount, available)
+	} else {
+		available, _ := idle.AmountOf(basePool.QuoteDenom).ToLegacyDec().Float64()
+		amount = math.Min(amount, available/price)
+	}
+
+	if trade.Sell {
+		trade.TokenIn = sdk.NewInt64Coin(basePool.BaseDenom, int64(amount))
+		trade.ExpectedOut = sdk.NewInt64Coin(basePool.QuoteDenom, int64(amount*price))
+	} else {
+		trade.TokenIn = sdk.NewInt64Coin(basePool.QuoteDenom, int64(amount*price))
+		trade.ExpectedOut = sdk.NewInt64Coin(basePool.BaseDenom, int64(amount))
+	}
+
+	minOut := trade.ExpectedOut.Amount.ToLegacyDec().Mul(osmomath.OneDec().Sub(slippage)).TruncateInt()
+	trade.MinOut = sdk.NewCoin(trade.ExpectedOut.Denom, minOut)
+
+	if !trade.TokenIn.Amount.IsPositive() || !minOut.IsPositive() {
+		return nil, nil, nil
+	}
+
+	msg := &pmtypes.MsgSwapExactAmountIn{
+		Sender:            addr,
+		Routes:            []pmtypes.SwapAmountInRoute{{PoolId: basePool.ID, TokenOutDenom: trade.ExpectedOut.Denom}},
+		TokenIn:           trade.TokenIn,
+		TokenOutMinAmount: minOut,
+	}
+
+	return trade, msg, nil
+}
+
+// Settle records the amount received from the swap events of the executed
+// transaction and the cost against the spot price. It returns false if no
+// matching swap was found.
+func (t *Trade) Settle(events []abci.Event, poolID uint64) bool {
+	for _, event := range events {
+		if event.Type != eventTokenSwapped {
+			continue
+		}
+
+		attrs := make(map[string]string, len(event.Attributes))
+		for _, attr := range event.Attributes {
+			attrs[attr.Key] = attr.Value
+		}
+
+		if attrs[pmtypes.AttributeKeyPoolId] != strconv.FormatUint(poolID, 10) {
+			continue
+		}
+
+		tokensIn, err := sdk.ParseCoinsNormalized(attrs[pmtypes.AttributeKeyTokensIn])
+		if err != nil || tokensIn.AmountOf(t.TokenIn.Denom).IsZero() {
+			continue
+		}
+
+		tokensOut, err := sdk.ParseCoinsNormalized(attrs[pmtypes.AttributeKeyTokensOut])
+		if err != nil {
+			continue
+		}
+
+		t.TokenOut = sdk.NewCoin(t.ExpectedOut.Denom, tokensOut.AmountOf(t.ExpectedOut.Denom))
+
+		// Buying base receives base, so value the shortfall in quote
+		shortfall, _ := t.ExpectedOut.Amount.Sub(t.TokenOut.Amount).ToLegacyDec().Float64()
+		if !t.Sell {
+			price, _ := strconv.ParseFloat(t.BasePrice, 64)
+			shortfall *= price
+		}
+		t.Cost = shortfall
+
+		return true
+	}
+
+	return false
+}
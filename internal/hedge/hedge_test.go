@@ -0,0 +1,128 @@
+package hedge
+
+import (
+	"testing"
+
+	sdkmath "cosmossdk.io/math"
+	abci "github.com/cometbft/cometbft/abci/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	model "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/model"
+	pmtypes "github.com/osmosis-labs/osmosis/v21/x/poolmanager/types"
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+const (
+	baseDenom  = "uosmo"
+	powerDenom = "usqosmo"
+	usdcDenom  = "uusdc"
+	address    = "osmo1bot"
+)
+
+var (
+	basePool = types.Pool{ID: 1, BaseDenom: baseDenom, QuoteDenom: usdcDenom}
+	idle     = sdk.NewCoins(sdk.NewInt64Coin(baseDenom, 1_000_000), sdk.NewInt64Coin(usdcDenom, 1_000_000))
+)
+
+func TestInventory(t *testing.T) {
+	positions := []model.FullPositionBreakdown{
+		{Asset0: sdk.NewInt64Coin(baseDenom, 100), Asset1: sdk.NewInt64Coin(powerDenom, 0)},
+		{Asset0: sdk.NewInt64Coin(baseDenom, 0), Asset1: sdk.NewInt64Coin(powerDenom, 50)},
+	}
+	balances := sdk.NewCoins(sdk.NewInt64Coin(baseDenom, 1000))
+
+	// A pending swap counts at its minimum out
+	msgs := []sdk.Msg{&pmtypes.MsgSwapExactAmountIn{
+		Routes:            []pmtypes.SwapAmountInRoute{{PoolId: 2, TokenOutDenom: powerDenom}},
+		TokenIn:           sdk.NewInt64Coin(baseDenom, 500),
+		TokenOutMinAmount: sdk.NewInt(20),
+	}}
+
+	inventory := Inventory(positions, balances, msgs)
+	assert.Equal(t, int64(600), inventory.AmountOf(baseDenom).Int64())
+	assert.Equal(t, int64(70), inventory.AmountOf(powerDenom).Int64())
+
+	// Each power is worth two base of delta
+	assert.Equal(t, 740.0, Delta(inventory, baseDenom, powerDenom, 2))
+}
+
+func TestPlan(t *testing.T) {
+	cfg := types.Hedge{Band: types.RawAmount(sdkmath.NewInt(100)), MaxSlippage: "0.01"}
+
+	trade, msg, err := Plan(cfg, basePool, "10", 50, idle, address)
+	assert.NilError(t, err)
+	assert.Assert(t, trade == nil && msg == nil)
+
+	// Long delta sells base for quote
+	trade, msg, err = Plan(cfg, basePool, "10", 1000, idle, address)
+	assert.NilError(t, err)
+	swap := msg.(*pmtypes.MsgSwapExactAmountIn)
+	assert.Assert(t, trade.Sell)
+	assert.Equal(t, "1000"+baseDenom, swap.TokenIn.String())
+	assert.Equal(t, usdcDenom, swap.Routes[0].TokenOutDenom)
+	assert.Equal(t, int64(9900), swap.TokenOutMinAmount.Int64())
+	assert.Equal(t, "10000"+usdcDenom, trade.ExpectedOut.String())
+
+	// Short delta buys base, capped at the max trade
+	cfg.MaxTrade = types.RawAmount(sdkmath.NewInt(500))
+	trade, msg, err = Plan(cfg, basePool, "10", -1000, idle, address)
+	assert.NilError(t, err)
+	swap = msg.(*pmtypes.MsgSwapExactAmountIn)
+	assert.Assert(t, !trade.Sell)
+	assert.Equal(t, "5000"+usdcDenom, swap.TokenIn.String())
+	assert.Equal(t, baseDenom, swap.Routes[0].TokenOutDenom)
+	assert.Equal(t, int64(495), swap.TokenOutMinAmount.Int64())
+
+	_, _, err = Plan(types.Hedge{MaxSlippage: "2"}, basePool, "10", 1000, idle, address)
+	assert.ErrorContains(t, err, "max slippage")
+	_, _, err = Plan(cfg, basePool, "0", 1000, idle, address)
+	assert.ErrorContains(t, err, "base price")
+}
+
+func TestPlanCappedAtIdleBalance(t *testing.T) {
+	cfg := types.Hedge{Band: types.RawAmount(sdkmath.NewInt(100)), MaxSlippage: "0.01"}
+
+	// Only what the positions leave in the wallet is sold
+	trade, msg, err := Plan(cfg, basePool, "10", 1000, sdk.NewCoins(sdk.NewInt64Coin(baseDenom, 300)), address)
+	assert.NilError(t, err)
+	assert.Equal(t, "300"+baseDenom, trade.TokenIn.String())
+	assert.Equal(t, "300"+baseDenom, msg.(*pmtypes.MsgSwapExactAmountIn).TokenIn.String())
+
+	// A buy is capped at the idle quote
+	trade, _, err = Plan(cfg, basePool, "10", -1000, sdk.NewCoins(sdk.NewInt64Coin(usdcDenom, 2000)), address)
+	assert.NilError(t, err)
+	assert.Equal(t, "2000"+usdcDenom, trade.TokenIn.String())
+	assert.Equal(t, "200"+baseDenom, trade.ExpectedOut.String())
+
+	// Nothing is traded when the token in is fully deployed
+	trade, msg, err = Plan(cfg, basePool, "10", 1000, sdk.NewCoins(sdk.NewInt64Coin(usdcDenom, 2000)), address)
+	assert.NilError(t, err)
+	assert.Assert(t, trade == nil && msg == nil)
+}
+
+func TestSettle(t *testing.T) {
+	trade, _, err := Plan(types.Hedge{}, basePool, "10", -1000, idle, address)
+	assert.NilError(t, err)
+
+	events := []abci.Event{
+		{Type: "message"},
+		{Type: eventTokenSwapped, Attributes: []abci.EventAttribute{
+			{Key: pmtypes.AttributeKeyPoolId, Value: "2"},
+			{Key: pmtypes.AttributeKeyTokensIn, Value: "10000" + usdcDenom},
+			{Key: pmtypes.AttributeKeyTokensOut, Value: "1" + powerDenom},
+		}},
+		{Type: eventTokenSwapped, Attributes: []abci.EventAttribute{
+			{Key: pmtypes.AttributeKeyPoolId, Value: "1"},
+			{Key: pmtypes.AttributeKeyTokensIn, Value: "10000" + usdcDenom},
+			{Key: pmtypes.AttributeKeyTokensOut, Value: "997" + baseDenom},
+		}},
+	}
+
+	assert.Assert(t, trade.Settle(events, 1))
+	assert.Equal(t, "997"+baseDenom, trade.TokenOut.String())
+	// Three base short at a price of 10
+	assert.Equal(t, 30.0, trade.Cost)
+
+	assert.Assert(t, !trade.Settle(events[:2], 1))
+}
@@ -0,0 +1,295 @@
+// Package liquidation finds undercollateralised vaults on power contracts
+// and prices their liquidation. A liquidator repays vault debt with power
+// and receives the debt value in collateral plus a bonus, so a liquidation
+// is profitable when the bonus exceeds the cost of sourcing the power.
+package liquidation
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	sdkmath "cosmossdk.io/math"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	pmtypes "github.com/osmosis-labs/osmosis/v21/x/poolmanager/types"
+
+	"github.com/margined-protocol/flood/internal/maths"
+	"github.com/margined-protocol/flood/internal/power"
+	"github.com/margined-protocol/flood/internal/queries"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+const (
+	defaultLiquidationRatio = "1.5"
+	defaultBonus            = "0.1"
+	defaultMaxSlippage      = "0.02"
+
+	// maxEstimates bounds the estimates made sizing a power purchase
+	maxEstimates = 4
+)
+
+// Market prices the vaults of one power contract, in the base asset at the
+// index and at the power spot price, which is power per base asset.
+type Market struct {
+	BasePrice           string
+	PowerPrice          string
+	NormalisationFactor string
+	Power               maths.Power
+	// MinCollateralAmount is the least collateral a vault may keep, a vault
+	// left with less is liquidated in full
+	MinCollateralAmount string
+	// PoolID is the power pool power is bought from with the base asset
+	PoolID     uint64
+	PowerDenom string
+	BaseDenom  string
+}
+
+// Candidate is a vault below the liquidation ratio.
+type Candidate struct {
+	ID          uint64      `json:"id"`
+	Operator    string      `json:"operator"`
+	Collateral  sdkmath.Int `json:"collateral"`
+	ShortAmount sdkmath.Int `json:"short_amount"`
+	Ratio       float64     `json:"ratio"`
+}
+
+// Liquidation is a priced liquidation of a candidate.
+type Liquidation struct {
+	Candidate
+	// Repay is the debt repaid, from the wallet and any power bought
+	Repay sdk.Coin `json:"repay"`
+	// Held is the power of the repayment already in the wallet
+	Held sdk.Coin `json:"held"`
+	// Reward is the collateral received
+	Reward sdk.Coin `json:"reward"`
+	// SwapIn buys the power missing from the wallet, it is zero when the
+	// wallet holds enough
+	SwapIn       sdk.Coin `json:"swap_in"`
+	EstimatedOut sdk.Coin `json:"estimated_out"`
+	// Cost and Profit are in base asset units
+	Cost   float64 `json:"cost"`
+	Profit float64 `json:"profit"`
+}
+
+type params struct {
+	liquidationRatio float64
+	bonus            float64
+	slippage         float64
+	minProfit        float64
+}
+
+func parseParams(cfg types.Liquidation) (params, error) {
+	var p params
+	var err error
+
+	if p.liquidationRatio, err = strconv.ParseFloat(types.OrDefault(cfg.LiquidationRatio, defaultLiquidationRatio), 64); err != nil {
+		return p, fmt.Errorf("invalid liquidation ratio: %w", err)
+	}
+	if p.bonus, err = strconv.ParseFloat(types.OrDefault(cfg.Bonus, defaultBonus), 64); err != nil {
+		return p, fmt.Errorf("invalid bonus: %w", err)
+	}
+	if p.slippage, err = strconv.ParseFloat(types.OrDefault(cfg.MaxSlippage, defaultMaxSlippage), 64); err != nil {
+		return p, fmt.Errorf("invalid max slippage: %w", err)
+	}
+	minProfit, err := cfg.MinProfit.Int()
+	if err != nil {
+		return p, fmt.Errorf("invalid min profit: %w", err)
+	}
+	p.minProfit, _ = minProfit.ToLegacyDec().Float64()
+
+	switch {
+	case p.liquidationRatio < 1:
+		return p, fmt.Errorf("liquidation ratio must be at least 1")
+	case p.bonus < 0:
+		return p, fmt.Errorf("bonus must not be negative")
+	case p.slippage < 0 || p.slippage >= 1:
+		return p, fmt.Errorf("max slippage must be between 0 and 1")
+	}
+
+	return p, nil
+}
+
+// Find returns the vaults with debt whose collateral ratio at the index is
+// below the liquidation ratio, most undercollateralised first.
+func Find(cfg types.Liquidation, vaults []types.UserVault, market Market) ([]Candidate, error) {
+	p, err := parseParams(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []Candidate
+	for _, v := range vaults {
+		collateral, ok := sdkmath.NewIntFromString(v.Collateral)
+		if !ok {
+			return nil, fmt.Errorf("invalid collateral of vault %d: %s", v.ID, v.Collateral)
+		}
+		short, ok := sdkmath.NewIntFromString(v.ShortAmount)
+		if !ok {
+			return nil, fmt.Errorf("invalid short amount of vault %d: %s", v.ID, v.ShortAmount)
+		}
+		if !short.IsPositive() {
+			continue
+		}
+
+		ratio, err := market.Power.CollateralRatio(v.Collateral, v.ShortAmount, market.BasePrice, market.NormalisationFactor)
+		if err != nil {
+			return nil, fmt.Errorf("vault %d: %w", v.ID, err)
+		}
+		if ratio >= p.liquidationRatio {
+			continue
+		}
+
+		candidates = append(candidates, Candidate{
+			ID:          v.ID,
+			Operator:    v.Operator,
+			Collateral:  collateral,
+			ShortAmount: short,
+			Ratio:       ratio,
+		})
+	}
+
+	// Insertion sort keeps equal ratios in vault order
+	for i := 1; i < len(candidates); i++ {
+		for j := i; j > 0 && candidates[j].Ratio < candidates[j-1].Ratio; j-- {
+			candidates[j], candidates[j-1] = candidates[j-1], candidates[j]
+		}
+	}
+
+	return candidates, nil
+}
+
+// Plan prices the liquidation of a candidate. Half the debt is repaid unless
+// that would leave the vault with less than the minimum collateral, then all
+// of it is. Power held by the wallet is used first and, if allowed, the rest
+// is bought in the power pool. It returns nil if the power cannot be sourced
+// within the slippage limit or the profit is below the minimum.
+func Plan(ctx context.Context, est queries.Estimator, cfg types.Liquidation, market Market, c Candidate, powerBalance sdkmath.Int) (*Liquidation, error) {
+	p, err := parseParams(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	powerDenom, baseDenom := market.PowerDenom, market.BaseDenom
+	for _, denom := range []string{powerDenom, baseDenom} {
+		if err := sdk.ValidateDenom(denom); err != nil {
+			return nil, fmt.Errorf("invalid power pool: %w", err)
+		}
+	}
+
+	value, err := market.Power.PowerValue(market.BasePrice, market.NormalisationFactor)
+	if err != nil {
+		return nil, err
+	}
+	powerPrice, err := strconv.ParseFloat(market.PowerPrice, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid power price: %w", err)
+	}
+	if value <= 0 || powerPrice <= 0 {
+		return nil, fmt.Errorf("power price and value must be positive")
+	}
+
+	minCollateral := sdkmath.ZeroInt()
+	if market.MinCollateralAmount != "" {
+		var ok bool
+		if minCollateral, ok = sdkmath.NewIntFromString(market.MinCollateralAmount); !ok {
+			return nil, fmt.Errorf("invalid min collateral amount: %s", market.MinCollateralAmount)
+		}
+	}
+
+	reward := func(repay sdkmath.Int) sdkmath.Int {
+		debt, _ := repay.ToLegacyDec().Float64()
+		amount := sdkmath.NewInt(int64(math.Floor(debt * value * (1 + p.bonus))))
+		if amount.GT(c.Collateral) {
+			return c.Collateral
+		}
+		return amount
+	}
+
+	repay := c.ShortAmount.QuoRaw(2)
+	if c.Collateral.Sub(reward(repay)).LT(minCollateral) {
+		repay = c.ShortAmount
+	}
+
+	held := sdkmath.MinInt(powerBalance, repay)
+	shortfall := repay.Sub(held)
+	if shortfall.IsPositive() && !cfg.BuyPower {
+		repay, shortfall = held, sdkmath.ZeroInt()
+	}
+	if !repay.IsPositive() {
+		return nil, nil
+	}
+
+	l := &Liquidation{
+		Candidate:    c,
+		Repay:        sdk.NewCoin(powerDenom, repay),
+		Held:         sdk.NewCoin(powerDenom, held),
+		Reward:       sdk.NewCoin(baseDenom, reward(repay)),
+		SwapIn:       sdk.NewInt64Coin(baseDenom, 0),
+		EstimatedOut: sdk.NewInt64Coin(powerDenom, 0),
+	}
+
+	heldAmount, _ := held.ToLegacyDec().Float64()
+	l.Cost = heldAmount / powerPrice
+
+	if shortfall.IsPositive() {
+		needed, _ := shortfall.ToLegacyDec().Float64()
+		spot := needed / powerPrice
+
+		in := sdkmath.NewInt(int64(math.Ceil(spot)))
+		out := sdkmath.ZeroInt()
+		for i := 0; i < maxEstimates; i++ {
+			if out, err = est.EstimateSwap(ctx, market.PoolID, sdk.NewCoin(baseDenom, in), powerDenom); err != nil {
+				return nil, fmt.Errorf("failed to estimate purchase of %s: %w", sdk.NewCoin(powerDenom, shortfall), err)
+			}
+			if out.GTE(shortfall) || !out.IsPositive() {
+				break
+			}
+			// Scale the input by the fill so far
+			received, _ := out.ToLegacyDec().Float64()
+			paid, _ := in.ToLegacyDec().Float64()
+			in = sdkmath.NewInt(int64(math.Ceil(paid*needed/received)) + 1)
+		}
+
+		paid, _ := in.ToLegacyDec().Float64()
+		if out.LT(shortfall) || paid > spot*(1+p.slippage) {
+			return nil, nil
+		}
+
+		l.SwapIn = sdk.NewCoin(baseDenom, in)
+		l.EstimatedOut = sdk.NewCoin(powerDenom, out)
+
+		// Power bought beyond the debt stays in the wallet
+		excess, _ := out.Sub(shortfall).ToLegacyDec().Float64()
+		l.Cost += paid - excess/powerPrice
+	}
+
+	received, _ := l.Reward.Amount.ToLegacyDec().Float64()
+	l.Profit = received - l.Cost
+	if l.Profit < p.minProfit {
+		return nil, nil
+	}
+
+	return l, nil
+}
+
+// Msgs returns the purchase of any missing power followed by the
+// liquidation.
+func (l *Liquidation) Msgs(sender, contract string, powerPoolID uint64) ([]sdk.Msg, error) {
+	var msgs []sdk.Msg
+	if l.SwapIn.IsPositive() {
+		msgs = append(msgs, &pmtypes.MsgSwapExactAmountIn{
+			Sender:            sender,
+			Routes:            []pmtypes.SwapAmountInRoute{{PoolId: powerPoolID, TokenOutDenom: l.Repay.Denom}},
+			TokenIn:           l.SwapIn,
+			TokenOutMinAmount: l.Repay.Amount.Sub(l.Held.Amount),
+		})
+	}
+
+	liquidate, err := power.LiquidateMsg(sender, contract, l.ID, l.Repay)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(msgs, liquidate), nil
+}
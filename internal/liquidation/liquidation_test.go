@@ -0,0 +1,191 @@
+package liquidation
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	sdkmath "cosmossdk.io/math"
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/osmosis-labs/osmosis/osmomath"
+	clmath "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/math"
+	pmquery "github.com/osmosis-labs/osmosis/v21/x/poolmanager/client/queryproto"
+	pmtypes "github.com/osmosis-labs/osmosis/v21/x/poolmanager/types"
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/maths"
+	"github.com/margined-protocol/flood/internal/mock"
+	"github.com/margined-protocol/flood/internal/queries"
+	"github.com/margined-protocol/flood/internal/simulator"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+const (
+	baseDenom  = "uosmo"
+	powerDenom = "usqosmo"
+)
+
+// estimator buys power at the spot price less a fixed impact
+type estimator struct {
+	powerPrice float64
+	impact     float64
+	calls      []sdk.Coin
+}
+
+func (e *estimator) EstimateSwap(_ context.Context, _ uint64, tokenIn sdk.Coin, _ string) (sdkmath.Int, error) {
+	e.calls = append(e.calls, tokenIn)
+	return sdkmath.NewInt(int64(float64(tokenIn.Amount.Int64()) * e.powerPrice * (1 - e.impact))), nil
+}
+
+// One power is worth 0.001 base at the index and at spot
+var market = Market{
+	BasePrice:           "10",
+	PowerPrice:          "1000",
+	NormalisationFactor: "1",
+	Power:               maths.MustNewPower("2", 10000),
+	MinCollateralAmount: "0",
+	PoolID:              2,
+	PowerDenom:          powerDenom,
+	BaseDenom:           baseDenom,
+}
+
+func userVault(id uint64, collateral, short string) types.UserVault {
+	return types.UserVault{ID: id, GetVaultResponse: types.GetVaultResponse{Operator: "osmo1user", Collateral: collateral, ShortAmount: short}}
+}
+
+var vaults = []types.UserVault{
+	userVault(1, "1400", "1000000"),
+	userVault(2, "1000", "1000000"),
+	userVault(3, "2000", "1000000"),
+	userVault(4, "100", "0"),
+}
+
+func TestFind(t *testing.T) {
+	candidates, err := Find(types.Liquidation{}, vaults, market)
+	assert.NilError(t, err)
+
+	// Most undercollateralised first
+	assert.Equal(t, 2, len(candidates))
+	assert.Equal(t, uint64(2), candidates[0].ID)
+	assert.Equal(t, 1.0, candidates[0].Ratio)
+	assert.Equal(t, uint64(1), candidates[1].ID)
+	assert.Equal(t, "osmo1user", candidates[1].Operator)
+
+	_, err = Find(types.Liquidation{LiquidationRatio: "0.5"}, vaults, market)
+	assert.ErrorContains(t, err, "liquidation ratio")
+}
+
+func TestPlanFromWallet(t *testing.T) {
+	candidates, err := Find(types.Liquidation{}, vaults, market)
+	assert.NilError(t, err)
+	est := &estimator{powerPrice: 1000}
+
+	liq, err := Plan(context.Background(), est, types.Liquidation{}, market, candidates[1], sdkmath.NewInt(1_000_000))
+	assert.NilError(t, err)
+
+	// Half the debt for its value plus a 10% bonus
+	assert.Equal(t, "500000"+powerDenom, liq.Repay.String())
+	assert.Equal(t, "550"+baseDenom, liq.Reward.String())
+	assert.Equal(t, 500.0, liq.Cost)
+	assert.Equal(t, 50.0, liq.Profit)
+	assert.Equal(t, 0, len(est.calls))
+
+	msgs, err := liq.Msgs("osmo1bot", "osmo1power", 2)
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(msgs))
+	execute := msgs[0].(*wasmtypes.MsgExecuteContract)
+	assert.Equal(t, "500000"+powerDenom, execute.Funds.String())
+	var msg map[string]map[string]interface{}
+	assert.NilError(t, json.Unmarshal(execute.Msg, &msg))
+	assert.Equal(t, 1.0, msg["liquidate"]["vault_id"])
+	assert.Equal(t, "500000", msg["liquidate"]["max_debt_amount"])
+
+	// Half would leave the vault below the minimum collateral
+	m := market
+	m.MinCollateralAmount = "1000"
+	liq, err = Plan(context.Background(), est, types.Liquidation{}, m, candidates[1], sdkmath.NewInt(1_000_000))
+	assert.NilError(t, err)
+	assert.Equal(t, "1000000"+powerDenom, liq.Repay.String())
+	assert.Equal(t, "1100"+baseDenom, liq.Reward.String())
+
+	liq, err = Plan(context.Background(), est, types.Liquidation{MinProfit: types.RawAmount(sdkmath.NewInt(100))}, market, candidates[1], sdkmath.NewInt(1_000_000))
+	assert.NilError(t, err)
+	assert.Assert(t, liq == nil)
+
+	// Without power and not allowed to buy it
+	liq, err = Plan(context.Background(), est, types.Liquidation{}, market, candidates[1], sdkmath.ZeroInt())
+	assert.NilError(t, err)
+	assert.Assert(t, liq == nil)
+}
+
+func TestPlanBuysPower(t *testing.T) {
+	candidates, err := Find(types.Liquidation{}, vaults, market)
+	assert.NilError(t, err)
+	est := &estimator{powerPrice: 1000, impact: 0.01}
+	cfg := types.Liquidation{BuyPower: true}
+
+	liq, err := Plan(context.Background(), est, cfg, market, candidates[1], sdkmath.NewInt(200_000))
+	assert.NilError(t, err)
+
+	// 300 base falls short after the impact, 305 covers it
+	assert.Equal(t, 2, len(est.calls))
+	assert.Equal(t, "305"+baseDenom, liq.SwapIn.String())
+	assert.Equal(t, "301950"+powerDenom, liq.EstimatedOut.String())
+	assert.Equal(t, "200000"+powerDenom, liq.Held.String())
+	assert.Assert(t, liq.Profit > 46.9 && liq.Profit < 47)
+
+	msgs, err := liq.Msgs("osmo1bot", "osmo1power", 2)
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(msgs))
+	swap := msgs[0].(*pmtypes.MsgSwapExactAmountIn)
+	assert.Equal(t, powerDenom, swap.Routes[0].TokenOutDenom)
+	assert.Equal(t, int64(300_000), swap.TokenOutMinAmount.Int64())
+	_, ok := msgs[1].(*wasmtypes.MsgExecuteContract)
+	assert.Assert(t, ok)
+
+	// Paying 305 for 300 at spot is beyond 1% slippage
+	cfg.MaxSlippage = "0.01"
+	liq, err = Plan(context.Background(), est, cfg, market, candidates[1], sdkmath.NewInt(200_000))
+	assert.NilError(t, err)
+	assert.Assert(t, liq == nil)
+}
+
+func TestPlanWithChainSpotPrice(t *testing.T) {
+	chain := mock.NewChain()
+	chain.SetSpotPrice(1, baseDenom, "uusdc", "10")
+
+	// A pool created with power as token0 at 0.001 uosmo per usqosmo
+	tick, err := clmath.CalculatePriceToTick(osmomath.MustNewBigDecFromStr("0.001"))
+	assert.NilError(t, err)
+	pool, err := simulator.NewPool(2, powerDenom, baseDenom, 100, osmomath.MustNewDecFromStr("0.002"), tick)
+	assert.NilError(t, err)
+	chain.AddPool(pool)
+
+	conn, err := chain.Start()
+	assert.NilError(t, err)
+	defer chain.Stop()
+	defer conn.Close()
+
+	_, powerPrice, err := queries.GetSpotPrices(context.Background(), pmquery.NewQueryClient(conn), types.GetConfigResponse{
+		PowerAsset: types.Asset{Denom: powerDenom},
+		BasePool:   types.Pool{ID: 1, BaseDenom: baseDenom, QuoteDenom: "uusdc"},
+		PowerPool:  types.Pool{ID: 2, BaseDenom: powerDenom, QuoteDenom: baseDenom},
+	}, 0)
+	assert.NilError(t, err)
+
+	m := market
+	m.PowerPrice = powerPrice
+
+	candidates, err := Find(types.Liquidation{}, vaults, m)
+	assert.NilError(t, err)
+	est := &estimator{powerPrice: 1000, impact: 0.01}
+
+	liq, err := Plan(context.Background(), est, types.Liquidation{BuyPower: true}, m, candidates[1], sdkmath.NewInt(200_000))
+	assert.NilError(t, err)
+
+	// The 300000 power missing costs 300 base at 1000 power per base
+	assert.Equal(t, "305"+baseDenom, liq.SwapIn.String())
+	assert.Equal(t, "300"+baseDenom, est.calls[0].String())
+	assert.Assert(t, liq.Profit > 46.9 && liq.Profit < 47)
+}
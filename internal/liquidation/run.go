@@ -0,0 +1,249 @@
+package liquidation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	sdkmath "cosmossdk.io/math"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/ignite/cli/ignite/pkg/cosmosaccount"
+	"go.uber.org/zap"
+
+	"github.com/margined-protocol/flood/internal/engine"
+	"github.com/margined-protocol/flood/internal/notify"
+	"github.com/margined-protocol/flood/internal/power"
+	"github.com/margined-protocol/flood/internal/types"
+	"github.com/margined-protocol/flood/internal/units"
+)
+
+// Querier reads the state of one power contract.
+type Querier interface {
+	ConfigAndState(ctx context.Context) (types.GetConfigResponse, types.GetStateResponse, error)
+	SpotPrices(ctx context.Context, config types.GetConfigResponse) (string, string, error)
+	AllVaults(ctx context.Context, l *zap.Logger) ([]types.UserVault, error)
+	Balance(ctx context.Context, address, denom string) (sdk.Coin, error)
+	EstimateSwap(ctx context.Context, poolID uint64, tokenIn sdk.Coin, outDenom string) (sdkmath.Int, error)
+	DenomMetadata(ctx context.Context, denom string) (banktypes.Metadata, error)
+}
+
+// Result is the outcome of a liquidation attempt.
+type Result struct {
+	Contract    string       `json:"contract"`
+	Liquidation *Liquidation `json:"liquidation"`
+	TxHash      string       `json:"tx_hash,omitempty"`
+	Err         error        `json:"-"`
+}
+
+// Liquidator scans power contracts for undercollateralised vaults and
+// liquidates those that are profitable. Notifier is optional.
+type Liquidator struct {
+	Logger  *zap.Logger
+	Config  *types.Config
+	Account cosmosaccount.Account
+	Address string
+
+	// Querier returns the querier for a power contract
+	Querier     func(contract string) Querier
+	Broadcaster engine.Broadcaster
+	Simulator   engine.Simulator
+	Notifier    notify.Notifier
+
+	// DryRun prices and simulates liquidations without broadcasting them
+	DryRun bool
+}
+
+// Contracts returns the power contracts to scan.
+func (l *Liquidator) Contracts() []string {
+	if len(l.Config.PowerAddresses) > 0 {
+		return l.Config.PowerAddresses
+	}
+	return []string{l.Config.PowerPool.ContractAddress}
+}
+
+// Run scans every contract and attempts each profitable liquidation in its
+// own transaction. A failing contract or liquidation does not stop the
+// others, the errors are joined.
+func (l *Liquidator) Run(ctx context.Context) ([]Result, error) {
+	var results []Result
+	var errs []error
+
+	for _, contract := range l.Contracts() {
+		res, err := l.scan(ctx, contract)
+		results = append(results, res...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", contract, err))
+		}
+	}
+
+	return results, errors.Join(errs...)
+}
+
+func (l *Liquidator) scan(ctx context.Context, contract string) ([]Result, error) {
+	log := l.Logger.With(zap.String("contract", contract))
+	q := l.Querier(contract)
+
+	config, state, err := q.ConfigAndState(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config and state: %w", err)
+	}
+	if state.IsPaused {
+		log.Warn("Power contract is paused, skipping")
+		return nil, nil
+	}
+
+	powerDenom, baseDenom, err := config.PowerDenoms()
+	if err != nil {
+		return nil, err
+	}
+
+	// The min profit is an amount of the contract's base asset
+	cfg := l.Config.Liquidation
+	minProfit, err := units.NewRegistry(l.Config.Assets, q).Coin(ctx, baseDenom, cfg.MinProfit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid min_profit: %w", err)
+	}
+	cfg.MinProfit = types.RawAmount(minProfit.Amount)
+
+	basePrice, powerPrice, err := q.SpotPrices(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch spot prices: %w", err)
+	}
+
+	// The configured exponent describes the power pool's contract only
+	var exponent string
+	if contract == l.Config.PowerPool.ContractAddress {
+		exponent = l.Config.PowerPool.Exponent
+	}
+	pricing, err := power.Pricing(exponent, config)
+	if err != nil {
+		return nil, err
+	}
+
+	market := Market{
+		BasePrice:           basePrice,
+		PowerPrice:          powerPrice,
+		NormalisationFactor: state.NormalisationFactor,
+		Power:               pricing,
+		MinCollateralAmount: config.MinCollateralAmount,
+		PoolID:              config.PowerPool.ID,
+		PowerDenom:          powerDenom,
+		BaseDenom:           baseDenom,
+	}
+
+	vaults, err := q.AllVaults(ctx, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vaults: %w", err)
+	}
+
+	candidates, err := Find(cfg, vaults, market)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Scanned vaults", zap.Int("vaults", len(vaults)), zap.Int("undercollateralised", len(candidates)))
+
+	var results []Result
+	var errs []error
+
+	for _, c := range candidates {
+		// Power spent on an earlier liquidation is no longer held
+		balance, err := q.Balance(ctx, l.Address, powerDenom)
+		if err != nil {
+			return results, fmt.Errorf("failed to fetch power balance: %w", err)
+		}
+
+		liq, err := Plan(ctx, q, cfg, market, c, balance.Amount)
+		if err != nil {
+			return results, err
+		}
+		if liq == nil {
+			log.Info("Skipping vault, not profitable or no power to repay",
+				zap.Uint64("vault_id", c.ID),
+				zap.Float64("ratio", c.Ratio),
+			)
+			continue
+		}
+
+		res := l.liquidate(ctx, log, contract, config.PowerPool.ID, liq)
+		if res.Err != nil {
+			errs = append(errs, fmt.Errorf("vault %d: %w", c.ID, res.Err))
+		}
+		results = append(results, res)
+	}
+
+	return results, errors.Join(errs...)
+}
+
+func (l *Liquidator) liquidate(ctx context.Context, log *zap.Logger, contract string, powerPoolID uint64, liq *Liquidation) Result {
+	res := Result{Contract: contract, Liquidation: liq}
+
+	log.Info("Liquidation",
+		zap.Uint64("vault_id", liq.ID),
+		zap.String("operator", liq.Operator),
+		zap.Float64("ratio", liq.Ratio),
+		zap.String("repay", liq.Repay.String()),
+		zap.String("held", liq.Held.String()),
+		zap.String("swap_in", liq.SwapIn.String()),
+		zap.String("reward", liq.Reward.String()),
+		zap.Float64("profit", liq.Profit),
+	)
+
+	msgs, err := liq.Msgs(l.Address, contract, powerPoolID)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	if err := l.Simulator.Simulate(ctx, l.Account, msgs...); err != nil {
+		res.Err = fmt.Errorf("simulation failed: %w", err)
+		return res
+	}
+
+	if l.DryRun {
+		log.Info("Dry run, not broadcasting", zap.Reflect("msgs", msgs))
+		return res
+	}
+
+	txResp, err := l.Broadcaster.BroadcastTx(ctx, l.Account, msgs...)
+	if err == nil && txResp.TxResponse == nil {
+		err = errors.New("empty transaction response")
+	}
+	if err != nil {
+		res.Err = err
+		l.send(ctx, notify.Message{
+			Event:    notify.EventTxFailed,
+			Severity: notify.SeverityCritical,
+			Title:    "Liquidation transaction error",
+			Text:     err.Error(),
+		})
+		return res
+	}
+	res.TxHash = txResp.TxHash
+
+	l.send(ctx, notify.Message{
+		Event:    notify.EventLiquidated,
+		Severity: notify.SeverityInfo,
+		Title:    "Liquidated vault",
+		Fields: map[string]string{
+			"tx_hash":  res.TxHash,
+			"contract": contract,
+			"vault_id": fmt.Sprintf("%d", liq.ID),
+			"repay":    liq.Repay.String(),
+			"reward":   liq.Reward.String(),
+			"profit":   fmt.Sprintf("%f", liq.Profit),
+		},
+	})
+
+	return res
+}
+
+func (l *Liquidator) send(ctx context.Context, msg notify.Message) {
+	if l.Notifier == nil {
+		return
+	}
+	if err := l.Notifier.Notify(ctx, msg); err != nil {
+		l.Logger.Warn("Failed to send notification", zap.Error(err))
+	}
+}
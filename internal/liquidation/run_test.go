@@ -0,0 +1,157 @@
+package liquidation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/ignite/cli/ignite/pkg/cosmosaccount"
+	"github.com/ignite/cli/ignite/pkg/cosmosclient"
+	"go.uber.org/zap"
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+type fakeQuerier struct {
+	estimator
+	vaults []types.UserVault
+	power  int64
+	paused bool
+	err    error
+}
+
+func (q *fakeQuerier) ConfigAndState(context.Context) (types.GetConfigResponse, types.GetStateResponse, error) {
+	return types.GetConfigResponse{
+			PowerAsset:          types.Asset{Denom: powerDenom},
+			PowerPool:           types.Pool{ID: 2, BaseDenom: powerDenom, QuoteDenom: baseDenom},
+			IndexScale:          types.NewUint(10000),
+			MinCollateralAmount: "0",
+		},
+		types.GetStateResponse{NormalisationFactor: "1", IsPaused: q.paused},
+		q.err
+}
+
+func (q *fakeQuerier) SpotPrices(context.Context, types.GetConfigResponse) (string, string, error) {
+	return "10", "1000", nil
+}
+
+func (q *fakeQuerier) AllVaults(context.Context, *zap.Logger) ([]types.UserVault, error) {
+	return q.vaults, nil
+}
+
+// DenomMetadata gives every denom six decimals
+func (q *fakeQuerier) DenomMetadata(_ context.Context, denom string) (banktypes.Metadata, error) {
+	return banktypes.Metadata{DenomUnits: []*banktypes.DenomUnit{{Denom: denom, Exponent: 6}}}, nil
+}
+
+func (q *fakeQuerier) Balance(_ context.Context, _ string, denom string) (sdk.Coin, error) {
+	return sdk.NewInt64Coin(denom, q.power), nil
+}
+
+type fakeSimulator struct {
+	calls int
+	err   error
+}
+
+func (s *fakeSimulator) Simulate(context.Context, cosmosaccount.Account, ...sdk.Msg) error {
+	s.calls++
+	return s.err
+}
+
+type fakeBroadcaster struct {
+	sent [][]sdk.Msg
+}
+
+func (b *fakeBroadcaster) BroadcastTx(_ context.Context, _ cosmosaccount.Account, msgs ...sdk.Msg) (cosmosclient.Response, error) {
+	b.sent = append(b.sent, msgs)
+	return cosmosclient.Response{TxResponse: &sdk.TxResponse{TxHash: "HASH"}}, nil
+}
+
+func newLiquidator(queriers map[string]*fakeQuerier) (*Liquidator, *fakeSimulator, *fakeBroadcaster) {
+	sim, b := &fakeSimulator{}, &fakeBroadcaster{}
+	cfg := &types.Config{PowerAddresses: []string{"osmo1a", "osmo1b"}}
+
+	return &Liquidator{
+		Logger:  zap.NewNop(),
+		Config:  cfg,
+		Address: "osmo1bot",
+		Querier: func(contract string) Querier {
+			return queriers[contract]
+		},
+		Broadcaster: b,
+		Simulator:   sim,
+	}, sim, b
+}
+
+func TestRunLiquidates(t *testing.T) {
+	l, sim, b := newLiquidator(map[string]*fakeQuerier{
+		"osmo1a": {vaults: vaults, power: 2_000_000, estimator: estimator{powerPrice: 1000}},
+		"osmo1b": {err: errors.New("unavailable")},
+	})
+
+	results, err := l.Run(context.Background())
+	assert.ErrorContains(t, err, "osmo1b")
+	assert.ErrorContains(t, err, "unavailable")
+
+	// Both undercollateralised vaults on the healthy contract
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, "osmo1a", results[0].Contract)
+	assert.Equal(t, uint64(2), results[0].Liquidation.ID)
+	assert.Equal(t, "HASH", results[0].TxHash)
+	assert.Equal(t, 2, sim.calls)
+	assert.Equal(t, 2, len(b.sent))
+}
+
+func TestRunDryRun(t *testing.T) {
+	l, sim, b := newLiquidator(map[string]*fakeQuerier{
+		"osmo1a": {vaults: vaults, power: 2_000_000},
+		"osmo1b": {vaults: vaults, paused: true},
+	})
+	l.DryRun = true
+
+	results, err := l.Run(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, "", results[0].TxHash)
+	assert.Equal(t, 2, sim.calls)
+	assert.Equal(t, 0, len(b.sent))
+}
+
+func TestRunSimulationFails(t *testing.T) {
+	l, sim, b := newLiquidator(map[string]*fakeQuerier{
+		"osmo1a": {vaults: vaults[:1], power: 2_000_000},
+	})
+	l.Config.PowerAddresses = []string{"osmo1a"}
+	sim.err = errors.New("vault is safe")
+
+	results, err := l.Run(context.Background())
+	assert.ErrorContains(t, err, "vault 1: simulation failed")
+	assert.Assert(t, results[0].Err != nil)
+	assert.Equal(t, 0, len(b.sent))
+}
+
+func TestRunConvertsWholeMinProfit(t *testing.T) {
+	l, _, b := newLiquidator(map[string]*fakeQuerier{
+		"osmo1a": {vaults: vaults, power: 2_000_000},
+	})
+	l.Config.PowerAddresses = []string{"osmo1a"}
+
+	// A million whole base asset is more than any vault pays
+	l.Config.Liquidation.MinProfit = types.WholeAmount("1000000")
+	results, err := l.Run(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(results))
+
+	l.Config.Liquidation.MinProfit = types.WholeAmount("0.000001")
+	results, err = l.Run(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, 2, len(b.sent))
+
+	l.Config.Liquidation.MinProfit = types.WholeAmount("0.0000001")
+	_, err = l.Run(context.Background())
+	assert.ErrorContains(t, err, "invalid min_profit")
+}
@@ -0,0 +1,271 @@
+package liquidity
+
+import (
+	"errors"
+	"fmt"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/osmosis-labs/osmosis/osmomath"
+	"go.uber.org/zap"
+
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+const (
+	DistributionUniform     = "uniform"
+	DistributionLinear      = "linear"
+	DistributionExponential = "exponential"
+)
+
+const defaultDecay = "0.5"
+
+// band is a range on one side of the ladder expressed as offsets from the
+// reference price
+type band struct {
+	inner, outer osmomath.BigDec
+}
+
+// rung is a ladder range after conversion to ticks
+type rung struct {
+	lowerTick, upperTick int64
+	weight               osmomath.BigDec
+}
+
+// MarketMakeLadder splits each side into ladder.Ranges ranges between the
+// reference price and that side's spread. Inventory is shared between the ranges
+// according to the distribution, so liquidity is densest next to the price.
+func MarketMakeLadder(l *zap.Logger, poolId uint64, currentTick int64, spotPrice, targetPrice string, spreads Spreads, ladder types.Ladder, token0 sdk.Coin, token1 sdk.Coin, addr string) ([]sdk.Msg, error) {
+	spotPriceAsBigDec, err := osmomath.NewBigDecFromStr(spotPrice)
+	if err != nil {
+		l.Error("Failed to convert spot price to big dec", zap.Error(err))
+		return nil, err
+	}
+
+	targetPriceAsBigDec, err := osmomath.NewBigDecFromStr(targetPrice)
+	if err != nil {
+		l.Error("Failed to convert target price to big dec", zap.Error(err))
+		return nil, err
+	}
+
+	buySpread, sellSpread, gap, err := spreads.parse()
+	if err != nil {
+		l.Error("Failed to convert spread to big dec", zap.Error(err))
+		return nil, err
+	}
+
+	if spotPriceAsBigDec.LT(targetPriceAsBigDec) {
+		targetPriceAsBigDec, spotPriceAsBigDec = spotPriceAsBigDec, targetPriceAsBigDec
+	}
+
+	weights, err := ladderWeights(ladder.Ranges, ladder.Distribution, ladder.Decay)
+	if err != nil {
+		return nil, err
+	}
+
+	buyBands, err := ladderBands(ladder.Ranges, ladder.BuyOffsets, buySpread)
+	if err != nil {
+		return nil, fmt.Errorf("buy offsets: %w", err)
+	}
+
+	sellBands, err := ladderBands(ladder.Ranges, ladder.SellOffsets, sellSpread)
+	if err != nil {
+		return nil, fmt.Errorf("sell offsets: %w", err)
+	}
+
+	one := osmomath.OneBigDec()
+
+	// Each side is built innermost first. A rung left without ticks by the
+	// inner gap or rounding is dropped and its weight carried to the next
+	// rung out, and each rung is clipped to end where the previous begins,
+	// so the ranges never overlap and no share of the inventory is lost.
+	var buys, sells []rung
+	carry := osmomath.ZeroBigDec()
+	for i := range buyBands {
+		lower, err := calculateAndRoundPriceToTick(targetPriceAsBigDec.Mul(one.Sub(buyBands[i].outer)))
+		if err != nil {
+			return nil, err
+		}
+		upper, err := calculateAndRoundPriceToTick(targetPriceAsBigDec.Mul(one.Sub(buyBands[i].inner)))
+		if err != nil {
+			return nil, err
+		}
+
+		lower, upper = adjustForCurrentTick(l, true, currentTick, gap, lower, upper)
+		if n := len(buys); n > 0 && upper > buys[n-1].lowerTick {
+			upper = buys[n-1].lowerTick
+		}
+		if lower >= upper || upper > currentTick {
+			l.Debug("merging buy range outwards", zap.Int("range", i), zap.Int64("lowerTick", lower), zap.Int64("upperTick", upper))
+			carry = carry.Add(weights[i])
+			continue
+		}
+		buys = append(buys, rung{lowerTick: lower, upperTick: upper, weight: weights[i].Add(carry)})
+		carry = osmomath.ZeroBigDec()
+	}
+	if n := len(buys); n > 0 {
+		buys[n-1].weight = buys[n-1].weight.Add(carry)
+	}
+
+	carry = osmomath.ZeroBigDec()
+
+	for i := range sellBands {
+		lower, err := calculateAndRoundPriceToTick(spotPriceAsBigDec.Mul(one.Add(sellBands[i].inner)))
+		if err != nil {
+			return nil, err
+		}
+		upper, err := calculateAndRoundPriceToTick(spotPriceAsBigDec.Mul(one.Add(sellBands[i].outer)))
+		if err != nil {
+			return nil, err
+		}
+
+		lower, upper = adjustForCurrentTick(l, false, currentTick, gap, lower, upper)
+		if n := len(sells); n > 0 && lower < sells[n-1].upperTick {
+			lower = sells[n-1].upperTick
+		}
+		if lower >= upper || lower < currentTick {
+			l.Debug("merging sell range outwards", zap.Int("range", i), zap.Int64("lowerTick", lower), zap.Int64("upperTick", upper))
+			carry = carry.Add(weights[i])
+			continue
+		}
+		sells = append(sells, rung{lowerTick: lower, upperTick: upper, weight: weights[i].Add(carry)})
+		carry = osmomath.ZeroBigDec()
+	}
+	if n := len(sells); n > 0 {
+		sells[n-1].weight = sells[n-1].weight.Add(carry)
+	}
+
+	var msgs []sdk.Msg
+	for i, amount := range splitAmount(token1, buys) {
+		if amount.IsPositive() {
+			msgs = append(msgs, createPositionMsg(poolId, buys[i].lowerTick, buys[i].upperTick, sdk.NewCoins(amount), addr, true))
+		}
+	}
+	for i, amount := range splitAmount(token0, sells) {
+		if amount.IsPositive() {
+			msgs = append(msgs, createPositionMsg(poolId, sells[i].lowerTick, sells[i].upperTick, sdk.NewCoins(amount), addr, false))
+		}
+	}
+
+	if len(msgs) == 0 {
+		err := errors.New("no ladder ranges could be placed")
+		l.Error("Failed to calculate ladder", zap.Error(err))
+		return nil, err
+	}
+
+	l.Debug("ladder positions",
+		zap.Int("buyRanges", len(buys)),
+		zap.Int("sellRanges", len(sells)),
+		zap.Reflect("positions", msgs),
+	)
+
+	return msgs, nil
+}
+
+// ladderBands returns the offsets of each range on a side, without offsets
+// the spread is divided into equal bands
+func ladderBands(n int, offsets []string, spread osmomath.BigDec) ([]band, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("ranges must be positive, got %d", n)
+	}
+
+	inner := make([]osmomath.BigDec, n)
+	if len(offsets) == 0 {
+		for i := range inner {
+			inner[i] = spread.MulInt64(int64(i)).QuoInt64(int64(n))
+		}
+	} else {
+		if len(offsets) != n {
+			return nil, fmt.Errorf("expected %d offsets, got %d", n, len(offsets))
+		}
+		for i, o := range offsets {
+			offset, err := osmomath.NewBigDecFromStr(o)
+			if err != nil {
+				return nil, fmt.Errorf("invalid offset %q: %w", o, err)
+			}
+			if offset.IsNegative() || offset.GTE(spread) {
+				return nil, fmt.Errorf("offset %s must be at least 0 and less than the spread %s", o, spread)
+			}
+			if i > 0 && offset.LTE(inner[i-1]) {
+				return nil, fmt.Errorf("offsets must be increasing")
+			}
+			inner[i] = offset
+		}
+	}
+
+	bands := make([]band, n)
+	for i := range bands {
+		outer := spread
+		if i+1 < n {
+			outer = inner[i+1]
+		}
+		bands[i] = band{inner: inner[i], outer: outer}
+	}
+
+	return bands, nil
+}
+
+// ladderWeights returns the relative size of each range, innermost first
+func ladderWeights(n int, distribution, decay string) ([]osmomath.BigDec, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("ranges must be positive, got %d", n)
+	}
+
+	weights := make([]osmomath.BigDec, n)
+
+	switch distribution {
+	case "", DistributionUniform:
+		for i := range weights {
+			weights[i] = osmomath.OneBigDec()
+		}
+	case DistributionLinear:
+		for i := range weights {
+			weights[i] = osmomath.NewBigDec(int64(n - i))
+		}
+	case DistributionExponential:
+		if decay == "" {
+			decay = defaultDecay
+		}
+		ratio, err := osmomath.NewBigDecFromStr(decay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid decay %q: %w", decay, err)
+		}
+		if !ratio.IsPositive() || ratio.GT(osmomath.OneBigDec()) {
+			return nil, fmt.Errorf("decay must be in (0, 1], got %s", decay)
+		}
+		w := osmomath.OneBigDec()
+		for i := range weights {
+			weights[i] = w
+			w = w.Mul(ratio)
+		}
+	default:
+		return nil, fmt.Errorf("unknown distribution: %s", distribution)
+	}
+
+	return weights, nil
+}
+
+// splitAmount divides the coin between the rungs by weight, rounding down,
+// with the remainder going to the innermost rung
+func splitAmount(coin sdk.Coin, rungs []rung) []sdk.Coin {
+	if len(rungs) == 0 {
+		return nil
+	}
+
+	total := osmomath.ZeroBigDec()
+	for _, r := range rungs {
+		total = total.Add(r.weight)
+	}
+
+	amounts := make([]sdk.Coin, len(rungs))
+	remaining := coin.Amount
+	for i := len(rungs) - 1; i >= 0; i-- {
+		amount := osmomath.BigDecFromSDKInt(coin.Amount).Mul(rungs[i].weight).Quo(total).Dec().TruncateInt()
+		if i == 0 {
+			amount = remaining
+		}
+		remaining = remaining.Sub(amount)
+		amounts[i] = sdk.NewCoin(coin.Denom, amount)
+	}
+
+	return amounts
+}
@@ -0,0 +1,168 @@
+package liquidity
+
+import (
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/osmosis-labs/osmosis/osmomath"
+	cltypes "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/types"
+	"go.uber.org/zap"
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/simulator"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+func TestLadderWeights(t *testing.T) {
+	uniform, err := ladderWeights(3, "", "")
+	assert.NilError(t, err)
+	assert.Equal(t, "1.000000000000000000000000000000000000", uniform[2].String())
+
+	linear, err := ladderWeights(3, DistributionLinear, "")
+	assert.NilError(t, err)
+	assert.Equal(t, int64(3), linear[0].TruncateInt().Int64())
+	assert.Equal(t, int64(1), linear[2].TruncateInt().Int64())
+
+	exponential, err := ladderWeights(3, DistributionExponential, "0.5")
+	assert.NilError(t, err)
+	assert.Equal(t, "0.250000000000000000000000000000000000", exponential[2].String())
+
+	_, err = ladderWeights(3, "quadratic", "")
+	assert.ErrorContains(t, err, "unknown distribution")
+
+	_, err = ladderWeights(3, DistributionExponential, "1.5")
+	assert.ErrorContains(t, err, "decay")
+}
+
+func TestLadderBands(t *testing.T) {
+	spread := osmomath.MustNewBigDecFromStr("0.1")
+
+	equal, err := ladderBands(2, nil, spread)
+	assert.NilError(t, err)
+	assert.Assert(t, equal[0].inner.IsZero())
+	assert.Equal(t, "0.050000000000000000000000000000000000", equal[0].outer.String())
+	assert.Assert(t, equal[1].outer.Equal(spread))
+
+	offsets, err := ladderBands(3, []string{"0.01", "0.03", "0.06"}, spread)
+	assert.NilError(t, err)
+	assert.Equal(t, "0.030000000000000000000000000000000000", offsets[1].inner.String())
+	assert.Equal(t, "0.060000000000000000000000000000000000", offsets[1].outer.String())
+
+	_, err = ladderBands(2, []string{"0.05", "0.02"}, spread)
+	assert.ErrorContains(t, err, "increasing")
+
+	_, err = ladderBands(2, []string{"0.05"}, spread)
+	assert.ErrorContains(t, err, "expected 2 offsets")
+
+	_, err = ladderBands(1, []string{"0.2"}, spread)
+	assert.ErrorContains(t, err, "less than the spread")
+}
+
+func TestSplitAmountKeepsTotal(t *testing.T) {
+	weights, err := ladderWeights(3, DistributionExponential, "0.5")
+	assert.NilError(t, err)
+
+	rungs := make([]rung, len(weights))
+	for i, w := range weights {
+		rungs[i] = rung{weight: w}
+	}
+
+	amounts := splitAmount(sdk.NewInt64Coin("uosmo", 1000), rungs)
+	assert.Equal(t, int64(573), amounts[0].Amount.Int64())
+	assert.Equal(t, int64(285), amounts[1].Amount.Int64())
+	assert.Equal(t, int64(142), amounts[2].Amount.Int64())
+}
+
+func TestMarketMakeLadderMergesRungsInTheGap(t *testing.T) {
+	// Sell bands at 0-1%, 1-3%, 3-3.005% and 3.005-5%. The 1.5% inner gap
+	// swallows the first band and the third is narrower than a tick spacing.
+	ladder := types.Ladder{Ranges: 4, Distribution: DistributionLinear, SellOffsets: []string{"0", "0.01", "0.03", "0.03005"}}
+	msgs, err := MarketMakeLadder(zap.NewNop(), 1, 0, "1.0", "1.0", Spreads{Buy: "0.05", Sell: "0.05", InnerGap: 15000}, ladder,
+		sdk.NewInt64Coin(baseDenom, 1000), sdk.NewInt64Coin(quoteDenom, 0), testAddress)
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(msgs))
+
+	inner := msgs[0].(*cltypes.MsgCreatePosition)
+	outer := msgs[1].(*cltypes.MsgCreatePosition)
+	assert.Equal(t, int64(15000), inner.LowerTick)
+	assert.Equal(t, int64(30000), inner.UpperTick)
+	assert.Equal(t, int64(30000), outer.LowerTick)
+	assert.Equal(t, int64(50000), outer.UpperTick)
+
+	// The weights 4 and 3 go to the range past the gap, 2 and 1 to the range
+	// past the thin band
+	assert.Equal(t, "700"+baseDenom, inner.TokensProvided.String())
+	assert.Equal(t, "300"+baseDenom, outer.TokensProvided.String())
+}
+
+func TestMarketMakeLadderOnSimulatedPool(t *testing.T) {
+	logger := zap.NewNop()
+
+	pool, err := simulator.NewPool(1, baseDenom, quoteDenom, TICK_SPACING, osmomath.MustNewDecFromStr("0.002"), 0)
+	assert.NilError(t, err)
+
+	ladder := types.Ladder{Ranges: 3, Distribution: DistributionLinear, SellOffsets: []string{"0.01", "0.03", "0.06"}}
+	msgs, err := MarketMakeLadder(logger, 1, pool.CurrentTick(), "1.0", "1.0", Spreads{Buy: "0.1", Sell: "0.1"}, ladder,
+		sdk.NewInt64Coin(baseDenom, 600_000), sdk.NewInt64Coin(quoteDenom, 600_000), testAddress)
+	assert.NilError(t, err)
+	assert.Equal(t, 6, len(msgs))
+
+	// Buys step down from the price with shrinking sizes, sells step up
+	var prev *cltypes.MsgCreatePosition
+	for i, msg := range msgs {
+		m := msg.(*cltypes.MsgCreatePosition)
+		if i < 3 {
+			assert.Assert(t, m.UpperTick < 0)
+			assert.Equal(t, quoteDenom, m.TokensProvided[0].Denom)
+		} else {
+			assert.Assert(t, m.LowerTick > 0)
+			assert.Equal(t, baseDenom, m.TokensProvided[0].Denom)
+		}
+		if prev != nil && i != 3 {
+			assert.Assert(t, m.TokensProvided[0].Amount.LT(prev.TokensProvided[0].Amount))
+			if i < 3 {
+				assert.Assert(t, m.UpperTick <= prev.LowerTick)
+			} else {
+				assert.Assert(t, m.LowerTick >= prev.UpperTick)
+			}
+		}
+		prev = m
+	}
+
+	// First sell range starts 1% above the price
+	assert.Equal(t, int64(10000), msgs[3].(*cltypes.MsgCreatePosition).LowerTick)
+
+	results, err := pool.ApplyAll(msgs)
+	assert.NilError(t, err)
+	assert.Equal(t, 6, len(results))
+
+	// A small buy only fills the innermost sell range, the outer one is
+	// untouched apart from rounding
+	swap, err := pool.SwapExactAmountIn(sdk.NewInt64Coin(quoteDenom, 10_000))
+	assert.NilError(t, err)
+	assert.Assert(t, swap.TokenOut.Amount.IsPositive())
+
+	inner0, _, err := pool.PositionAmounts(results[3].PositionID)
+	assert.NilError(t, err)
+	assert.Assert(t, inner0.Amount.LT(results[3].Amount0))
+
+	outer0, _, err := pool.PositionAmounts(results[5].PositionID)
+	assert.NilError(t, err)
+	assert.Assert(t, results[5].Amount0.Sub(outer0.Amount).LTE(sdk.OneInt()))
+
+	// The next cycle withdraws all six ranges and redeploys their holdings
+	positions, err := pool.UserPositions(testAddress)
+	assert.NilError(t, err)
+
+	cfg := &types.Config{
+		PowerPool: types.PowerPool{PoolId: 1, BaseAsset: baseDenom, QuoteAsset: quoteDenom},
+		Position:  types.Position{Spread: "0.1", Ladder: ladder},
+	}
+
+	next, err := CreateUpdatePositionMsgs(logger, *positions, cfg, types.ConcentratedPool{ID: pool.ID, Token0: pool.Token0, Token1: pool.Token1, CurrentTick: pool.CurrentTick()}, testAddress, pool.SpotPrice().String(), "1.0")
+	assert.NilError(t, err)
+	assert.Equal(t, 12, len(next))
+
+	_, err = pool.ApplyAll(next)
+	assert.NilError(t, err)
+}
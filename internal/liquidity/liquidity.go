@@ -11,6 +11,8 @@ import (
 	model "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/model"
 	cltypes "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/types"
 	"go.uber.org/zap"
+
+	"github.com/margined-protocol/flood/internal/types"
 )
 
 const TICK_SPACING = int64(100)
@@ -68,8 +70,57 @@ func RemovePreviousPositions(l *zap.Logger, positions []model.FullPositionBreakd
 	return msgs
 }
 
+// Spreads are the widths of each side as a fraction of the price and the
+// minimum distance in ticks between the ranges and the current tick
+type Spreads struct {
+	Buy      string
+	Sell     string
+	InnerGap int64
+}
+
+// SpreadsFromConfig returns the spreads for the position config, the buy and
+// sell spreads default to the symmetric spread
+func SpreadsFromConfig(p types.Position) Spreads {
+	spreads := Spreads{Buy: p.BuySpread, Sell: p.SellSpread, InnerGap: p.InnerGap}
+	if spreads.Buy == "" {
+		spreads.Buy = p.Spread
+	}
+	if spreads.Sell == "" {
+		spreads.Sell = p.Spread
+	}
+	return spreads
+}
+
+// parse converts the spreads to big decs and applies the minimum inner gap
+func (s Spreads) parse() (osmomath.BigDec, osmomath.BigDec, int64, error) {
+	buy, err := osmomath.NewBigDecFromStr(s.Buy)
+	if err != nil {
+		return osmomath.BigDec{}, osmomath.BigDec{}, 0, fmt.Errorf("invalid buy spread %q: %w", s.Buy, err)
+	}
+
+	sell, err := osmomath.NewBigDecFromStr(s.Sell)
+	if err != nil {
+		return osmomath.BigDec{}, osmomath.BigDec{}, 0, fmt.Errorf("invalid sell spread %q: %w", s.Sell, err)
+	}
+
+	if !buy.IsPositive() || buy.GTE(osmomath.OneBigDec()) {
+		return osmomath.BigDec{}, osmomath.BigDec{}, 0, fmt.Errorf("buy spread must be between 0 and 1, got %s", s.Buy)
+	}
+
+	if !sell.IsPositive() {
+		return osmomath.BigDec{}, osmomath.BigDec{}, 0, fmt.Errorf("sell spread must be positive, got %s", s.Sell)
+	}
+
+	gap := s.InnerGap
+	if gap < TICK_SPACING {
+		gap = TICK_SPACING
+	}
+
+	return buy, sell, gap, nil
+}
+
 // marketMake creates a market making positions
-func MarketMake(l *zap.Logger, poolId uint64, currentTick int64, spotPrice, targetPrice, spread string, token0 sdk.Coin, token1 sdk.Coin, addr string) ([]sdk.Msg, error) {
+func MarketMake(l *zap.Logger, poolId uint64, currentTick int64, spotPrice, targetPrice string, spreads Spreads, token0 sdk.Coin, token1 sdk.Coin, addr string) ([]sdk.Msg, error) {
 	l.Debug("inputs",
 		zap.String("spotPrice", spotPrice),
 		zap.String("targetPrice", targetPrice),
@@ -87,7 +138,7 @@ func MarketMake(l *zap.Logger, poolId uint64, currentTick int64, spotPrice, targ
 		return nil, err
 	}
 
-	spreadAsBigDec, err := osmomath.NewBigDecFromStr(spread)
+	buySpread, sellSpread, gap, err := spreads.parse()
 	if err != nil {
 		l.Error("Failed to convert spread to big dec", zap.Error(err))
 		return nil, err
@@ -97,14 +148,14 @@ func MarketMake(l *zap.Logger, poolId uint64, currentTick int64, spotPrice, targ
 		targetPriceAsBigDec, spotPriceAsBigDec = spotPriceAsBigDec, targetPriceAsBigDec
 	}
 
-	buyTick, lowTick, sellTick, highTick, err := calculateBuySellTicks(l, targetPriceAsBigDec, spotPriceAsBigDec, spreadAsBigDec)
+	buyTick, lowTick, sellTick, highTick, err := calculateBuySellTicks(l, targetPriceAsBigDec, spotPriceAsBigDec, buySpread, sellSpread)
 	if err != nil {
 		l.Error("Failed to calculate buy and sell ticks", zap.Error(err))
 		return nil, err
 	}
 
-	lowTick, buyTick = adjustForCurrentTick(l, true, currentTick, lowTick, buyTick)
-	sellTick, highTick = adjustForCurrentTick(l, false, currentTick, sellTick, highTick)
+	lowTick, buyTick = adjustForCurrentTick(l, true, currentTick, gap, lowTick, buyTick)
+	sellTick, highTick = adjustForCurrentTick(l, false, currentTick, gap, sellTick, highTick)
 
 	if !(lowTick < buyTick && buyTick < sellTick && sellTick < highTick) {
 		err := errors.New("ticks are in the incorrect order")
@@ -115,56 +166,58 @@ func MarketMake(l *zap.Logger, poolId uint64, currentTick int64, spotPrice, targ
 	buyPosition := createPositionMsg(poolId, lowTick, buyTick, sdk.NewCoins(token1), addr, true)
 	sellPosition := createPositionMsg(poolId, sellTick, highTick, sdk.NewCoins(token0), addr, false)
 
-	fmt.Println("buyPosition", buyPosition)
-	fmt.Println("sellPosition", sellPosition)
+	l.Debug("positions",
+		zap.Reflect("buyPosition", buyPosition),
+		zap.Reflect("sellPosition", sellPosition),
+	)
 
 	return []sdk.Msg{buyPosition, sellPosition}, nil
 }
 
-func adjustForCurrentTick(l *zap.Logger, isBuy bool, currentTick, lowerTick, upperTick int64) (int64, int64) {
-
-	fmt.Println("lowerTick", lowerTick)
-
-	if lowerTick <= currentTick && currentTick <= upperTick {
-		fmt.Println("The value is within the range.")
-
-		if isBuy {
-			upperTick = currentTick - TICK_SPACING
-		} else {
-			lowerTick = currentTick + TICK_SPACING
-		}
+// adjustForCurrentTick keeps a range at least gap ticks from the current
+// tick, pulling the buy range's upper tick down or the sell range's lower
+// tick up, and rounds both ticks to the tick spacing away from the price
+func adjustForCurrentTick(l *zap.Logger, isBuy bool, currentTick, gap, lowerTick, upperTick int64) (int64, int64) {
+	if isBuy && upperTick > currentTick-gap {
+		l.Debug("buy range is within the inner gap",
+			zap.Int64("lowerTick", lowerTick),
+			zap.Int64("upperTick", upperTick),
+			zap.Int64("gap", gap),
+		)
+		upperTick = currentTick - gap
 	}
 
-	fmt.Println("lowerTick", lowerTick)
+	if !isBuy && lowerTick < currentTick+gap {
+		l.Debug("sell range is within the inner gap",
+			zap.Int64("lowerTick", lowerTick),
+			zap.Int64("upperTick", upperTick),
+			zap.Int64("gap", gap),
+		)
+		lowerTick = currentTick + gap
+	}
 
 	upperTick, err := clmath.RoundDownTickToSpacing(upperTick, TICK_SPACING)
 	if err != nil {
-		l.Error("Failed to calculate buy price tick", zap.Error(err))
+		l.Error("Failed to round upper tick", zap.Error(err))
 	}
 
 	lowerTick, err = clmath.RoundDownTickToSpacing(lowerTick, TICK_SPACING)
 	if err != nil {
-		l.Error("Failed to calculate buy price tick", zap.Error(err))
-	}
-
-	// Calculate the absolute difference
-	lowerDelta := currentTick - lowerTick
-	if lowerDelta < 0 {
-		lowerDelta = -lowerDelta
+		l.Error("Failed to round lower tick", zap.Error(err))
 	}
 
-	// Check if lowerDelta is less than TICK_SPACING and adjust lowerTick if necessary
-	if lowerDelta < TICK_SPACING {
-		lowerTick += (3 * TICK_SPACING)
+	// Rounding down may bring the sell range back inside the gap
+	if !isBuy && lowerTick < currentTick+gap {
+		lowerTick += TICK_SPACING
 	}
 
 	return lowerTick, upperTick
 }
 
-func calculateBuySellTicks(l *zap.Logger, buyPrice, sellPrice, spread osmomath.BigDec) (int64, int64, int64, int64, error) {
+func calculateBuySellTicks(l *zap.Logger, buyPrice, sellPrice, buySpread, sellSpread osmomath.BigDec) (int64, int64, int64, int64, error) {
 	// get the lower and upper bounds
-	buyLowerBound := buyPrice.Mul(osmomath.OneBigDec().Sub(spread))
-	sellUpperBound := sellPrice.Mul(osmomath.OneBigDec().Add(spread))
+	buyLowerBound := buyPrice.Mul(osmomath.OneBigDec().Sub(buySpread))
+	sellUpperBound := sellPrice.Mul(osmomath.OneBigDec().Add(sellSpread))
 
 	// Calculate the buy and sell ticks
 	buyPriceTick, err := calculateAndRoundPriceToTick(buyPrice)
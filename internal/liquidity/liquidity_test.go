@@ -3,9 +3,13 @@ package liquidity
 import (
 	"testing"
 
+	sdk "github.com/cosmos/cosmos-sdk/types"
 	"github.com/osmosis-labs/osmosis/osmomath"
+	cltypes "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/types"
 	"go.uber.org/zap"
 	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/types"
 )
 
 func TestCalculateBuySellTicksBasicFunctionality(t *testing.T) {
@@ -16,7 +20,7 @@ func TestCalculateBuySellTicksBasicFunctionality(t *testing.T) {
 	sellPrice, _ := osmomath.NewBigDecFromStr("1.0")
 	spread, _ := osmomath.NewBigDecFromStr("0.1") // 10% spread
 
-	buyPriceTick, buyLowerTick, sellPriceTick, sellUpperTick, _ := calculateBuySellTicks(logger, buyPrice, sellPrice, spread)
+	buyPriceTick, buyLowerTick, sellPriceTick, sellUpperTick, _ := calculateBuySellTicks(logger, buyPrice, sellPrice, spread, spread)
 
 	// Assertions
 	assert.Equal(t, int64(0), buyPriceTick, "Buy price tick should match expected value")
@@ -33,7 +37,7 @@ func TestCalculateBuySellTicksMidPriceLessThanOne(t *testing.T) {
 	sellPrice, _ := osmomath.NewBigDecFromStr("1.0")
 	spread, _ := osmomath.NewBigDecFromStr("0.1") // 10% spread
 
-	buyPriceTick, buyLowerTick, sellPriceTick, sellUpperTick, _ := calculateBuySellTicks(logger, buyPrice, sellPrice, spread)
+	buyPriceTick, buyLowerTick, sellPriceTick, sellUpperTick, _ := calculateBuySellTicks(logger, buyPrice, sellPrice, spread, spread)
 
 	// Assertions
 	assert.Equal(t, int64(-1000000), buyPriceTick, "Buy price tick should match expected value")
@@ -50,7 +54,7 @@ func TestCalculateBuySellTicksMidPriceGreaterThanOne(t *testing.T) {
 	sellPrice, _ := osmomath.NewBigDecFromStr("10.3")
 	spread, _ := osmomath.NewBigDecFromStr("0.1") // 10% spread
 
-	buyPriceTick, buyLowerTick, sellPriceTick, sellUpperTick, _ := calculateBuySellTicks(logger, buyPrice, sellPrice, spread)
+	buyPriceTick, buyLowerTick, sellPriceTick, sellUpperTick, _ := calculateBuySellTicks(logger, buyPrice, sellPrice, spread, spread)
 
 	// Assertions
 	assert.Equal(t, int64(9010000), buyPriceTick, "Buy price tick should match expected value")
@@ -67,7 +71,7 @@ func TestCalculateBuySellTicksValueUnderZero(t *testing.T) {
 	sellPrice, _ := osmomath.NewBigDecFromStr("0.18")
 	spread, _ := osmomath.NewBigDecFromStr("0.1") // 10% spread
 
-	buyPriceTick, buyLowerTick, sellPriceTick, sellUpperTick, _ := calculateBuySellTicks(logger, buyPrice, sellPrice, spread)
+	buyPriceTick, buyLowerTick, sellPriceTick, sellUpperTick, _ := calculateBuySellTicks(logger, buyPrice, sellPrice, spread, spread)
 
 	// Assertions
 	assert.Equal(t, int64(-8300000), buyPriceTick, "Buy price tick should match expected value")
@@ -75,3 +79,93 @@ func TestCalculateBuySellTicksValueUnderZero(t *testing.T) {
 	assert.Equal(t, int64(-8200000), sellPriceTick, "Sell price tick should match expected value")
 	assert.Equal(t, int64(-8020000), sellUpperTick, "Sell upper tick should match expected value")
 }
+
+func TestSpreadsFromConfig(t *testing.T) {
+	spreads := SpreadsFromConfig(types.Position{Spread: "0.1", SellSpread: "0.2", InnerGap: 500})
+
+	assert.Equal(t, "0.1", spreads.Buy)
+	assert.Equal(t, "0.2", spreads.Sell)
+	assert.Equal(t, int64(500), spreads.InnerGap)
+}
+
+func TestMarketMakeAsymmetricSpreadsAndInnerGap(t *testing.T) {
+	logger := zap.NewNop()
+
+	token0 := sdk.NewInt64Coin("uosmo", 1000)
+	token1 := sdk.NewInt64Coin("usqosmo", 1000)
+
+	msgs, err := MarketMake(logger, 1, 0, "1.0", "1.0", Spreads{Buy: "0.05", Sell: "0.2", InnerGap: 1000}, token0, token1, "osmo1")
+	assert.NilError(t, err)
+
+	buy := msgs[0].(*cltypes.MsgCreatePosition)
+	sell := msgs[1].(*cltypes.MsgCreatePosition)
+
+	assert.Equal(t, int64(-500000), buy.LowerTick)
+	assert.Equal(t, int64(-1000), buy.UpperTick)
+	assert.Equal(t, int64(1000), sell.LowerTick)
+	assert.Equal(t, int64(200000), sell.UpperTick)
+
+	_, err = MarketMake(logger, 1, 0, "1.0", "1.0", Spreads{Buy: "1", Sell: "0.2"}, token0, token1, "osmo1")
+	assert.ErrorContains(t, err, "buy spread must be between 0 and 1")
+}
+
+func TestAdjustForCurrentTickKeepsInnerGap(t *testing.T) {
+	logger := zap.NewNop()
+
+	// Rounding the sell range down would put it inside the gap
+	lower, upper := adjustForCurrentTick(logger, false, 150, 100, 0, 10000)
+	assert.Equal(t, int64(300), lower)
+	assert.Equal(t, int64(10000), upper)
+
+	lower, upper = adjustForCurrentTick(logger, true, 150, 100, -10000, 1000)
+	assert.Equal(t, int64(-10000), lower)
+	assert.Equal(t, int64(0), upper)
+
+	// Ranges already clear of the gap are only rounded
+	lower, upper = adjustForCurrentTick(logger, true, 0, TICK_SPACING, -10050, -5050)
+	assert.Equal(t, int64(-10100), lower)
+	assert.Equal(t, int64(-5100), upper)
+}
+
+func TestDefaultTokensFollowConfiguredDenoms(t *testing.T) {
+	cfg := &types.Config{
+		PowerPool: types.PowerPool{BaseAsset: "uosmo", QuoteAsset: "usqosmo"},
+		Position: types.Position{
+			DefaultToken0Amount: types.RawAmount(sdk.NewInt(1000000)),
+			DefaultToken1Amount: types.RawAmount(sdk.NewInt(1000)),
+		},
+	}
+
+	token0, token1, err := DefaultTokens(cfg, "uosmo", "usqosmo")
+	assert.NilError(t, err)
+	assert.Equal(t, "1000000uosmo", token0.String())
+	assert.Equal(t, "1000usqosmo", token1.String())
+
+	// A pool created in the other order
+	token0, token1, err = DefaultTokens(cfg, "usqosmo", "uosmo")
+	assert.NilError(t, err)
+	assert.Equal(t, "1000usqosmo", token0.String())
+	assert.Equal(t, "1000000uosmo", token1.String())
+
+	// Without configured assets the amounts are the pool's token0 and token1
+	cfg.PowerPool = types.PowerPool{}
+	token0, _, err = DefaultTokens(cfg, "usqosmo", "uosmo")
+	assert.NilError(t, err)
+	assert.Equal(t, "1000000usqosmo", token0.String())
+
+	cfg.PowerPool = types.PowerPool{BaseAsset: "uatom", QuoteAsset: "usqosmo"}
+	_, _, err = DefaultTokens(cfg, "uosmo", "usqosmo")
+	assert.ErrorContains(t, err, "power pool assets uatom/usqosmo are not the pool's tokens uosmo/usqosmo")
+}
+
+func TestPlaceSkipsEmptyRanges(t *testing.T) {
+	token0 := sdk.NewInt64Coin("uosmo", 1000)
+	token1 := sdk.NewInt64Coin("usqosmo", 0)
+
+	msgs, err := Place(zap.NewNop(), 1, 0, "1.0", "1.0", types.Position{Spread: "0.1"}, token0, token1, "osmo1")
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(msgs))
+
+	sell := msgs[0].(*cltypes.MsgCreatePosition)
+	assert.Equal(t, "1000uosmo", sell.TokensProvided.String())
+}
@@ -1,14 +1,21 @@
 package liquidity
 
 import (
+	"fmt"
+
 	sdk "github.com/cosmos/cosmos-sdk/types"
 	clquery "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/client/queryproto"
+	cltypes "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/types"
 	"go.uber.org/zap"
 
 	"github.com/margined-protocol/flood/internal/types"
 )
 
-func CreateUpdatePositionMsgs(l *zap.Logger, p clquery.UserPositionsResponse, cfg *types.Config, currentTick int64, address, powerPrice, targetPrice string) ([]sdk.Msg, error) {
+// CreateUpdatePositionMsgs replaces the positions held in the power pool,
+// whose price is token1 per token0. The power and target prices are pool
+// prices. A single position is only withdrawn, its tokens are deployed from
+// the wallet, and rebalanced, on the next cycle.
+func CreateUpdatePositionMsgs(l *zap.Logger, p clquery.UserPositionsResponse, cfg *types.Config, pool types.ConcentratedPool, address, powerPrice, targetPrice string) ([]sdk.Msg, error) {
 	var msgs []sdk.Msg
 
 	var token0 sdk.Coin
@@ -17,12 +24,11 @@ func CreateUpdatePositionMsgs(l *zap.Logger, p clquery.UserPositionsResponse, cf
 	if p.Positions == nil {
 		l.Info("No positions found")
 
-		token0.Amount = sdk.NewInt(cfg.Position.DefaultToken0Amount)
-		token0.Denom = cfg.PowerPool.BaseAsset
-
-		token1.Amount = sdk.NewInt(cfg.Position.DefaultToken1Amount)
-		token1.Denom = cfg.PowerPool.QuoteAsset
-
+		var err error
+		token0, token1, err = DefaultTokens(cfg, pool.Token0, pool.Token1)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if len(p.Positions) == 1 {
@@ -42,7 +48,7 @@ func CreateUpdatePositionMsgs(l *zap.Logger, p clquery.UserPositionsResponse, cf
 		return msgs, nil
 	}
 
-	if len(p.Positions) == 2 {
+	if len(p.Positions) >= 2 {
 		l.Info("Found open positions")
 
 		l.Debug("existing positions",
@@ -56,8 +62,13 @@ func CreateUpdatePositionMsgs(l *zap.Logger, p clquery.UserPositionsResponse, cf
 			zap.Reflect("removeMsgs", removeMsgs),
 		)
 
-		amount0 := p.Positions[0].Asset0.AddAmount(p.Positions[1].Asset0.Amount)
-		amount1 := p.Positions[0].Asset1.AddAmount(p.Positions[1].Asset1.Amount)
+		// Redeploy everything held across the ladder
+		amount0 := p.Positions[0].Asset0
+		amount1 := p.Positions[0].Asset1
+		for _, position := range p.Positions[1:] {
+			amount0 = amount0.AddAmount(position.Asset0.Amount)
+			amount1 = amount1.AddAmount(position.Asset1.Amount)
+		}
 
 		token0 = sdk.NewCoin(p.Positions[0].Asset0.Denom, amount0.Amount)
 		token1 = sdk.NewCoin(p.Positions[0].Asset1.Denom, amount1.Amount)
@@ -68,12 +79,95 @@ func CreateUpdatePositionMsgs(l *zap.Logger, p clquery.UserPositionsResponse, cf
 		)
 	}
 
-	positionMsgs, err := MarketMake(l, cfg.PowerPool.PoolId, currentTick, powerPrice, targetPrice, cfg.Position.Spread, token0, token1, address)
+	// Swap back towards the target ratio before the new positions, whether
+	// deploying the wallet for the first time or redeploying the ladder
+	if cfg.Position.Rebalance.Enabled {
+		swapMsg, amount0, amount1, err := Rebalance(l, cfg.Position.Rebalance, pool.ID, powerPrice, token0, token1, address)
+		if err != nil {
+			l.Error("Failed to rebalance inventory", zap.Error(err))
+			return nil, err
+		}
+		if swapMsg != nil {
+			msgs = append(msgs, swapMsg)
+			token0, token1 = amount0, amount1
+		}
+	}
+
+	positionMsgs, err := Place(l, pool.ID, pool.CurrentTick, powerPrice, targetPrice, cfg.Position, token0, token1, address)
 	if err != nil {
-		l.Fatal("Failed to market make", zap.Error(err))
+		l.Error("Failed to market make", zap.Error(err))
 		return nil, err
 	}
 
 	return append(msgs, positionMsgs...), nil
 
 }
+
+// Place creates the positions for the configured strategy, a ladder if
+// ranges are configured and a single range on each side otherwise. Ranges
+// with nothing to provide are left out.
+func Place(l *zap.Logger, poolId uint64, currentTick int64, spotPrice, targetPrice string, position types.Position, token0, token1 sdk.Coin, addr string) ([]sdk.Msg, error) {
+	spreads := SpreadsFromConfig(position)
+
+	var msgs []sdk.Msg
+	var err error
+	if position.Ladder.Ranges > 0 {
+		msgs, err = MarketMakeLadder(l, poolId, currentTick, spotPrice, targetPrice, spreads, position.Ladder, token0, token1, addr)
+	} else {
+		msgs, err = MarketMake(l, poolId, currentTick, spotPrice, targetPrice, spreads, token0, token1, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	funded := msgs[:0]
+	for _, msg := range msgs {
+		if create, ok := msg.(*cltypes.MsgCreatePosition); ok && create.TokensProvided.Empty() {
+			l.Info("Skipping range with nothing to provide", zap.Int64("lower_tick", create.LowerTick), zap.Int64("upper_tick", create.UpperTick))
+			continue
+		}
+		funded = append(funded, msg)
+	}
+
+	return funded, nil
+}
+
+// DefaultDenoms returns the denoms of the default amounts, the configured
+// base and quote assets or else the pool's token0 and token1.
+func DefaultDenoms(pool types.PowerPool, token0Denom, token1Denom string) (string, string) {
+	base, quote := pool.BaseAsset, pool.QuoteAsset
+	if base == "" {
+		base = token0Denom
+	}
+	if quote == "" {
+		quote = token1Denom
+	}
+	return base, quote
+}
+
+// DefaultTokens returns the inventory deployed when no positions are open
+// as the pool's token0 and token1. default_token_0_amount is in the base
+// asset and default_token_1_amount in the quote asset, so the amounts are
+// swapped for a pool created in the other order. Amounts in whole units must
+// be converted before.
+func DefaultTokens(cfg *types.Config, token0Denom, token1Denom string) (sdk.Coin, sdk.Coin, error) {
+	amount0, err := cfg.Position.DefaultToken0Amount.Int()
+	if err != nil {
+		return sdk.Coin{}, sdk.Coin{}, err
+	}
+	amount1, err := cfg.Position.DefaultToken1Amount.Int()
+	if err != nil {
+		return sdk.Coin{}, sdk.Coin{}, err
+	}
+
+	base, quote := DefaultDenoms(cfg.PowerPool, token0Denom, token1Denom)
+	switch {
+	case base == token0Denom && quote == token1Denom:
+	case base == token1Denom && quote == token0Denom:
+		amount0, amount1 = amount1, amount0
+	default:
+		return sdk.Coin{}, sdk.Coin{}, fmt.Errorf("power pool assets %s/%s are not the pool's tokens %s/%s", base, quote, token0Denom, token1Denom)
+	}
+
+	return sdk.Coin{Denom: token0Denom, Amount: amount0}, sdk.Coin{Denom: token1Denom, Amount: amount1}, nil
+}
@@ -0,0 +1,143 @@
+package liquidity
+
+import (
+	"fmt"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/osmosis-labs/osmosis/osmomath"
+	pmtypes "github.com/osmosis-labs/osmosis/v21/x/poolmanager/types"
+	"go.uber.org/zap"
+
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+const (
+	defaultTargetRatio = "0.5"
+	defaultBand        = "0.2"
+	defaultMaxSlippage = "0.01"
+)
+
+// rebalanceParams are the parsed rebalance settings
+type rebalanceParams struct {
+	target   osmomath.Dec
+	band     osmomath.Dec
+	slippage osmomath.Dec
+}
+
+func parseRebalance(cfg types.Rebalance) (rebalanceParams, error) {
+	var p rebalanceParams
+	var err error
+
+	if p.target, err = decOrDefault(cfg.TargetRatio, defaultTargetRatio); err != nil {
+		return p, fmt.Errorf("invalid target ratio: %w", err)
+	}
+	if p.band, err = decOrDefault(cfg.Band, defaultBand); err != nil {
+		return p, fmt.Errorf("invalid band: %w", err)
+	}
+	if p.slippage, err = decOrDefault(cfg.MaxSlippage, defaultMaxSlippage); err != nil {
+		return p, fmt.Errorf("invalid max slippage: %w", err)
+	}
+
+	one := osmomath.OneDec()
+	if !p.target.IsPositive() || p.target.GTE(one) {
+		return p, fmt.Errorf("target ratio must be between 0 and 1")
+	}
+	if p.band.IsNegative() || p.band.GTE(one) {
+		return p, fmt.Errorf("band must be between 0 and 1")
+	}
+	if p.slippage.IsNegative() || p.slippage.GTE(one) {
+		return p, fmt.Errorf("max slippage must be between 0 and 1")
+	}
+
+	return p, nil
+}
+
+func decOrDefault(value, fallback string) (osmomath.Dec, error) {
+	if value == "" {
+		value = fallback
+	}
+	return osmomath.NewDecFromStr(value)
+}
+
+// Rebalance swaps the surplus asset back towards the target ratio when the
+// share of inventory value held in token0 has left the band. The price is the
+// pool price in token1 per token0. It returns the swap, or nil if none is
+// needed, and the amounts to deploy assuming the swap fills at its minimum.
+// The new ranges are placed from the pre-swap tick, so swaps should be small
+// against the pool depth or the inner gap wide enough to absorb the impact.
+func Rebalance(l *zap.Logger, cfg types.Rebalance, poolId uint64, price string, token0, token1 sdk.Coin, addr string) (sdk.Msg, sdk.Coin, sdk.Coin, error) {
+	params, err := parseRebalance(cfg)
+	if err != nil {
+		return nil, token0, token1, err
+	}
+
+	priceAsBigDec, err := osmomath.NewBigDecFromStr(price)
+	if err != nil {
+		return nil, token0, token1, fmt.Errorf("invalid price: %w", err)
+	}
+	p := priceAsBigDec.Dec()
+	if !p.IsPositive() {
+		return nil, token0, token1, fmt.Errorf("price must be positive")
+	}
+
+	value0 := token0.Amount.ToLegacyDec().Mul(p)
+	total := value0.Add(token1.Amount.ToLegacyDec())
+	if !total.IsPositive() {
+		return nil, token0, token1, nil
+	}
+
+	ratio := value0.Quo(total)
+	l.Debug("inventory ratio",
+		zap.String("ratio", ratio.String()),
+		zap.String("target", params.target.String()),
+		zap.String("band", params.band.String()),
+	)
+
+	if ratio.Sub(params.target).Abs().LTE(params.band) {
+		return nil, token0, token1, nil
+	}
+
+	// Surplus value in token1 units either side of the target
+	surplus := value0.Sub(total.Mul(params.target))
+
+	var tokenIn sdk.Coin
+	var expectedOut osmomath.Dec
+	var outDenom string
+	if surplus.IsPositive() {
+		tokenIn = sdk.NewCoin(token0.Denom, surplus.Quo(p).TruncateInt())
+		expectedOut = tokenIn.Amount.ToLegacyDec().Mul(p)
+		outDenom = token1.Denom
+	} else {
+		tokenIn = sdk.NewCoin(token1.Denom, surplus.Neg().TruncateInt())
+		expectedOut = tokenIn.Amount.ToLegacyDec().Quo(p)
+		outDenom = token0.Denom
+	}
+
+	minOut := expectedOut.Mul(osmomath.OneDec().Sub(params.slippage)).TruncateInt()
+	if !tokenIn.Amount.IsPositive() || !minOut.IsPositive() {
+		return nil, token0, token1, nil
+	}
+
+	msg := &pmtypes.MsgSwapExactAmountIn{
+		Sender:            addr,
+		Routes:            []pmtypes.SwapAmountInRoute{{PoolId: poolId, TokenOutDenom: outDenom}},
+		TokenIn:           tokenIn,
+		TokenOutMinAmount: minOut,
+	}
+
+	l.Info("Rebalancing inventory",
+		zap.String("ratio", ratio.String()),
+		zap.String("tokenIn", tokenIn.String()),
+		zap.String("minOut", minOut.String()+outDenom),
+	)
+
+	if tokenIn.Denom == token0.Denom {
+		token0 = token0.Sub(tokenIn)
+		token1 = token1.AddAmount(minOut)
+	} else {
+		token1 = token1.Sub(tokenIn)
+		token0 = token0.AddAmount(minOut)
+	}
+
+	return msg, token0, token1, nil
+}
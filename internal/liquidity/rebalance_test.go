@@ -0,0 +1,174 @@
+package liquidity
+
+import (
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/osmosis-labs/osmosis/osmomath"
+	clquery "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/client/queryproto"
+	pmtypes "github.com/osmosis-labs/osmosis/v21/x/poolmanager/types"
+	"go.uber.org/zap"
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/simulator"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+func TestRebalanceWithinBand(t *testing.T) {
+	cfg := types.Rebalance{Enabled: true, Band: "0.2"}
+
+	msg, token0, token1, err := Rebalance(zap.NewNop(), cfg, 1, "2.0",
+		sdk.NewInt64Coin(baseDenom, 600), sdk.NewInt64Coin(quoteDenom, 1000), testAddress)
+	assert.NilError(t, err)
+	assert.Assert(t, msg == nil)
+	assert.Equal(t, int64(600), token0.Amount.Int64())
+	assert.Equal(t, int64(1000), token1.Amount.Int64())
+}
+
+func TestRebalanceSwapsSurplus(t *testing.T) {
+	cfg := types.Rebalance{Enabled: true, Band: "0.1", MaxSlippage: "0.01"}
+
+	// 1000 token0 at a price of 2 is worth 2000 token1, all held in token0
+	msg, token0, token1, err := Rebalance(zap.NewNop(), cfg, 1, "2.0",
+		sdk.NewInt64Coin(baseDenom, 1000), sdk.NewInt64Coin(quoteDenom, 0), testAddress)
+	assert.NilError(t, err)
+
+	swap, ok := msg.(*pmtypes.MsgSwapExactAmountIn)
+	assert.Assert(t, ok)
+	assert.Equal(t, testAddress, swap.Sender)
+	assert.Equal(t, 1, len(swap.Routes))
+	assert.Equal(t, uint64(1), swap.Routes[0].PoolId)
+	assert.Equal(t, quoteDenom, swap.Routes[0].TokenOutDenom)
+	assert.Equal(t, "500"+baseDenom, swap.TokenIn.String())
+	assert.Equal(t, int64(990), swap.TokenOutMinAmount.Int64())
+
+	assert.Equal(t, int64(500), token0.Amount.Int64())
+	assert.Equal(t, int64(990), token1.Amount.Int64())
+
+	// And the other way when holding only token1
+	msg, token0, token1, err = Rebalance(zap.NewNop(), cfg, 1, "2.0",
+		sdk.NewInt64Coin(baseDenom, 0), sdk.NewInt64Coin(quoteDenom, 2000), testAddress)
+	assert.NilError(t, err)
+
+	swap, ok = msg.(*pmtypes.MsgSwapExactAmountIn)
+	assert.Assert(t, ok)
+	assert.Equal(t, baseDenom, swap.Routes[0].TokenOutDenom)
+	assert.Equal(t, "1000"+quoteDenom, swap.TokenIn.String())
+	assert.Equal(t, int64(495), swap.TokenOutMinAmount.Int64())
+	assert.Equal(t, int64(495), token0.Amount.Int64())
+	assert.Equal(t, int64(1000), token1.Amount.Int64())
+}
+
+func TestRebalanceInvalidConfig(t *testing.T) {
+	tokens := []sdk.Coin{sdk.NewInt64Coin(baseDenom, 1000), sdk.NewInt64Coin(quoteDenom, 0)}
+
+	for _, cfg := range []types.Rebalance{
+		{TargetRatio: "1.5"},
+		{Band: "-0.1"},
+		{MaxSlippage: "1"},
+		{TargetRatio: "half"},
+	} {
+		_, _, _, err := Rebalance(zap.NewNop(), cfg, 1, "2.0", tokens[0], tokens[1], testAddress)
+		assert.Assert(t, err != nil, "%+v", cfg)
+	}
+}
+
+func TestRebalanceOnSimulatedPool(t *testing.T) {
+	logger := zap.NewNop()
+
+	pool, err := simulator.NewPool(1, baseDenom, quoteDenom, TICK_SPACING, osmomath.MustNewDecFromStr("0.002"), 0)
+	assert.NilError(t, err)
+
+	// Deep liquidity from another provider absorbs the rebalancing swap
+	_, err = pool.CreatePosition("osmo1lp", -9_000_000, 9_000_000,
+		sdk.NewCoins(sdk.NewInt64Coin(baseDenom, 1_000_000_000_000), sdk.NewInt64Coin(quoteDenom, 1_000_000_000_000)))
+	assert.NilError(t, err)
+
+	msgs, err := MarketMake(logger, 1, pool.CurrentTick(), "1.0", "0.9", Spreads{Buy: "0.1", Sell: "0.1"},
+		sdk.NewInt64Coin(baseDenom, 1_000_000), sdk.NewInt64Coin(quoteDenom, 1_000_000), testAddress)
+	assert.NilError(t, err)
+	_, err = pool.ApplyAll(msgs)
+	assert.NilError(t, err)
+
+	// Sell heavily into the buy range so the inventory is mostly token0
+	_, err = pool.SwapExactAmountIn(sdk.NewInt64Coin(baseDenom, 100_000_000_000))
+	assert.NilError(t, err)
+
+	positions, err := pool.UserPositions(testAddress)
+	assert.NilError(t, err)
+
+	cfg := &types.Config{
+		PowerPool: types.PowerPool{PoolId: 1, BaseAsset: baseDenom, QuoteAsset: quoteDenom},
+		Position: types.Position{
+			Spread:    "0.1",
+			Rebalance: types.Rebalance{Enabled: true, Band: "0.1", MaxSlippage: "0.02"},
+		},
+	}
+
+	next, err := CreateUpdatePositionMsgs(logger, *positions, cfg, types.ConcentratedPool{ID: pool.ID, Token0: pool.Token0, Token1: pool.Token1, CurrentTick: pool.CurrentTick()}, testAddress, pool.SpotPrice().String(), "1.0")
+	assert.NilError(t, err)
+	assert.Equal(t, 5, len(next))
+
+	// The swap follows the withdrawals and comes before the new positions
+	swap, ok := next[2].(*pmtypes.MsgSwapExactAmountIn)
+	assert.Assert(t, ok)
+	assert.Equal(t, baseDenom, swap.TokenIn.Denom)
+
+	results, err := pool.ApplyAll(next)
+	assert.NilError(t, err)
+	assert.Assert(t, results[2].Swap != nil)
+	assert.Assert(t, results[2].Swap.TokenOut.Amount.GTE(swap.TokenOutMinAmount))
+	assert.Equal(t, 2, len(pool.Positions(testAddress)))
+}
+
+func TestRebalanceOnFirstDeploy(t *testing.T) {
+	logger := zap.NewNop()
+
+	pool, err := simulator.NewPool(1, baseDenom, quoteDenom, TICK_SPACING, osmomath.MustNewDecFromStr("0.002"), 0)
+	assert.NilError(t, err)
+	_, err = pool.CreatePosition("osmo1lp", -9_000_000, 9_000_000,
+		sdk.NewCoins(sdk.NewInt64Coin(baseDenom, 1_000_000_000_000), sdk.NewInt64Coin(quoteDenom, 1_000_000_000_000)))
+	assert.NilError(t, err)
+
+	// The wallet only holds token0
+	cfg := &types.Config{
+		PowerPool: types.PowerPool{PoolId: 1, BaseAsset: baseDenom, QuoteAsset: quoteDenom},
+		Position: types.Position{
+			Spread:              "0.1",
+			DefaultToken0Amount: types.RawAmount(sdk.NewInt(1_000_000)),
+			DefaultToken1Amount: types.RawAmount(sdk.ZeroInt()),
+			Rebalance:           types.Rebalance{Enabled: true, Band: "0.1", MaxSlippage: "0.02"},
+		},
+	}
+
+	msgs, err := CreateUpdatePositionMsgs(logger, clquery.UserPositionsResponse{}, cfg, types.ConcentratedPool{ID: pool.ID, Token0: pool.Token0, Token1: pool.Token1, CurrentTick: pool.CurrentTick()}, testAddress, pool.SpotPrice().String(), "1.0")
+	assert.NilError(t, err)
+	assert.Equal(t, 3, len(msgs))
+
+	// Half is swapped to token1 before both ranges are placed
+	swap, ok := msgs[0].(*pmtypes.MsgSwapExactAmountIn)
+	assert.Assert(t, ok)
+	assert.Equal(t, "500000"+baseDenom, swap.TokenIn.String())
+
+	results, err := pool.ApplyAll(msgs)
+	assert.NilError(t, err)
+	assert.Assert(t, results[0].Swap != nil)
+	assert.Equal(t, 2, len(pool.Positions(testAddress)))
+}
+
+func TestSimulatedSwapEnforcesMinOut(t *testing.T) {
+	pool, err := simulator.NewPool(1, baseDenom, quoteDenom, TICK_SPACING, osmomath.MustNewDecFromStr("0.002"), 0)
+	assert.NilError(t, err)
+
+	_, err = pool.CreatePosition("osmo1lp", -1000, 1000,
+		sdk.NewCoins(sdk.NewInt64Coin(baseDenom, 1_000_000), sdk.NewInt64Coin(quoteDenom, 1_000_000)))
+	assert.NilError(t, err)
+
+	_, err = pool.Apply(&pmtypes.MsgSwapExactAmountIn{
+		Sender:            testAddress,
+		Routes:            []pmtypes.SwapAmountInRoute{{PoolId: 1, TokenOutDenom: quoteDenom}},
+		TokenIn:           sdk.NewInt64Coin(baseDenom, 1000),
+		TokenOutMinAmount: sdk.NewInt(1000),
+	})
+	assert.ErrorContains(t, err, "below minimum")
+}
@@ -0,0 +1,74 @@
+package liquidity
+
+import (
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/osmosis-labs/osmosis/osmomath"
+	"go.uber.org/zap"
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/simulator"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+const (
+	testAddress = "osmo1trader"
+	baseDenom   = "uosmo"
+	quoteDenom  = "usqosmo"
+)
+
+func TestMarketMakeOnSimulatedPool(t *testing.T) {
+	logger := zap.NewNop()
+
+	pool, err := simulator.NewPool(1, baseDenom, quoteDenom, TICK_SPACING, osmomath.MustNewDecFromStr("0.002"), 0)
+	assert.NilError(t, err)
+
+	msgs, err := MarketMake(logger, 1, pool.CurrentTick(), "1.0", "0.9", Spreads{Buy: "0.1", Sell: "0.1"},
+		sdk.NewInt64Coin(baseDenom, 1_000_000), sdk.NewInt64Coin(quoteDenom, 1_000_000), testAddress)
+	assert.NilError(t, err)
+
+	results, err := pool.ApplyAll(msgs)
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(results))
+
+	// Neither range contains the current price, so each is single sided
+	buy, sell := results[0], results[1]
+	assert.Assert(t, buy.Amount0.IsZero())
+	assert.Equal(t, int64(1_000_000), buy.Amount1.Int64())
+	assert.Equal(t, int64(1_000_000), sell.Amount0.Int64())
+	assert.Assert(t, sell.Amount1.IsZero())
+	assert.Assert(t, pool.Liquidity().IsZero())
+
+	// Selling token0 pushes the price down into the buy range
+	swap, err := pool.SwapExactAmountIn(sdk.NewInt64Coin(baseDenom, 500_000))
+	assert.NilError(t, err)
+	assert.Assert(t, swap.TokenOut.Amount.IsPositive())
+	assert.Assert(t, swap.TokenOut.Amount.LT(buy.Amount1))
+
+	amount0, amount1, err := pool.PositionAmounts(buy.PositionID)
+	assert.NilError(t, err)
+	assert.Assert(t, amount0.Amount.IsPositive())
+	assert.Assert(t, amount1.Amount.Add(swap.TokenOut.Amount).LTE(buy.Amount1))
+
+	// The next cycle withdraws both positions and redeploys the filled inventory
+	positions, err := pool.UserPositions(testAddress)
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(positions.Positions))
+
+	cfg := &types.Config{
+		PowerPool: types.PowerPool{PoolId: 1, BaseAsset: baseDenom, QuoteAsset: quoteDenom},
+		Position:  types.Position{Spread: "0.1"},
+	}
+
+	next, err := CreateUpdatePositionMsgs(logger, *positions, cfg, types.ConcentratedPool{ID: pool.ID, Token0: pool.Token0, Token1: pool.Token1, CurrentTick: pool.CurrentTick()}, testAddress, pool.SpotPrice().String(), "1.0")
+	assert.NilError(t, err)
+	assert.Equal(t, 4, len(next))
+
+	results, err = pool.ApplyAll(next)
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(pool.Positions(testAddress)))
+
+	withdrawn := results[0].Amount0.Add(results[1].Amount0)
+	assert.Assert(t, withdrawn.GTE(amount0.Amount.SubRaw(1)))
+}
@@ -0,0 +1,267 @@
+package maths
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// DefaultExponent is the exponent of a squared power perpetual.
+const DefaultExponent = "2"
+
+// precision is the mantissa size in bits of intermediate results
+const precision = 256
+
+// maxIntegerExponent bounds the multiplications raising to an integer power
+const maxIntegerExponent = 64
+
+// Power prices a power perpetual, which tracks the base price raised to an
+// exponent. The index is basePrice^exponent in the quote asset and one unit
+// of power is worth normalisationFactor * index / indexScale.
+//
+// Prices passed in and returned are in whole units except where noted.
+// Pool prices and vault amounts are in raw units, so the difference between
+// the base and power decimals is applied when converting between them.
+type Power struct {
+	exponent   *big.Float
+	indexScale *big.Float
+	// decimalShift is 10^(baseDecimals - powerDecimals), raw base units per
+	// raw power unit for one whole base per whole power
+	decimalShift *big.Float
+}
+
+// NewPower returns the pricing of a power perpetual. The exponent may be
+// fractional, e.g. 0.5 for a square root perpetual, and the index scale is
+// kept at arbitrary precision.
+func NewPower(exponent string, indexScale *big.Int, baseDecimals, powerDecimals int) (Power, error) {
+	if exponent == "" {
+		exponent = DefaultExponent
+	}
+
+	e, ok := newFloat().SetString(exponent)
+	if !ok {
+		return Power{}, fmt.Errorf("invalid exponent: %s", exponent)
+	}
+	if e.Sign() == 0 {
+		return Power{}, fmt.Errorf("exponent must not be zero")
+	}
+	if indexScale == nil || indexScale.Sign() <= 0 {
+		return Power{}, fmt.Errorf("index scale must be positive")
+	}
+
+	shift := newFloat().SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(baseDecimals-powerDecimals))), nil))
+	if baseDecimals < powerDecimals {
+		shift.Quo(newFloat().SetInt64(1), shift)
+	}
+
+	return Power{
+		exponent:     e,
+		indexScale:   newFloat().SetInt(indexScale),
+		decimalShift: shift,
+	}, nil
+}
+
+// MustNewPower is NewPower for whole decimals and an int index scale that
+// panics on invalid input, intended for tests and constants.
+func MustNewPower(exponent string, indexScale int64) Power {
+	p, err := NewPower(exponent, big.NewInt(indexScale), 0, 0)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Exponent returns the exponent as a float64.
+func (p Power) Exponent() float64 {
+	e, _ := p.exponent.Float64()
+	return e
+}
+
+// IndexPrice returns basePrice^exponent.
+func (p Power) IndexPrice(basePrice string) (float64, error) {
+	base, err := parsePositive("base price", basePrice)
+	if err != nil {
+		return 0, err
+	}
+
+	return toFloat64(p.pow(base))
+}
+
+// MarkPrice returns the price of power in the quote asset, scaled by the
+// index scale and divided by the normalisation factor so that it is
+// comparable to the index. The power price is raw power units per raw base
+// unit, the power spot price queried with the base asset as base.
+func (p Power) MarkPrice(basePrice, powerPrice, normalisationFactor string) (float64, error) {
+	base, err := parsePositive("base price", basePrice)
+	if err != nil {
+		return 0, err
+	}
+	powerRaw, err := parsePositive("power price", powerPrice)
+	if err != nil {
+		return 0, err
+	}
+	nf, err := parsePositive("normalisation factor", normalisationFactor)
+	if err != nil {
+		return 0, err
+	}
+
+	// Whole power per whole base
+	power := newFloat().Mul(powerRaw, p.decimalShift)
+
+	mark := newFloat().Quo(base, power)
+	mark.Mul(mark, p.indexScale)
+	mark.Quo(mark, nf)
+
+	return toFloat64(mark)
+}
+
+// PowerValue returns the value of one raw unit of power in raw units of the
+// base asset at the index.
+func (p Power) PowerValue(basePrice, normalisationFactor string) (float64, error) {
+	value, err := p.value(basePrice, normalisationFactor)
+	if err != nil {
+		return 0, err
+	}
+
+	return toFloat64(value)
+}
+
+// TargetPrice returns the power price at which power trades at the index,
+// in raw power units per raw base unit like the power spot price.
+func (p Power) TargetPrice(basePrice, normalisationFactor string) (float64, error) {
+	value, err := p.value(basePrice, normalisationFactor)
+	if err != nil {
+		return 0, err
+	}
+
+	return toFloat64(newFloat().Quo(newFloat().SetInt64(1), value))
+}
+
+// PowerDelta returns the base asset exposure of one raw unit of power. Its
+// value in the quote asset grows with basePrice^exponent, so the delta is
+// the exponent times its value in the base asset.
+func (p Power) PowerDelta(basePrice, normalisationFactor string) (float64, error) {
+	value, err := p.value(basePrice, normalisationFactor)
+	if err != nil {
+		return 0, err
+	}
+
+	return toFloat64(value.Mul(value, p.exponent))
+}
+
+// CollateralRatio returns the collateral of a vault divided by the value of
+// its debt in the base asset at the index, both in raw units. It returns
+// +Inf for a vault without debt.
+func (p Power) CollateralRatio(collateral, shortAmount, basePrice, normalisationFactor string) (float64, error) {
+	c, ok := newFloat().SetString(collateral)
+	if !ok {
+		return 0, fmt.Errorf("invalid collateral: %s", collateral)
+	}
+	short, ok := newFloat().SetString(shortAmount)
+	if !ok {
+		return 0, fmt.Errorf("invalid short amount: %s", shortAmount)
+	}
+
+	value, err := p.value(basePrice, normalisationFactor)
+	if err != nil {
+		return 0, err
+	}
+
+	debt := value.Mul(value, short)
+	if debt.Sign() <= 0 {
+		return math.Inf(1), nil
+	}
+
+	return toFloat64(c.Quo(c, debt))
+}
+
+// value is normalisationFactor * basePrice^(exponent - 1) / indexScale whole
+// base per whole power, shifted to raw units
+func (p Power) value(basePrice, normalisationFactor string) (*big.Float, error) {
+	base, err := parsePositive("base price", basePrice)
+	if err != nil {
+		return nil, err
+	}
+	nf, err := parsePositive("normalisation factor", normalisationFactor)
+	if err != nil {
+		return nil, err
+	}
+
+	// The index in the base asset
+	value := p.pow(base)
+	value.Quo(value, base)
+
+	value.Mul(value, nf)
+	value.Quo(value, p.indexScale)
+	value.Mul(value, p.decimalShift)
+
+	return value, nil
+}
+
+// pow raises x to the exponent. Integer exponents and square roots are exact
+// to the working precision, other fractional parts go through float64.
+func (p Power) pow(x *big.Float) *big.Float {
+	e := newFloat().Abs(p.exponent)
+
+	whole, _ := e.Int(nil)
+	frac := newFloat().Sub(e, newFloat().SetInt(whole))
+
+	result := newFloat().SetInt64(1)
+	if whole.IsInt64() && whole.Int64() <= maxIntegerExponent {
+		for i := int64(0); i < whole.Int64(); i++ {
+			result.Mul(result, x)
+		}
+	} else {
+		// Far beyond any sensible exponent, fall back to float64
+		frac.Add(frac, newFloat().SetInt(whole))
+	}
+
+	if frac.Sign() != 0 {
+		if frac.Cmp(big.NewFloat(0.5)) == 0 {
+			result.Mul(result, newFloat().Sqrt(x))
+		} else {
+			xf, _ := x.Float64()
+			ff, _ := frac.Float64()
+			result.Mul(result, newFloat().SetFloat64(math.Pow(xf, ff)))
+		}
+	}
+
+	if p.exponent.Sign() < 0 {
+		result.Quo(newFloat().SetInt64(1), result)
+	}
+
+	return result
+}
+
+func newFloat() *big.Float {
+	return new(big.Float).SetPrec(precision)
+}
+
+func parsePositive(name, value string) (*big.Float, error) {
+	if value == "" {
+		return nil, fmt.Errorf("%s is empty", name)
+	}
+	f, ok := newFloat().SetString(value)
+	if !ok {
+		return nil, fmt.Errorf("invalid %s: %s", name, value)
+	}
+	if f.Sign() <= 0 {
+		return nil, fmt.Errorf("%s must be positive: %s", name, value)
+	}
+	return f, nil
+}
+
+func toFloat64(f *big.Float) (float64, error) {
+	result, _ := f.Float64()
+	if math.IsInf(result, 0) {
+		return 0, fmt.Errorf("result out of range")
+	}
+	return result, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
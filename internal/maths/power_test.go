@@ -0,0 +1,95 @@
+package maths
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func approx(t *testing.T, want, got float64) {
+	t.Helper()
+	assert.Assert(t, math.Abs(want-got) <= 1e-9*math.Max(1, math.Abs(want)), "want %v, got %v", want, got)
+}
+
+func TestPowerSquared(t *testing.T) {
+	p := MustNewPower("", 10000)
+	assert.Equal(t, 2.0, p.Exponent())
+
+	index, err := p.IndexPrice("10")
+	assert.NilError(t, err)
+	approx(t, 100, index)
+
+	mark, err := p.MarkPrice("10", "1000", "1")
+	assert.NilError(t, err)
+	approx(t, 100, mark)
+
+	target, err := p.TargetPrice("10", "1")
+	assert.NilError(t, err)
+	approx(t, 1000, target)
+
+	delta, err := p.PowerDelta("10", "1")
+	assert.NilError(t, err)
+	approx(t, 0.002, delta)
+
+	ratio, err := p.CollateralRatio("3", "1000", "10", "1")
+	assert.NilError(t, err)
+	approx(t, 3, ratio)
+
+	ratio, err = p.CollateralRatio("3", "0", "10", "1")
+	assert.NilError(t, err)
+	assert.Assert(t, math.IsInf(ratio, 1))
+}
+
+func TestPowerExponents(t *testing.T) {
+	for _, tc := range []struct {
+		exponent string
+		index    float64
+	}{
+		{"3", 1000},
+		{"0.5", math.Sqrt(10)},
+		{"1.5", 10 * math.Sqrt(10)},
+		{"-1", 0.1},
+	} {
+		p := MustNewPower(tc.exponent, 1)
+		index, err := p.IndexPrice("10")
+		assert.NilError(t, err, tc.exponent)
+		approx(t, tc.index, index)
+	}
+
+	_, err := NewPower("two", big.NewInt(1), 0, 0)
+	assert.ErrorContains(t, err, "invalid exponent")
+	_, err = NewPower("0", big.NewInt(1), 0, 0)
+	assert.ErrorContains(t, err, "must not be zero")
+	_, err = NewPower("2", big.NewInt(0), 0, 0)
+	assert.ErrorContains(t, err, "index scale must be positive")
+}
+
+func TestPowerIndexScaleBeyondInt64(t *testing.T) {
+	scale, _ := new(big.Int).SetString("1000000000000000000000000", 10)
+	p, err := NewPower("2", scale, 0, 0)
+	assert.NilError(t, err)
+
+	target, err := p.TargetPrice("10", "1")
+	assert.NilError(t, err)
+	approx(t, 1e23, target)
+}
+
+func TestPowerDecimals(t *testing.T) {
+	// Six decimal base against a power with none
+	p, err := NewPower("2", big.NewInt(10000), 6, 0)
+	assert.NilError(t, err)
+
+	// 1000 whole power per whole base is 0.001 raw power per raw base
+	mark, err := p.MarkPrice("10", "0.001", "1")
+	assert.NilError(t, err)
+	approx(t, 100, mark)
+
+	target, err := p.TargetPrice("10", "1")
+	assert.NilError(t, err)
+	approx(t, 0.001, target)
+
+	_, err = p.MarkPrice("10", "0", "1")
+	assert.ErrorContains(t, err, "power price must be positive")
+}
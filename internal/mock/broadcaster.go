@@ -0,0 +1,151 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	abci "github.com/cometbft/cometbft/abci/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/ignite/cli/ignite/pkg/cosmosaccount"
+	"github.com/ignite/cli/ignite/pkg/cosmosclient"
+	cltypes "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/types"
+	pmtypes "github.com/osmosis-labs/osmosis/v21/x/poolmanager/types"
+
+	"github.com/margined-protocol/flood/internal/simulator"
+)
+
+// Tx is a captured transaction.
+type Tx struct {
+	Account string
+	Hash    string
+	Msgs    []sdk.Msg
+}
+
+// Broadcaster captures transactions in place of cosmosclient.Client. When
+// created with a chain, position messages are applied to its simulated pools
+// so that the next cycle sees the new positions.
+type Broadcaster struct {
+	mu    sync.Mutex
+	chain *Chain
+	txs   []Tx
+	err   error
+}
+
+// NewBroadcaster returns a broadcaster that applies messages to the chain,
+// chain may be nil to only capture them.
+func NewBroadcaster(chain *Chain) *Broadcaster {
+	return &Broadcaster{chain: chain}
+}
+
+// FailWith makes the following broadcasts return the error, nil restores
+// success.
+func (b *Broadcaster) FailWith(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.err = err
+}
+
+// BroadcastTx records the messages and returns a response with a
+// deterministic transaction hash.
+func (b *Broadcaster) BroadcastTx(_ context.Context, account cosmosaccount.Account, msgs ...sdk.Msg) (cosmosclient.Response, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.err != nil {
+		return cosmosclient.Response{}, b.err
+	}
+
+	var events []abci.Event
+	if b.chain != nil {
+		var err error
+		if events, err = b.chain.apply(msgs); err != nil {
+			return cosmosclient.Response{}, err
+		}
+	}
+
+	tx := Tx{
+		Account: account.Name,
+		Hash:    fmt.Sprintf("%064X", len(b.txs)+1),
+		Msgs:    msgs,
+	}
+	b.txs = append(b.txs, tx)
+
+	return cosmosclient.Response{TxResponse: &sdk.TxResponse{TxHash: tx.Hash, Events: events}}, nil
+}
+
+// Txs returns the captured transactions in order.
+func (b *Broadcaster) Txs() []Tx {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Tx(nil), b.txs...)
+}
+
+// Last returns the messages of the most recent transaction.
+func (b *Broadcaster) Last() []sdk.Msg {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.txs) == 0 {
+		return nil
+	}
+	return b.txs[len(b.txs)-1].Msgs
+}
+
+// apply executes position messages and swaps against the simulated pools,
+// other messages are only captured. Swaps emit token_swapped events like
+// poolmanager does.
+func (c *Chain) apply(msgs []sdk.Msg) ([]abci.Event, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var events []abci.Event
+	for i, msg := range msgs {
+		var err error
+		switch m := msg.(type) {
+		case *cltypes.MsgCreatePosition:
+			p, ok := c.pools[m.PoolId]
+			if !ok {
+				return nil, fmt.Errorf("msg %d: pool %d not found", i, m.PoolId)
+			}
+			_, err = p.Apply(m)
+		case *pmtypes.MsgSwapExactAmountIn:
+			if len(m.Routes) != 1 {
+				return nil, fmt.Errorf("msg %d: only single hop swaps are simulated", i)
+			}
+			p, ok := c.pools[m.Routes[0].PoolId]
+			if !ok {
+				return nil, fmt.Errorf("msg %d: pool %d not found", i, m.Routes[0].PoolId)
+			}
+			var res *simulator.Result
+			if res, err = p.Apply(m); err == nil {
+				events = append(events, swapEvent(m.Sender, p.ID, res.Swap))
+			}
+		case *cltypes.MsgWithdrawPosition:
+			err = fmt.Errorf("position %d not found", m.PositionId)
+			for _, p := range c.pools {
+				if _, perr := p.Position(m.PositionId); perr == nil {
+					_, err = p.Apply(m)
+					break
+				}
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("msg %d: %w", i, err)
+		}
+	}
+
+	return events, nil
+}
+
+func swapEvent(sender string, poolID uint64, swap *simulator.SwapResult) abci.Event {
+	return abci.Event{
+		Type: "token_swapped",
+		Attributes: []abci.EventAttribute{
+			{Key: "sender", Value: sender},
+			{Key: pmtypes.AttributeKeyPoolId, Value: strconv.FormatUint(poolID, 10)},
+			{Key: pmtypes.AttributeKeyTokensIn, Value: swap.TokenIn.String()},
+			{Key: pmtypes.AttributeKeyTokensOut, Value: swap.TokenOut.String()},
+		},
+	}
+}
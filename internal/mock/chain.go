@@ -0,0 +1,303 @@
+// Package mock provides an in-process stand-in for the chain services the bot
+// talks to. Chain serves the CosmWasm, poolmanager, concentrated liquidity,
+// bank and latest block gRPC queries from scripted state over an in-memory listener and
+// Broadcaster captures the messages the bot would have sent, so full cycles
+// can be tested without a network.
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	"github.com/cosmos/cosmos-sdk/client/grpc/tmservice"
+	"github.com/cosmos/cosmos-sdk/codec"
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	grpctypes "github.com/cosmos/cosmos-sdk/types/grpc"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/osmosis-labs/osmosis/osmomath"
+	clquery "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/client/queryproto"
+	pmquery "github.com/osmosis-labs/osmosis/v21/x/poolmanager/client/queryproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/margined-protocol/flood/internal/simulator"
+)
+
+const bufSize = 1024 * 1024
+
+type spotKey struct {
+	poolID      uint64
+	base, quote string
+}
+
+// Chain holds the scripted state returned by the fake query servers. It is
+// safe to change the state while a client is connected.
+type Chain struct {
+	mu sync.RWMutex
+
+	// contract address -> query name -> JSON response
+	contracts  map[string]map[string]json.RawMessage
+	spotPrices map[spotKey]string
+	pools      map[uint64]*simulator.Pool
+	balances   map[string]sdk.Coins
+	metadata   map[string]banktypes.Metadata
+	failures   map[string]error
+	calls      map[string]int
+	heights    map[string]int64
+	height     int64
+	blockTime  time.Time
+
+	cdc    *codec.ProtoCodec
+	server *grpc.Server
+	lis    *bufconn.Listener
+}
+
+// NewChain returns a chain with no state.
+func NewChain() *Chain {
+	registry := codectypes.NewInterfaceRegistry()
+
+	return &Chain{
+		contracts:  make(map[string]map[string]json.RawMessage),
+		spotPrices: make(map[spotKey]string),
+		pools:      make(map[uint64]*simulator.Pool),
+		balances:   make(map[string]sdk.Coins),
+		metadata:   make(map[string]banktypes.Metadata),
+		failures:   make(map[string]error),
+		calls:      make(map[string]int),
+		heights:    make(map[string]int64),
+		height:     1,
+		cdc:        codec.NewProtoCodec(registry),
+	}
+}
+
+// SetContractQuery scripts the response to a smart query, the name is the
+// single key of the query message, e.g. "config" for {"config": {}}.
+func (c *Chain) SetContractQuery(address, name string, response interface{}) error {
+	bz, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.contracts[address] == nil {
+		c.contracts[address] = make(map[string]json.RawMessage)
+	}
+	c.contracts[address][name] = bz
+
+	return nil
+}
+
+// SetSpotPrice scripts the spot price returned for a pool and denom pair.
+// Pools added with AddPool price themselves and ignore scripted prices.
+func (c *Chain) SetSpotPrice(poolID uint64, base, quote, price string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.spotPrices[spotKey{poolID, base, quote}] = price
+}
+
+// AddPool serves a simulated concentrated liquidity pool. Its current tick,
+// spot price and user positions are read from the simulator on each query.
+func (c *Chain) AddPool(p *simulator.Pool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pools[p.ID] = p
+}
+
+// Pool returns a pool added with AddPool.
+func (c *Chain) Pool(id uint64) (*simulator.Pool, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	p, ok := c.pools[id]
+	return p, ok
+}
+
+// SetBalance scripts the bank balances of an address.
+func (c *Chain) SetBalance(address string, coins ...sdk.Coin) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.balances[address] = sdk.NewCoins(coins...)
+}
+
+// SetDenomMetadata scripts the bank metadata of a denom.
+func (c *Chain) SetDenomMetadata(metadata banktypes.Metadata) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.metadata[metadata.Base] = metadata
+}
+
+// SetBlock scripts the latest block, the chain starts at height 1.
+func (c *Chain) SetBlock(height int64, t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.height = height
+	c.blockTime = t
+}
+
+// Fail makes every call to the full gRPC method name return the error until
+// it is cleared with a nil error, e.g.
+// "/osmosis.poolmanager.v1beta1.Query/SpotPrice".
+func (c *Chain) Fail(method string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		delete(c.failures, method)
+		return
+	}
+	c.failures[method] = err
+}
+
+// Calls returns how many times the full gRPC method name has been called.
+func (c *Chain) Calls(method string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.calls[method]
+}
+
+// QueryHeight returns the block height the last call to the full gRPC
+// method name was pinned to with x-cosmos-block-height, 0 when unpinned.
+func (c *Chain) QueryHeight(method string) int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.heights[method]
+}
+
+// Start serves the chain on an in-memory listener and returns a client
+// connection to it. Stop must be called to release the server.
+func (c *Chain) Start() (*grpc.ClientConn, error) {
+	if c.server != nil {
+		return nil, errors.New("chain already started")
+	}
+
+	c.lis = bufconn.Listen(bufSize)
+	c.server = grpc.NewServer(
+		grpc.ForceServerCodec(c.cdc.GRPCCodec()),
+		grpc.UnaryInterceptor(c.intercept),
+	)
+
+	wasmtypes.RegisterQueryServer(c.server, &wasmServer{chain: c})
+	pmquery.RegisterQueryServer(c.server, &poolManagerServer{chain: c})
+	clquery.RegisterQueryServer(c.server, &concentratedLiquidityServer{chain: c})
+	banktypes.RegisterQueryServer(c.server, &bankServer{chain: c})
+	tmservice.RegisterServiceServer(c.server, &tendermintServer{chain: c})
+
+	go func() {
+		_ = c.server.Serve(c.lis)
+	}()
+
+	return grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return c.lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(c.cdc.GRPCCodec())),
+	)
+}
+
+// Stop shuts the server down.
+func (c *Chain) Stop() {
+	if c.server != nil {
+		c.server.Stop()
+		c.server = nil
+	}
+}
+
+func (c *Chain) intercept(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var height int64
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(grpctypes.GRPCBlockHeightHeader); len(v) > 0 {
+			height, _ = strconv.ParseInt(v[0], 10, 64)
+		}
+	}
+
+	c.mu.Lock()
+	c.calls[info.FullMethod]++
+	c.heights[info.FullMethod] = height
+	err := c.failures[info.FullMethod]
+	latest := c.height
+	c.mu.Unlock()
+
+	// As a node answers a query pinned past its latest block
+	if err == nil && height > latest {
+		err = status.Error(codes.InvalidArgument, "cannot query with height in the future; please provide a valid height: invalid height")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// spotPrice returns the price of base in quote for the pool.
+func (c *Chain) spotPrice(poolID uint64, base, quote string) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if p, ok := c.pools[poolID]; ok {
+		price := p.SpotPrice()
+		switch {
+		case base == p.Token0 && quote == p.Token1:
+		case base == p.Token1 && quote == p.Token0:
+			price = osmomath.OneBigDec().Quo(price)
+		default:
+			return "", status.Errorf(codes.InvalidArgument, "denoms %s/%s not in pool %d", base, quote, poolID)
+		}
+		return price.String(), nil
+	}
+
+	price, ok := c.spotPrices[spotKey{poolID, base, quote}]
+	if !ok {
+		return "", status.Errorf(codes.NotFound, "no spot price for pool %d %s/%s", poolID, base, quote)
+	}
+
+	return price, nil
+}
+
+// contractQuery returns the scripted response to a smart query.
+func (c *Chain) contractQuery(address string, query []byte) ([]byte, error) {
+	var msg map[string]json.RawMessage
+	if err := json.Unmarshal(query, &msg); err != nil || len(msg) != 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid query: %s", query)
+	}
+
+	var name string
+	for k := range msg {
+		name = k
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	res, ok := c.contracts[address][name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no %s query for contract %s", name, address)
+	}
+
+	return res, nil
+}
+
+func (c *Chain) pool(id uint64) (*simulator.Pool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	p, ok := c.pools[id]
+	if !ok {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("pool %d not found", id))
+	}
+
+	return p, nil
+}
@@ -0,0 +1,137 @@
+package mock
+
+import (
+	"context"
+	"time"
+
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	"github.com/cosmos/cosmos-sdk/client/grpc/tmservice"
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	clquery "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/client/queryproto"
+	model "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/model"
+	pmquery "github.com/osmosis-labs/osmosis/v21/x/poolmanager/client/queryproto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/margined-protocol/flood/internal/simulator"
+)
+
+type wasmServer struct {
+	wasmtypes.UnimplementedQueryServer
+	chain *Chain
+}
+
+func (s *wasmServer) SmartContractState(_ context.Context, req *wasmtypes.QuerySmartContractStateRequest) (*wasmtypes.QuerySmartContractStateResponse, error) {
+	data, err := s.chain.contractQuery(req.Address, req.QueryData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wasmtypes.QuerySmartContractStateResponse{Data: data}, nil
+}
+
+type poolManagerServer struct {
+	pmquery.UnimplementedQueryServer
+	chain *Chain
+}
+
+func (s *poolManagerServer) SpotPrice(_ context.Context, req *pmquery.SpotPriceRequest) (*pmquery.SpotPriceResponse, error) {
+	price, err := s.chain.spotPrice(req.PoolId, req.BaseAssetDenom, req.QuoteAssetDenom)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pmquery.SpotPriceResponse{SpotPrice: price}, nil
+}
+
+func (s *poolManagerServer) Pool(_ context.Context, req *pmquery.PoolRequest) (*pmquery.PoolResponse, error) {
+	p, err := s.chain.pool(req.PoolId)
+	if err != nil {
+		return nil, err
+	}
+
+	s.chain.mu.RLock()
+	packed, err := codectypes.NewAnyWithValue(poolModel(p))
+	s.chain.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return &pmquery.PoolResponse{Pool: packed}, nil
+}
+
+type concentratedLiquidityServer struct {
+	clquery.UnimplementedQueryServer
+	chain *Chain
+}
+
+func (s *concentratedLiquidityServer) UserPositions(_ context.Context, req *clquery.UserPositionsRequest) (*clquery.UserPositionsResponse, error) {
+	p, err := s.chain.pool(req.PoolId)
+	if err != nil {
+		return nil, err
+	}
+
+	s.chain.mu.RLock()
+	defer s.chain.mu.RUnlock()
+
+	return p.UserPositions(req.Address)
+}
+
+type bankServer struct {
+	banktypes.UnimplementedQueryServer
+	chain *Chain
+}
+
+func (s *bankServer) Balance(_ context.Context, req *banktypes.QueryBalanceRequest) (*banktypes.QueryBalanceResponse, error) {
+	s.chain.mu.RLock()
+	defer s.chain.mu.RUnlock()
+
+	balance := sdk.NewCoin(req.Denom, s.chain.balances[req.Address].AmountOf(req.Denom))
+
+	return &banktypes.QueryBalanceResponse{Balance: &balance}, nil
+}
+
+func (s *bankServer) DenomMetadata(_ context.Context, req *banktypes.QueryDenomMetadataRequest) (*banktypes.QueryDenomMetadataResponse, error) {
+	s.chain.mu.RLock()
+	defer s.chain.mu.RUnlock()
+
+	metadata, ok := s.chain.metadata[req.Denom]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no metadata for denom %s", req.Denom)
+	}
+
+	return &banktypes.QueryDenomMetadataResponse{Metadata: metadata}, nil
+}
+
+type tendermintServer struct {
+	tmservice.UnimplementedServiceServer
+	chain *Chain
+}
+
+func (s *tendermintServer) GetLatestBlock(_ context.Context, _ *tmservice.GetLatestBlockRequest) (*tmservice.GetLatestBlockResponse, error) {
+	s.chain.mu.RLock()
+	defer s.chain.mu.RUnlock()
+
+	return &tmservice.GetLatestBlockResponse{
+		SdkBlock: &tmservice.Block{
+			Header: tmservice.Header{Height: s.chain.height, Time: s.chain.blockTime},
+		},
+	}, nil
+}
+
+// poolModel converts the simulator state to the pool returned by the chain.
+func poolModel(p *simulator.Pool) *model.Pool {
+	return &model.Pool{
+		Id:                   p.ID,
+		Token0:               p.Token0,
+		Token1:               p.Token1,
+		CurrentTick:          p.CurrentTick(),
+		CurrentSqrtPrice:     p.CurrentSqrtPrice(),
+		CurrentTickLiquidity: p.Liquidity().Dec(),
+		TickSpacing:          uint64(p.TickSpacing),
+		SpreadFactor:         p.SpreadFactor.Dec(),
+		LastLiquidityUpdate:  time.Unix(0, 0).UTC(),
+	}
+}
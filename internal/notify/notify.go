@@ -0,0 +1,297 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+// Severity orders messages so that backends can choose what they receive.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityCritical
+)
+
+// ParseSeverity converts a config string into a Severity, an empty string is
+// treated as info.
+func ParseSeverity(s string) (Severity, error) {
+	switch strings.ToLower(s) {
+	case "", "info":
+		return SeverityInfo, nil
+	case "warning", "warn":
+		return SeverityWarning, nil
+	case "critical", "error":
+		return SeverityCritical, nil
+	default:
+		return SeverityInfo, fmt.Errorf("unknown severity: %s", s)
+	}
+}
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityCritical:
+		return "critical"
+	default:
+		return "info"
+	}
+}
+
+// Event identifies what happened so backends can filter on it.
+type Event string
+
+const (
+	EventTxFailed       Event = "tx_failed"
+	EventQueryFailed    Event = "query_failed"
+	EventCycleFailed    Event = "cycle_failed"
+	EventPaused         Event = "paused"
+	EventLowGas         Event = "low_gas"
+	EventRebalanced     Event = "rebalanced"
+	EventArbitrage      Event = "arbitrage"
+	EventVault          Event = "vault"
+	EventLiquidated     Event = "liquidated"
+	EventPriceDeviation Event = "price_deviation"
+)
+
+// Message is a single alert.
+type Message struct {
+	Event    Event             `json:"event"`
+	Severity Severity          `json:"-"`
+	Title    string            `json:"title"`
+	Text     string            `json:"text"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	Time     time.Time         `json:"time"`
+}
+
+// MarshalJSON writes the severity as a string.
+func (m Message) MarshalJSON() ([]byte, error) {
+	type alias Message
+	return json.Marshal(struct {
+		alias
+		Severity string `json:"severity"`
+	}{alias(m), m.Severity.String()})
+}
+
+// Format renders the message as plain text for chat backends.
+func (m Message) Format() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] %s", strings.ToUpper(m.Severity.String()), m.Title)
+	if m.Text != "" {
+		fmt.Fprintf(&b, "\n%s", m.Text)
+	}
+
+	keys := make([]string, 0, len(m.Fields))
+	for k := range m.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\n%s: %s", k, m.Fields[k])
+	}
+
+	return b.String()
+}
+
+// key identifies a message for deduplication, the time is ignored.
+func (m Message) key() string {
+	return fmt.Sprintf("%s|%s|%s", m.Event, m.Title, m.Text)
+}
+
+// Notifier delivers messages.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// Nop discards every message, it is used when no backends are configured.
+type Nop struct{}
+
+func (Nop) Notify(context.Context, Message) error { return nil }
+
+// route is a backend with the filters that decide what it receives.
+type route struct {
+	name        string
+	backend     Notifier
+	minSeverity Severity
+	events      map[Event]bool
+}
+
+func (r route) accepts(msg Message) bool {
+	if msg.Severity < r.minSeverity {
+		return false
+	}
+	return len(r.events) == 0 || r.events[msg.Event]
+}
+
+// Router sends each message to every backend whose filters accept it and
+// suppresses repeats of the same message within the dedup window.
+type Router struct {
+	routes      []route
+	dedupWindow time.Duration
+	dedupPath   string
+	now         func() time.Time
+
+	mu   sync.Mutex
+	sent map[string]time.Time
+}
+
+// New builds a Router from config. If no backends are configured a Nop is
+// returned.
+func New(cfg types.Notifier) (Notifier, error) {
+	if len(cfg.Backends) == 0 {
+		return Nop{}, nil
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	if cfg.Timeout > 0 {
+		client.Timeout = cfg.Timeout
+	}
+
+	r := &Router{
+		dedupWindow: cfg.DedupWindow,
+		dedupPath:   cfg.DedupPath,
+		now:         time.Now,
+		sent:        make(map[string]time.Time),
+	}
+
+	for i, b := range cfg.Backends {
+		backend, err := newBackend(client, b)
+		if err != nil {
+			return nil, fmt.Errorf("notifier backend %d: %w", i, err)
+		}
+
+		minSeverity, err := ParseSeverity(b.MinSeverity)
+		if err != nil {
+			return nil, fmt.Errorf("notifier backend %d: %w", i, err)
+		}
+
+		events := make(map[Event]bool, len(b.Events))
+		for _, e := range b.Events {
+			events[Event(e)] = true
+		}
+
+		r.routes = append(r.routes, route{
+			name:        b.Type,
+			backend:     backend,
+			minSeverity: minSeverity,
+			events:      events,
+		})
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func newBackend(client *http.Client, b types.NotifierBackend) (Notifier, error) {
+	switch b.Type {
+	case "webhook":
+		return NewWebhook(client, b.URL), nil
+	case "slack":
+		return NewSlack(client, b.URL), nil
+	case "telegram":
+		return NewTelegram(client, b.URL, b.Token, b.ChatID), nil
+	default:
+		return nil, fmt.Errorf("unknown type: %q", b.Type)
+	}
+}
+
+// Notify delivers the message to all accepting backends, errors from
+// individual backends are joined so one failing backend does not stop others.
+func (r *Router) Notify(ctx context.Context, msg Message) error {
+	if msg.Time.IsZero() {
+		msg.Time = r.now()
+	}
+
+	if r.isDuplicate(msg) {
+		return nil
+	}
+
+	var errs []error
+	for _, rt := range r.routes {
+		if !rt.accepts(msg) {
+			continue
+		}
+		if err := rt.backend.Notify(ctx, msg); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", rt.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// isDuplicate records the message and reports whether it was already sent
+// within the dedup window.
+func (r *Router) isDuplicate(msg Message) bool {
+	if r.dedupWindow <= 0 {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := msg.key()
+	if last, ok := r.sent[key]; ok && msg.Time.Sub(last) < r.dedupWindow {
+		return true
+	}
+
+	r.sent[key] = msg.Time
+	r.save()
+
+	return false
+}
+
+// load reads previously sent messages so deduplication survives restarts of
+// the oneshot service.
+func (r *Router) load() error {
+	if r.dedupPath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(r.dedupPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &r.sent)
+}
+
+// save persists sent messages, expired entries are pruned. Failures are
+// ignored as they only weaken deduplication.
+func (r *Router) save() {
+	if r.dedupPath == "" {
+		return
+	}
+
+	now := r.now()
+	for k, t := range r.sent {
+		if now.Sub(t) >= r.dedupWindow {
+			delete(r.sent, k)
+		}
+	}
+
+	data, err := json.Marshal(r.sent)
+	if err != nil {
+		return
+	}
+
+	_ = os.WriteFile(r.dedupPath, data, 0o600)
+}
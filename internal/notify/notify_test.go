@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+type recorder struct {
+	mu     sync.Mutex
+	bodies []map[string]interface{}
+	paths  []string
+}
+
+func (rec *recorder) handler(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.bodies = append(rec.bodies, body)
+	rec.paths = append(rec.paths, r.URL.Path)
+}
+
+func TestRouterSeverityAndEventRouting(t *testing.T) {
+	slack, webhook := &recorder{}, &recorder{}
+	slackSrv := httptest.NewServer(http.HandlerFunc(slack.handler))
+	defer slackSrv.Close()
+	webhookSrv := httptest.NewServer(http.HandlerFunc(webhook.handler))
+	defer webhookSrv.Close()
+
+	n, err := New(types.Notifier{
+		Backends: []types.NotifierBackend{
+			{Type: "slack", URL: slackSrv.URL, MinSeverity: "critical"},
+			{Type: "webhook", URL: webhookSrv.URL, Events: []string{string(EventRebalanced)}},
+		},
+	})
+	assert.NilError(t, err)
+
+	ctx := context.Background()
+	assert.NilError(t, n.Notify(ctx, Message{Event: EventTxFailed, Severity: SeverityCritical, Title: "tx failed"}))
+	assert.NilError(t, n.Notify(ctx, Message{Event: EventRebalanced, Severity: SeverityInfo, Title: "rebalanced"}))
+
+	assert.Equal(t, 1, len(slack.bodies))
+	assert.Equal(t, "[CRITICAL] tx failed", slack.bodies[0]["text"])
+
+	assert.Equal(t, 1, len(webhook.bodies))
+	assert.Equal(t, "rebalanced", webhook.bodies[0]["event"])
+	assert.Equal(t, "info", webhook.bodies[0]["severity"])
+}
+
+func TestRouterDeduplicates(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(http.HandlerFunc(rec.handler))
+	defer srv.Close()
+
+	n, err := New(types.Notifier{
+		DedupWindow: time.Minute,
+		Backends:    []types.NotifierBackend{{Type: "webhook", URL: srv.URL}},
+	})
+	assert.NilError(t, err)
+
+	start := time.Unix(0, 0)
+	ctx := context.Background()
+	msg := Message{Event: EventPaused, Severity: SeverityWarning, Title: "paused"}
+
+	for _, offset := range []time.Duration{0, 30 * time.Second, 2 * time.Minute} {
+		msg.Time = start.Add(offset)
+		assert.NilError(t, n.Notify(ctx, msg))
+	}
+
+	assert.Equal(t, 2, len(rec.bodies))
+}
+
+func TestTelegram(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(http.HandlerFunc(rec.handler))
+	defer srv.Close()
+
+	tg := NewTelegram(srv.Client(), srv.URL, "token", "42")
+	err := tg.Notify(context.Background(), Message{
+		Severity: SeverityWarning,
+		Title:    "low gas",
+		Fields:   map[string]string{"balance": "1uosmo"},
+	})
+	assert.NilError(t, err)
+
+	assert.Equal(t, "/bottoken/sendMessage", rec.paths[0])
+	assert.Equal(t, "42", rec.bodies[0]["chat_id"])
+	assert.Equal(t, "[WARNING] low gas\nbalance: 1uosmo", rec.bodies[0]["text"])
+}
+
+func TestBackendErrorsHideTheURL(t *testing.T) {
+	// Nothing listens on the server once closed
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	msg := Message{Severity: SeverityCritical, Title: "tx failed"}
+	for name, n := range map[string]Notifier{
+		"webhook":  NewWebhook(srv.Client(), srv.URL+"/hooks/secret"),
+		"slack":    NewSlack(srv.Client(), srv.URL+"/services/secret"),
+		"telegram": NewTelegram(srv.Client(), srv.URL, "secret", "42"),
+	} {
+		err := n.Notify(context.Background(), msg)
+		assert.Assert(t, err != nil, name)
+		assert.Assert(t, !strings.Contains(err.Error(), "secret"), "%s: %s", name, err)
+	}
+}
+
+func TestUnknownBackend(t *testing.T) {
+	_, err := New(types.Notifier{Backends: []types.NotifierBackend{{Type: "pager"}}})
+	assert.ErrorContains(t, err, "unknown type")
+}
@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const defaultTelegramURL = "https://api.telegram.org"
+
+// postJSON sends body as JSON to endpoint and treats any non 2xx status as an
+// error. Webhook urls and bot tokens are secrets, so errors never include
+// the endpoint.
+func postJSON(ctx context.Context, client *http.Client, endpoint string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return redact(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return redact(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("unexpected status %d: %s", res.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+// redact strips the request url from an error
+func redact(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// Webhook posts the message as JSON to a generic HTTP endpoint.
+type Webhook struct {
+	client *http.Client
+	url    string
+}
+
+func NewWebhook(client *http.Client, url string) *Webhook {
+	return &Webhook{client: client, url: url}
+}
+
+func (w *Webhook) Notify(ctx context.Context, msg Message) error {
+	return postJSON(ctx, w.client, w.url, msg)
+}
+
+// Slack posts the message to a Slack compatible incoming webhook.
+type Slack struct {
+	client *http.Client
+	url    string
+}
+
+func NewSlack(client *http.Client, url string) *Slack {
+	return &Slack{client: client, url: url}
+}
+
+func (s *Slack) Notify(ctx context.Context, msg Message) error {
+	return postJSON(ctx, s.client, s.url, map[string]string{"text": msg.Format()})
+}
+
+// Telegram sends the message through a Telegram compatible bot API.
+type Telegram struct {
+	client  *http.Client
+	baseURL string
+	token   string
+	chatID  string
+}
+
+// NewTelegram returns a Telegram backend, if baseURL is empty the public bot
+// API is used.
+func NewTelegram(client *http.Client, baseURL, token, chatID string) *Telegram {
+	if baseURL == "" {
+		baseURL = defaultTelegramURL
+	}
+	return &Telegram{client: client, baseURL: strings.TrimSuffix(baseURL, "/"), token: token, chatID: chatID}
+}
+
+func (t *Telegram) Notify(ctx context.Context, msg Message) error {
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", t.baseURL, t.token)
+	return postJSON(ctx, t.client, endpoint, map[string]string{
+		"chat_id": t.chatID,
+		"text":    msg.Format(),
+	})
+}
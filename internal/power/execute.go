@@ -0,0 +1,86 @@
+package power
+
+import (
+	"encoding/json"
+
+	sdkmath "cosmossdk.io/math"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+)
+
+type mintPowerPerp struct {
+	Amount  sdkmath.Int `json:"amount"`
+	VaultID *uint64     `json:"vault_id,omitempty"`
+	Rebase  bool        `json:"rebase"`
+}
+
+type burnPowerPerp struct {
+	AmountToWithdraw *sdkmath.Int `json:"amount_to_withdraw,omitempty"`
+	VaultID          uint64       `json:"vault_id"`
+}
+
+type deposit struct {
+	VaultID uint64 `json:"vault_id"`
+}
+
+type liquidate struct {
+	VaultID       uint64      `json:"vault_id"`
+	MaxDebtAmount sdkmath.Int `json:"max_debt_amount"`
+}
+
+type executeMsg struct {
+	MintPowerPerp *mintPowerPerp `json:"mint_power_perp,omitempty"`
+	BurnPowerPerp *burnPowerPerp `json:"burn_power_perp,omitempty"`
+	Deposit       *deposit       `json:"deposit,omitempty"`
+	Liquidate     *liquidate     `json:"liquidate,omitempty"`
+}
+
+// executeContractMsg encodes an execute message for the power contract.
+func executeContractMsg(sender, contract string, msg executeMsg, funds sdk.Coins) (sdk.Msg, error) {
+	bz, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wasmtypes.MsgExecuteContract{
+		Sender:   sender,
+		Contract: contract,
+		Msg:      bz,
+		Funds:    funds,
+	}, nil
+}
+
+// MintPowerPerpMsg mints power against the collateral sent with it. A vault
+// id of 0 opens a new vault.
+func MintPowerPerpMsg(sender, contract string, amount sdkmath.Int, vaultID uint64, collateral sdk.Coin) (sdk.Msg, error) {
+	mint := &mintPowerPerp{Amount: amount}
+	if vaultID != 0 {
+		mint.VaultID = &vaultID
+	}
+
+	return executeContractMsg(sender, contract, executeMsg{MintPowerPerp: mint}, sdk.NewCoins(collateral))
+}
+
+// BurnPowerPerpMsg burns the power sent with it to repay vault debt and
+// withdraws collateral from the vault.
+func BurnPowerPerpMsg(sender, contract string, power sdk.Coin, vaultID uint64, withdraw sdkmath.Int) (sdk.Msg, error) {
+	burn := &burnPowerPerp{VaultID: vaultID}
+	if withdraw.IsPositive() {
+		burn.AmountToWithdraw = &withdraw
+	}
+
+	return executeContractMsg(sender, contract, executeMsg{BurnPowerPerp: burn}, sdk.NewCoins(power))
+}
+
+// DepositMsg adds the collateral sent with it to a vault.
+func DepositMsg(sender, contract string, vaultID uint64, collateral sdk.Coin) (sdk.Msg, error) {
+	return executeContractMsg(sender, contract, executeMsg{Deposit: &deposit{VaultID: vaultID}}, sdk.NewCoins(collateral))
+}
+
+// LiquidateMsg repays up to the power sent with it of an undercollateralised
+// vault's debt in exchange for its collateral.
+func LiquidateMsg(sender, contract string, vaultID uint64, power sdk.Coin) (sdk.Msg, error) {
+	msg := &liquidate{VaultID: vaultID, MaxDebtAmount: power.Amount}
+	return executeContractMsg(sender, contract, executeMsg{Liquidate: msg}, sdk.NewCoins(power))
+}
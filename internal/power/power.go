@@ -3,21 +3,100 @@ package power
 import (
 	"context"
 	"encoding/json"
-	"sync"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	"go.uber.org/zap"
 
+	"github.com/margined-protocol/flood/internal/fetch"
+	"github.com/margined-protocol/flood/internal/maths"
 	"github.com/margined-protocol/flood/internal/types"
 )
 
-// querySmartContract executes a generic query to a smart contract.
-func querySmartContract(ctx context.Context, pa string, c wasmtypes.QueryClient, query string, out interface{}) error {
-	req := &wasmtypes.QuerySmartContractStateRequest{
-		Address:   pa,
-		QueryData: []byte(query),
+// Contract versions flood supports, the minimum inclusive and the maximum
+// exclusive
+const (
+	MinVersion = "0.1.0"
+	MaxVersion = "1.0.0"
+)
+
+// userVaultsPageSize is the number of vaults requested per query
+const userVaultsPageSize = 30
+
+// vaultBatchSize is the number of vaults AllVaults queries at once
+const vaultBatchSize = 30
+
+// cw2InfoKey is the raw storage key of the contract name and version
+const cw2InfoKey = "contract_info"
+
+type empty struct{}
+
+type vaultRequest struct {
+	VaultID uint64 `json:"vault_id"`
+}
+
+type userVaultsRequest struct {
+	User       string  `json:"user"`
+	StartAfter *uint64 `json:"start_after,omitempty"`
+	Limit      *uint32 `json:"limit,omitempty"`
+}
+
+// periodRequest asks for a time weighted price over the period in seconds,
+// zero is the spot price
+type periodRequest struct {
+	Period uint64 `json:"period"`
+}
+
+// QueryMsg is the query message of the power contract, exactly one field is
+// set.
+type QueryMsg struct {
+	Config                     *empty             `json:"config,omitempty"`
+	State                      *empty             `json:"state,omitempty"`
+	GetNormalisationFactor     *empty             `json:"get_normalisation_factor,omitempty"`
+	GetIndex                   *periodRequest     `json:"get_index,omitempty"`
+	GetUnscaledIndex           *periodRequest     `json:"get_unscaled_index,omitempty"`
+	GetDenormalisedMark        *periodRequest     `json:"get_denormalised_mark,omitempty"`
+	GetDenormalisedMarkFunding *periodRequest     `json:"get_denormalised_mark_funding,omitempty"`
+	GetVault                   *vaultRequest      `json:"get_vault,omitempty"`
+	GetUserVaults              *userVaultsRequest `json:"get_user_vaults,omitempty"`
+	GetNextVaultID             *empty             `json:"get_next_vault_id,omitempty"`
+}
+
+// Client queries a power contract.
+type Client struct {
+	wasmClient wasmtypes.QueryClient
+	address    string
+	timeout    time.Duration
+}
+
+// NewClient returns a client for the power contract at the address, each
+// query is bounded by the timeout when it is positive.
+func NewClient(wasmClient wasmtypes.QueryClient, address string, timeout time.Duration) *Client {
+	return &Client{wasmClient: wasmClient, address: address, timeout: timeout}
+}
+
+// Address returns the address of the contract.
+func (c *Client) Address() string {
+	return c.address
+}
+
+// query sends a smart query and decodes the response into out.
+func (c *Client) query(ctx context.Context, msg QueryMsg, out interface{}) error {
+	bz, err := json.Marshal(msg)
+	if err != nil {
+		return err
 	}
 
-	res, err := c.SmartContractState(ctx, req)
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	res, err := c.wasmClient.SmartContractState(ctx, &wasmtypes.QuerySmartContractStateRequest{
+		Address:   c.address,
+		QueryData: bz,
+	})
 	if err != nil {
 		return err
 	}
@@ -25,60 +104,304 @@ func querySmartContract(ctx context.Context, pa string, c wasmtypes.QueryClient,
 	return json.Unmarshal(res.Data, out)
 }
 
-// GetState queries the power contract state.
-func getState(ctx context.Context, pa string, c wasmtypes.QueryClient) (types.GetStateResponse, error) {
-	var getStatusData types.GetStateResponse
-	err := querySmartContract(ctx, pa, c, `{"state": {}}`, &getStatusData)
-	return getStatusData, err
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// Config queries the contract configuration, failing if the contract
+// version is not supported.
+func (c *Client) Config(ctx context.Context) (types.GetConfigResponse, error) {
+	var config types.GetConfigResponse
+	if err := c.query(ctx, QueryMsg{Config: &empty{}}, &config); err != nil {
+		return config, err
+	}
+
+	return config, CheckVersion(config.Version)
 }
 
-// GetConfig queries the power contract configuration.
-func getConfig(ctx context.Context, pa string, c wasmtypes.QueryClient) (types.GetConfigResponse, error) {
-	var getConfigData types.GetConfigResponse
-	err := querySmartContract(ctx, pa, c, `{"config": {}}`, &getConfigData)
-	return getConfigData, err
+// State queries the contract state.
+func (c *Client) State(ctx context.Context) (types.GetStateResponse, error) {
+	var state types.GetStateResponse
+	err := c.query(ctx, QueryMsg{State: &empty{}}, &state)
+	return state, err
 }
 
-func GetConfigAndState(ctx context.Context, wasmClient wasmtypes.QueryClient, contractAddress string) (types.GetConfigResponse, types.GetStateResponse, error) {
+// ConfigAndState queries the configuration and state concurrently.
+func (c *Client) ConfigAndState(ctx context.Context) (types.GetConfigResponse, types.GetStateResponse, error) {
 	var config types.GetConfigResponse
 	var state types.GetStateResponse
-	var err error
 
-	// WaitGroup to wait for goroutines to finish
-	var wg sync.WaitGroup
-	wg.Add(2)
+	// Each query is already bounded by the client's timeout
+	err := fetch.All(ctx, 0,
+		fetch.Query{Name: "config", Run: func(ctx context.Context) (err error) {
+			config, err = c.Config(ctx)
+			return err
+		}},
+		fetch.Query{Name: "state", Run: func(ctx context.Context) (err error) {
+			state, err = c.State(ctx)
+			return err
+		}},
+	)
+	if err != nil {
+		return types.GetConfigResponse{}, types.GetStateResponse{}, err
+	}
 
-	// Error channel to capture errors from goroutines
-	errChan := make(chan error, 2)
+	return config, state, nil
+}
 
-	// Fetch config concurrently
-	go func() {
-		defer wg.Done()
-		config, err = getConfig(ctx, contractAddress, wasmClient)
-		if err != nil {
-			errChan <- err
+// NormalisationFactor queries the current normalisation factor.
+func (c *Client) NormalisationFactor(ctx context.Context) (string, error) {
+	var nf string
+	err := c.query(ctx, QueryMsg{GetNormalisationFactor: &empty{}}, &nf)
+	return nf, err
+}
+
+// Index queries the index price scaled by the index scale, averaged over the
+// period in seconds.
+func (c *Client) Index(ctx context.Context, period uint64) (string, error) {
+	var index string
+	err := c.query(ctx, QueryMsg{GetIndex: &periodRequest{Period: period}}, &index)
+	return index, err
+}
+
+// UnscaledIndex queries the index price averaged over the period.
+func (c *Client) UnscaledIndex(ctx context.Context, period uint64) (string, error) {
+	var index string
+	err := c.query(ctx, QueryMsg{GetUnscaledIndex: &periodRequest{Period: period}}, &index)
+	return index, err
+}
+
+// DenormalisedMark queries the mark price averaged over the period.
+func (c *Client) DenormalisedMark(ctx context.Context, period uint64) (string, error) {
+	var mark string
+	err := c.query(ctx, QueryMsg{GetDenormalisedMark: &periodRequest{Period: period}}, &mark)
+	return mark, err
+}
+
+// DenormalisedMarkFunding queries the mark price used for funding, averaged
+// over the period.
+func (c *Client) DenormalisedMarkFunding(ctx context.Context, period uint64) (string, error) {
+	var mark string
+	err := c.query(ctx, QueryMsg{GetDenormalisedMarkFunding: &periodRequest{Period: period}}, &mark)
+	return mark, err
+}
+
+// Prices queries the spot index and mark and their averages over the
+// period in seconds concurrently.
+func (c *Client) Prices(ctx context.Context, period uint64) (types.PowerPrices, error) {
+	var prices types.PowerPrices
+
+	err := fetch.All(ctx, 0,
+		fetch.Query{Name: "index", Run: func(ctx context.Context) (err error) {
+			prices.Index, err = c.UnscaledIndex(ctx, 0)
+			return err
+		}},
+		fetch.Query{Name: "index twap", Run: func(ctx context.Context) (err error) {
+			prices.IndexTwap, err = c.UnscaledIndex(ctx, period)
+			return err
+		}},
+		fetch.Query{Name: "mark", Run: func(ctx context.Context) (err error) {
+			prices.Mark, err = c.DenormalisedMark(ctx, 0)
+			return err
+		}},
+		fetch.Query{Name: "funding mark", Run: func(ctx context.Context) (err error) {
+			prices.MarkTwap, err = c.DenormalisedMarkFunding(ctx, period)
+			return err
+		}},
+	)
+
+	return prices, err
+}
+
+// Vault queries a vault.
+func (c *Client) Vault(ctx context.Context, vaultID uint64) (types.GetVaultResponse, error) {
+	var vault types.GetVaultResponse
+	err := c.query(ctx, QueryMsg{GetVault: &vaultRequest{VaultID: vaultID}}, &vault)
+	return vault, err
+}
+
+// UserVaults lists every vault operated by the user, paging after the last
+// vault until a page comes back empty. The contract may cap the page below
+// the limit requested, so a short page is not the last.
+func (c *Client) UserVaults(ctx context.Context, user string) ([]types.UserVault, error) {
+	var vaults []types.UserVault
+	limit := uint32(userVaultsPageSize)
+	req := &userVaultsRequest{User: user, Limit: &limit}
+
+	for {
+		var res types.GetUserVaultsResponse
+		if err := c.query(ctx, QueryMsg{GetUserVaults: req}, &res); err != nil {
+			return nil, err
 		}
-	}()
+		if len(res.Vaults) == 0 {
+			return vaults, nil
+		}
+
+		last := res.Vaults[len(res.Vaults)-1].ID
+		if req.StartAfter != nil && last <= *req.StartAfter {
+			return nil, fmt.Errorf("user vaults page after %d did not advance", *req.StartAfter)
+		}
+		vaults = append(vaults, res.Vaults...)
+		req.StartAfter = &last
+	}
+}
+
+// NextVaultID queries the id the next vault opened will have.
+func (c *Client) NextVaultID(ctx context.Context) (uint64, error) {
+	var next uint64
+	err := c.query(ctx, QueryMsg{GetNextVaultID: &empty{}}, &next)
+	return next, err
+}
+
+// AllVaults lists every vault opened on the contract, vault ids start at one
+// and run up to the next vault id. The contract has no query listing every
+// vault, so they are queried concurrently in batches of vaultBatchSize. A
+// vault that cannot be read, such as a removed one, is logged and skipped.
+func (c *Client) AllVaults(ctx context.Context, l *zap.Logger) ([]types.UserVault, error) {
+	next, err := c.NextVaultID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if next <= 1 {
+		return nil, nil
+	}
+
+	vaults := make([]types.UserVault, next-1)
+	found := make([]bool, next-1)
+	for start := uint64(1); start < next; start += vaultBatchSize {
+		end := start + vaultBatchSize
+		if end > next {
+			end = next
+		}
+
+		// Each query is already bounded by the client's timeout
+		fetches := make([]fetch.Query, 0, end-start)
+		for id := start; id < end; id++ {
+			id := id
+			fetches = append(fetches, fetch.Query{Name: fmt.Sprintf("vault %d", id), Run: func(ctx context.Context) error {
+				vault, err := c.Vault(ctx, id)
+				if err != nil {
+					return err
+				}
+				vaults[id-1], found[id-1] = types.UserVault{ID: id, GetVaultResponse: vault}, true
+				return nil
+			}})
+		}
+		if err := fetch.All(ctx, 0, fetches...); err != nil {
+			l.Warn("Skipping vaults that failed to load", zap.Error(err))
+		}
+	}
+
+	listed := make([]types.UserVault, 0, len(vaults))
+	for i, vault := range vaults {
+		if found[i] {
+			listed = append(listed, vault)
+		}
+	}
+
+	return listed, nil
+}
+
+// ContractVersion reads the name and version the contract stored at
+// instantiation or its last migration.
+func (c *Client) ContractVersion(ctx context.Context) (types.ContractVersion, error) {
+	var version types.ContractVersion
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	res, err := c.wasmClient.RawContractState(ctx, &wasmtypes.QueryRawContractStateRequest{
+		Address:   c.address,
+		QueryData: []byte(cw2InfoKey),
+	})
+	if err != nil {
+		return version, err
+	}
+
+	err = json.Unmarshal(res.Data, &version)
+	return version, err
+}
+
+// CheckVersion returns an error unless the version is within the supported
+// range.
+func CheckVersion(version string) error {
+	v, err := parseVersion(version)
+	if err != nil {
+		return fmt.Errorf("unsupported power contract version %q: %w", version, err)
+	}
+
+	minVersion, _ := parseVersion(MinVersion)
+	maxVersion, _ := parseVersion(MaxVersion)
+	if compareVersions(v, minVersion) < 0 || compareVersions(v, maxVersion) >= 0 {
+		return fmt.Errorf("unsupported power contract version %s, supported versions are %s up to %s", version, MinVersion, MaxVersion)
+	}
+
+	return nil
+}
+
+// parseVersion parses major.minor.patch, ignoring a v prefix and any
+// pre-release or build suffix
+func parseVersion(version string) ([3]uint64, error) {
+	var v [3]uint64
+
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
 
-	// Fetch state concurrently
-	go func() {
-		defer wg.Done()
-		state, err = getState(ctx, contractAddress, wasmClient)
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("expected major.minor.patch")
+	}
+
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 64)
 		if err != nil {
-			errChan <- err
+			return v, fmt.Errorf("invalid version number %q", part)
 		}
-	}()
+		v[i] = n
+	}
 
-	// Wait for both goroutines to complete
-	wg.Wait()
-	close(errChan)
+	return v, nil
+}
 
-	// Check if any errors occurred
-	for e := range errChan {
-		if e != nil {
-			return types.GetConfigResponse{}, types.GetStateResponse{}, e
+func compareVersions(a, b [3]uint64) int {
+	for i := range a {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
 		}
 	}
+	return 0
+}
 
-	return config, state, nil
+// Pricing returns the maths of the contract's power perpetual. The exponent
+// is the configured one, or the contract's when not configured, and must
+// match the contract's when both are set.
+func Pricing(exponent string, config types.GetConfigResponse) (maths.Power, error) {
+	if exponent != "" && config.Exponent != "" && exponent != config.Exponent {
+		return maths.Power{}, fmt.Errorf("configured exponent %s does not match the contract's %s", exponent, config.Exponent)
+	}
+	if exponent == "" {
+		exponent = config.Exponent
+	}
+
+	return maths.NewPower(exponent, config.IndexScale.BigInt(), config.BaseDecimals, config.PowerDecimals)
+}
+
+// PoolID returns the power pool of the contract, which positions are read
+// from and written to. A pool ID set in the config must be the same pool.
+func PoolID(configured uint64, config types.GetConfigResponse) (uint64, error) {
+	if config.PowerPool.ID == 0 {
+		return 0, fmt.Errorf("power contract config has no power pool")
+	}
+	if configured != 0 && configured != config.PowerPool.ID {
+		return 0, fmt.Errorf("configured pool_id %d is not the power contract's pool %d", configured, config.PowerPool.ID)
+	}
+	return config.PowerPool.ID, nil
 }
@@ -0,0 +1,218 @@
+package power
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+func TestQueryMsg(t *testing.T) {
+	for _, tc := range []struct {
+		msg  QueryMsg
+		want string
+	}{
+		{QueryMsg{Config: &empty{}}, `{"config":{}}`},
+		{QueryMsg{GetIndex: &periodRequest{Period: 3600}}, `{"get_index":{"period":3600}}`},
+		{QueryMsg{GetVault: &vaultRequest{VaultID: 7}}, `{"get_vault":{"vault_id":7}}`},
+		{QueryMsg{GetUserVaults: &userVaultsRequest{User: "osmo1bot"}}, `{"get_user_vaults":{"user":"osmo1bot"}}`},
+		{QueryMsg{GetNextVaultID: &empty{}}, `{"get_next_vault_id":{}}`},
+	} {
+		bz, err := json.Marshal(tc.msg)
+		assert.NilError(t, err)
+		assert.Equal(t, tc.want, string(bz))
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	for _, version := range []string{"0.1.0", "v0.1.3", "0.9.12-rc1"} {
+		assert.NilError(t, CheckVersion(version), version)
+	}
+
+	assert.ErrorContains(t, CheckVersion(""), "expected major.minor.patch")
+	assert.ErrorContains(t, CheckVersion("0.x.0"), "invalid version number")
+	assert.ErrorContains(t, CheckVersion("0.0.9"), "supported versions are 0.1.0 up to 1.0.0")
+	assert.ErrorContains(t, CheckVersion("1.0.0"), "supported versions")
+}
+
+func TestPricing(t *testing.T) {
+	config := types.GetConfigResponse{IndexScale: types.NewUint(10000)}
+
+	p, err := Pricing("", config)
+	assert.NilError(t, err)
+	assert.Equal(t, 2.0, p.Exponent())
+
+	config.Exponent = "3"
+	p, err = Pricing("", config)
+	assert.NilError(t, err)
+	assert.Equal(t, 3.0, p.Exponent())
+
+	_, err = Pricing("3", config)
+	assert.NilError(t, err)
+
+	_, err = Pricing("2", config)
+	assert.ErrorContains(t, err, "does not match the contract's 3")
+}
+
+func TestPoolID(t *testing.T) {
+	config := types.GetConfigResponse{PowerPool: types.Pool{ID: 2}}
+
+	id, err := PoolID(0, config)
+	assert.NilError(t, err)
+	assert.Equal(t, uint64(2), id)
+
+	id, err = PoolID(2, config)
+	assert.NilError(t, err)
+	assert.Equal(t, uint64(2), id)
+
+	_, err = PoolID(3, config)
+	assert.ErrorContains(t, err, "configured pool_id 3 is not the power contract's pool 2")
+
+	_, err = PoolID(0, types.GetConfigResponse{})
+	assert.ErrorContains(t, err, "has no power pool")
+}
+
+// vaultContract answers the vault queries of a contract holding the vaults,
+// returning at most maxPage user vaults per page
+type vaultContract struct {
+	wasmtypes.QueryClient
+	vaults  []types.UserVault
+	maxPage int
+	// removed vaults fail to load, every query fails when down
+	removed map[uint64]bool
+	down    bool
+
+	mu      sync.Mutex
+	queries int
+}
+
+func (v *vaultContract) SmartContractState(_ context.Context, req *wasmtypes.QuerySmartContractStateRequest, _ ...grpc.CallOption) (*wasmtypes.QuerySmartContractStateResponse, error) {
+	v.mu.Lock()
+	v.queries++
+	v.mu.Unlock()
+
+	if v.down {
+		return nil, errors.New("node down")
+	}
+
+	var msg QueryMsg
+	if err := json.Unmarshal(req.QueryData, &msg); err != nil {
+		return nil, err
+	}
+
+	var res interface{}
+	switch {
+	case msg.GetNextVaultID != nil:
+		res = len(v.vaults) + 1
+	case msg.GetVault != nil:
+		id := msg.GetVault.VaultID
+		if id == 0 || id > uint64(len(v.vaults)) || v.removed[id] {
+			return nil, errors.New("vault " + strconv.FormatUint(id, 10) + " not found")
+		}
+		res = v.vaults[id-1].GetVaultResponse
+	case msg.GetUserVaults != nil:
+		page := types.GetUserVaultsResponse{Vaults: []types.UserVault{}}
+		for _, vault := range v.vaults {
+			if vault.Operator != msg.GetUserVaults.User {
+				continue
+			}
+			if after := msg.GetUserVaults.StartAfter; after != nil && vault.ID <= *after {
+				continue
+			}
+			if len(page.Vaults) == v.maxPage || len(page.Vaults) == int(*msg.GetUserVaults.Limit) {
+				break
+			}
+			page.Vaults = append(page.Vaults, vault)
+		}
+		res = page
+	default:
+		return nil, errors.New("unsupported query")
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return &wasmtypes.QuerySmartContractStateResponse{Data: data}, nil
+}
+
+func newVaultContract(count, maxPage int) *vaultContract {
+	v := &vaultContract{maxPage: maxPage}
+	for id := 1; id <= count; id++ {
+		operator := "osmo1bot"
+		if id%3 == 0 {
+			operator = "osmo1other"
+		}
+		v.vaults = append(v.vaults, types.UserVault{
+			ID:               uint64(id),
+			GetVaultResponse: types.GetVaultResponse{Operator: operator, ShortAmount: strconv.Itoa(id)},
+		})
+	}
+	return v
+}
+
+func TestUserVaultsPagesPastShortPages(t *testing.T) {
+	// The contract caps pages at 10, below the 30 requested
+	contract := newVaultContract(75, 10)
+	c := NewClient(contract, "osmo1power", 0)
+
+	vaults, err := c.UserVaults(context.Background(), "osmo1bot")
+	assert.NilError(t, err)
+	assert.Equal(t, 50, len(vaults))
+	for i := 1; i < len(vaults); i++ {
+		assert.Assert(t, vaults[i].ID > vaults[i-1].ID)
+	}
+	assert.Equal(t, uint64(74), vaults[len(vaults)-1].ID)
+
+	// Five full pages and the empty one
+	assert.Equal(t, 6, contract.queries)
+
+	vaults, err = c.UserVaults(context.Background(), "osmo1nobody")
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(vaults))
+}
+
+func TestAllVaults(t *testing.T) {
+	contract := newVaultContract(65, 10)
+	c := NewClient(contract, "osmo1power", 0)
+
+	vaults, err := c.AllVaults(context.Background(), zap.NewNop())
+	assert.NilError(t, err)
+	assert.Equal(t, 65, len(vaults))
+	for i, vault := range vaults {
+		assert.Equal(t, uint64(i+1), vault.ID)
+		assert.Equal(t, strconv.Itoa(i+1), vault.ShortAmount)
+	}
+
+	vaults, err = NewClient(newVaultContract(0, 10), "osmo1power", 0).AllVaults(context.Background(), zap.NewNop())
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(vaults))
+}
+
+func TestAllVaultsSkipsVaultsThatFailToLoad(t *testing.T) {
+	contract := newVaultContract(65, 10)
+	contract.removed = map[uint64]bool{2: true, 40: true}
+	c := NewClient(contract, "osmo1power", 0)
+
+	vaults, err := c.AllVaults(context.Background(), zap.NewNop())
+	assert.NilError(t, err)
+	assert.Equal(t, 63, len(vaults))
+	for _, vault := range vaults {
+		assert.Assert(t, !contract.removed[vault.ID])
+		assert.Equal(t, strconv.FormatUint(vault.ID, 10), vault.ShortAmount)
+	}
+
+	// Only a failure to read the next vault id is an error
+	contract.down = true
+	_, err = c.AllVaults(context.Background(), zap.NewNop())
+	assert.ErrorContains(t, err, "node down")
+}
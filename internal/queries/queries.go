@@ -2,18 +2,48 @@ package queries
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"sync"
-
+	"strconv"
+	"time"
+
+	sdkmath "cosmossdk.io/math"
+	"github.com/cosmos/cosmos-sdk/client/grpc/tmservice"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	grpctypes "github.com/cosmos/cosmos-sdk/types/grpc"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
 	"github.com/osmosis-labs/osmosis/v21/tests/e2e/util"
 	cl "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/client/queryproto"
 	cltypes "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/types"
 	poolmanager "github.com/osmosis-labs/osmosis/v21/x/poolmanager/client/queryproto"
 	pmtypes "github.com/osmosis-labs/osmosis/v21/x/poolmanager/types"
 
+	"google.golang.org/grpc/metadata"
+
+	"github.com/margined-protocol/flood/internal/fetch"
 	"github.com/margined-protocol/flood/internal/types"
 )
 
+// AtHeight returns a context whose queries are answered at the block
+// height, through the x-cosmos-block-height metadata.
+func AtHeight(ctx context.Context, height int64) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, grpctypes.GRPCBlockHeightHeader, strconv.FormatInt(height, 10))
+}
+
+// GetLatestBlock returns the height and time of the node's latest block.
+func GetLatestBlock(ctx context.Context, client tmservice.ServiceClient) (types.Block, error) {
+	res, err := client.GetLatestBlock(ctx, &tmservice.GetLatestBlockRequest{})
+	if err != nil {
+		return types.Block{}, err
+	}
+
+	if res.SdkBlock == nil {
+		return types.Block{}, errors.New("latest block has no header")
+	}
+
+	return types.Block{Height: res.SdkBlock.Header.Height, Time: res.SdkBlock.Header.Time}, nil
+}
+
 func GetUserPositions(ctx context.Context, client cl.QueryClient, poolConfig types.Pool, user string) (*cl.UserPositionsResponse, error) {
 	// Now lets check if we have any open CL positions for the bot
 	req := cl.UserPositionsRequest{
@@ -36,8 +66,6 @@ func GetSpotPrice(ctx context.Context, client poolmanager.QueryClient, poolConfi
 		QuoteAssetDenom: poolConfig.QuoteDenom,
 	}
 
-	fmt.Println("Requesting spot price for pool", poolConfig.ID, "with base asset", poolConfig.BaseDenom, "and quote asset", poolConfig.QuoteDenom)
-
 	spotPrice, err := client.SpotPrice(ctx, &req)
 	if err != nil {
 		return "", err
@@ -46,24 +74,31 @@ func GetSpotPrice(ctx context.Context, client poolmanager.QueryClient, poolConfi
 	return spotPrice.SpotPrice, nil
 }
 
-func GetCurrentTick(ctx context.Context, client poolmanager.QueryClient, poolId uint64) (int64, error) {
-
-	poolReq := poolmanager.PoolRequest{PoolId: poolId}
-	res, err := client.Pool(ctx, &poolReq)
+// GetConcentratedPool returns the tokens and current tick of a
+// concentrated liquidity pool.
+func GetConcentratedPool(ctx context.Context, client poolmanager.QueryClient, poolId uint64) (types.ConcentratedPool, error) {
+	res, err := client.Pool(ctx, &poolmanager.PoolRequest{PoolId: poolId})
 	if err != nil {
-		return 0, err
+		return types.ConcentratedPool{}, err
 	}
 
 	var pool pmtypes.PoolI
 	err = util.Cdc.UnpackAny(res.Pool, &pool)
 	if err != nil {
-		return 0, err
+		return types.ConcentratedPool{}, err
 	}
 
-	currentTick := pool.(cltypes.ConcentratedPoolExtension).GetCurrentTick()
-
-	return currentTick, nil
+	clPool, ok := pool.(cltypes.ConcentratedPoolExtension)
+	if !ok {
+		return types.ConcentratedPool{}, fmt.Errorf("pool %d is not a concentrated liquidity pool", poolId)
+	}
 
+	return types.ConcentratedPool{
+		ID:          poolId,
+		Token0:      clPool.GetToken0(),
+		Token1:      clPool.GetToken1(),
+		CurrentTick: clPool.GetCurrentTick(),
+	}, nil
 }
 
 func GetTotalPoolLiquidity(ctx context.Context, client poolmanager.QueryClient, poolId uint64) (*poolmanager.TotalPoolLiquidityResponse, error) {
@@ -71,45 +106,70 @@ func GetTotalPoolLiquidity(ctx context.Context, client poolmanager.QueryClient,
 	return client.TotalPoolLiquidity(ctx, &poolmanager.TotalPoolLiquidityRequest{PoolId: poolId})
 }
 
-func GetSpotPrices(ctx context.Context, poolManagerClient poolmanager.QueryClient, config types.GetConfigResponse) (string, string, error) {
+// GetSpotPrices queries the base and power spot prices concurrently, each
+// within the timeout. The spot price is the quote asset per base asset, so
+// the base spot price is the quote asset per base asset and the power spot
+// price, queried with the base asset as base, is power per base asset.
+func GetSpotPrices(ctx context.Context, poolManagerClient poolmanager.QueryClient, config types.GetConfigResponse, timeout time.Duration) (string, string, error) {
+	power, base, err := config.PowerDenoms()
+	if err != nil {
+		return "", "", err
+	}
+	powerPool := types.Pool{ID: config.PowerPool.ID, BaseDenom: base, QuoteDenom: power}
+
 	var baseSpotPrice, powerSpotPrice string
-	var err error
-
-	// WaitGroup to synchronize goroutines
-	var wg sync.WaitGroup
-	wg.Add(2)
-
-	// Channel to capture errors
-	errChan := make(chan error, 2)
-
-	// Fetch base spot price
-	go func() {
-		defer wg.Done()
-		baseSpotPrice, err = GetSpotPrice(ctx, poolManagerClient, config.BasePool)
-		if err != nil {
-			errChan <- err
-		}
-	}()
-
-	// Fetch power spot price
-	go func() {
-		defer wg.Done()
-		powerSpotPrice, err = GetSpotPrice(ctx, poolManagerClient, config.PowerPool)
-		if err != nil {
-			errChan <- err
-		}
-	}()
-
-	// Wait for goroutines to complete
-	wg.Wait()
-	close(errChan)
-
-	// Check for errors
-	for e := range errChan {
-		if e != nil {
-			return "", "", e
-		}
+
+	err = fetch.All(ctx, timeout,
+		fetch.Query{Name: "base spot price", Run: func(ctx context.Context) (err error) {
+			baseSpotPrice, err = GetSpotPrice(ctx, poolManagerClient, config.BasePool)
+			return err
+		}},
+		fetch.Query{Name: "power spot price", Run: func(ctx context.Context) (err error) {
+			powerSpotPrice, err = GetSpotPrice(ctx, poolManagerClient, powerPool)
+			return err
+		}},
+	)
+	if err != nil {
+		return "", "", err
 	}
 
 	return baseSpotPrice, powerSpotPrice, nil
 }
+
+func GetBalance(ctx context.Context, client banktypes.QueryClient, address, denom string) (sdk.Coin, error) {
+	res, err := client.Balance(ctx, &banktypes.QueryBalanceRequest{Address: address, Denom: denom})
+	if err != nil {
+		return sdk.Coin{}, err
+	}
+
+	return *res.Balance, nil
+}
+
+// GetDenomMetadata returns the bank module's metadata of a denom.
+func GetDenomMetadata(ctx context.Context, client banktypes.QueryClient, denom string) (banktypes.Metadata, error) {
+	res, err := client.DenomMetadata(ctx, &banktypes.QueryDenomMetadataRequest{Denom: denom})
+	if err != nil {
+		return banktypes.Metadata{}, err
+	}
+
+	return res.Metadata, nil
+}
+
+// Estimator returns the amount out of a swap through a single pool.
+type Estimator interface {
+	EstimateSwap(ctx context.Context, poolID uint64, tokenIn sdk.Coin, outDenom string) (sdkmath.Int, error)
+}
+
+// EstimateSwap returns the amount out of swapping the token in through a
+// single pool.
+func EstimateSwap(ctx context.Context, client poolmanager.QueryClient, poolID uint64, tokenIn sdk.Coin, outDenom string) (sdkmath.Int, error) {
+	res, err := client.EstimateSwapExactAmountIn(ctx, &poolmanager.EstimateSwapExactAmountInRequest{
+		TokenIn: tokenIn.String(),
+		Routes:  []pmtypes.SwapAmountInRoute{{PoolId: poolID, TokenOutDenom: outDenom}},
+	})
+	if err != nil {
+		return sdkmath.Int{}, err
+	}
+
+	return res.TokenOutAmount, nil
+}
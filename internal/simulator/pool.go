@@ -0,0 +1,472 @@
+// Package simulator is an in-memory model of an Osmosis concentrated liquidity
+// pool built on the clmath package. It holds ticks, active liquidity and
+// positions, applies create and withdraw position messages and executes
+// swaps across initialised ticks so that strategy code can be exercised
+// against realistic position amounts and fills.
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	sdkmath "cosmossdk.io/math"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/osmosis-labs/osmosis/osmomath"
+	clquery "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/client/queryproto"
+	clmath "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/math"
+	model "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/model"
+	cltypes "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/types"
+	pmtypes "github.com/osmosis-labs/osmosis/v21/x/poolmanager/types"
+)
+
+var (
+	ErrInvalidTicks     = errors.New("invalid ticks")
+	ErrNoLiquidity      = errors.New("no liquidity")
+	ErrPositionNotFound = errors.New("position not found")
+	ErrNotOwner         = errors.New("sender does not own position")
+)
+
+// tick is the state stored for an initialised tick.
+type tick struct {
+	liquidityGross            osmomath.BigDec
+	liquidityNet              osmomath.BigDec
+	spreadRewardGrowthOutside [2]osmomath.BigDec
+}
+
+// Position is a liquidity position held in the pool.
+type Position struct {
+	ID        uint64
+	Owner     string
+	LowerTick int64
+	UpperTick int64
+	Liquidity osmomath.BigDec
+	JoinTime  time.Time
+
+	growthInsideLast [2]osmomath.BigDec
+	owed             [2]osmomath.BigDec
+}
+
+// Pool is a simulated concentrated liquidity pool.
+type Pool struct {
+	ID           uint64
+	Token0       string
+	Token1       string
+	TickSpacing  int64
+	SpreadFactor osmomath.BigDec
+
+	currentTick      int64
+	currentSqrtPrice osmomath.BigDec
+	liquidity        osmomath.BigDec
+
+	ticks     map[int64]*tick
+	positions map[uint64]*Position
+	nextID    uint64
+
+	spreadRewardGrowthGlobal [2]osmomath.BigDec
+
+	// Now is used for position join times
+	Now func() time.Time
+}
+
+// NewPool creates an empty pool with the current price set to the tick.
+func NewPool(id uint64, token0, token1 string, tickSpacing int64, spreadFactor osmomath.Dec, currentTick int64) (*Pool, error) {
+	sqrtPrice, err := clmath.TickToSqrtPrice(currentTick)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pool{
+		ID:                       id,
+		Token0:                   token0,
+		Token1:                   token1,
+		TickSpacing:              tickSpacing,
+		SpreadFactor:             osmomath.BigDecFromDec(spreadFactor),
+		currentTick:              currentTick,
+		currentSqrtPrice:         sqrtPrice,
+		liquidity:                osmomath.ZeroBigDec(),
+		ticks:                    make(map[int64]*tick),
+		positions:                make(map[uint64]*Position),
+		nextID:                   1,
+		spreadRewardGrowthGlobal: [2]osmomath.BigDec{osmomath.ZeroBigDec(), osmomath.ZeroBigDec()},
+		Now:                      time.Now,
+	}, nil
+}
+
+// CurrentTick returns the tick of the current price.
+func (p *Pool) CurrentTick() int64 { return p.currentTick }
+
+// CurrentSqrtPrice returns the current square root price.
+func (p *Pool) CurrentSqrtPrice() osmomath.BigDec { return p.currentSqrtPrice }
+
+// SpotPrice returns the current price of token0 in token1.
+func (p *Pool) SpotPrice() osmomath.BigDec { return p.currentSqrtPrice.Mul(p.currentSqrtPrice) }
+
+// Liquidity returns the active liquidity at the current tick.
+func (p *Pool) Liquidity() osmomath.BigDec { return p.liquidity }
+
+// Position returns the position with the id.
+func (p *Pool) Position(id uint64) (*Position, error) {
+	pos, ok := p.positions[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrPositionNotFound, id)
+	}
+	return pos, nil
+}
+
+// Positions returns all positions owned by the address ordered by id.
+func (p *Pool) Positions(owner string) []*Position {
+	var out []*Position
+	for _, pos := range p.positions {
+		if pos.Owner == owner {
+			out = append(out, pos)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// isActive returns true if the range includes the current tick.
+func (p *Pool) isActive(lowerTick, upperTick int64) bool {
+	return lowerTick <= p.currentTick && p.currentTick < upperTick
+}
+
+// amounts returns the tokens represented by liquidity over the range at the
+// current price, rounding up when depositing and down when withdrawing.
+func (p *Pool) amounts(lowerTick, upperTick int64, liquidity osmomath.BigDec, roundUp bool) (osmomath.BigDec, osmomath.BigDec, error) {
+	sqrtLower, sqrtUpper, err := clmath.TicksToSqrtPrice(lowerTick, upperTick)
+	if err != nil {
+		return osmomath.BigDec{}, osmomath.BigDec{}, err
+	}
+
+	zero := osmomath.ZeroBigDec()
+	switch {
+	case p.currentTick < lowerTick:
+		return clmath.CalcAmount0Delta(liquidity, sqrtLower, sqrtUpper, roundUp), zero, nil
+	case p.currentTick >= upperTick:
+		return zero, clmath.CalcAmount1Delta(liquidity, sqrtLower, sqrtUpper, roundUp), nil
+	default:
+		return clmath.CalcAmount0Delta(liquidity, p.currentSqrtPrice, sqrtUpper, roundUp),
+			clmath.CalcAmount1Delta(liquidity, sqrtLower, p.currentSqrtPrice, roundUp), nil
+	}
+}
+
+// PositionAmounts returns the tokens held by a position at the current price.
+func (p *Pool) PositionAmounts(id uint64) (sdk.Coin, sdk.Coin, error) {
+	pos, err := p.Position(id)
+	if err != nil {
+		return sdk.Coin{}, sdk.Coin{}, err
+	}
+
+	amount0, amount1, err := p.amounts(pos.LowerTick, pos.UpperTick, pos.Liquidity, false)
+	if err != nil {
+		return sdk.Coin{}, sdk.Coin{}, err
+	}
+
+	return sdk.NewCoin(p.Token0, amount0.Dec().TruncateInt()), sdk.NewCoin(p.Token1, amount1.Dec().TruncateInt()), nil
+}
+
+// ClaimableSpreadRewards returns the swap fees earned by a position.
+func (p *Pool) ClaimableSpreadRewards(id uint64) (sdk.Coins, error) {
+	pos, err := p.Position(id)
+	if err != nil {
+		return nil, err
+	}
+
+	owed := p.pendingRewards(pos)
+
+	return sdk.NewCoins(
+		sdk.NewCoin(p.Token0, owed[0].Dec().TruncateInt()),
+		sdk.NewCoin(p.Token1, owed[1].Dec().TruncateInt()),
+	), nil
+}
+
+// UserPositions returns the owner's positions in the same shape as the
+// concentrated liquidity UserPositions query.
+func (p *Pool) UserPositions(owner string) (*clquery.UserPositionsResponse, error) {
+	res := &clquery.UserPositionsResponse{}
+
+	for _, pos := range p.Positions(owner) {
+		asset0, asset1, err := p.PositionAmounts(pos.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		rewards, err := p.ClaimableSpreadRewards(pos.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		res.Positions = append(res.Positions, model.FullPositionBreakdown{
+			Position: model.Position{
+				PositionId: pos.ID,
+				Address:    pos.Owner,
+				PoolId:     p.ID,
+				LowerTick:  pos.LowerTick,
+				UpperTick:  pos.UpperTick,
+				JoinTime:   pos.JoinTime,
+				Liquidity:  pos.Liquidity.Dec(),
+			},
+			Asset0:                 asset0,
+			Asset1:                 asset1,
+			ClaimableSpreadRewards: rewards,
+		})
+	}
+
+	return res, nil
+}
+
+// Result is the outcome of applying a message to the pool.
+type Result struct {
+	PositionID    uint64
+	Amount0       sdkmath.Int
+	Amount1       sdkmath.Int
+	Liquidity     osmomath.Dec
+	SpreadRewards sdk.Coins
+	// Swap is set for swap messages
+	Swap *SwapResult
+}
+
+// Apply executes a create position, withdraw position or single hop swap
+// message against the pool.
+func (p *Pool) Apply(msg sdk.Msg) (*Result, error) {
+	switch m := msg.(type) {
+	case *cltypes.MsgCreatePosition:
+		if m.PoolId != p.ID {
+			return nil, fmt.Errorf("message for pool %d applied to pool %d", m.PoolId, p.ID)
+		}
+		return p.CreatePosition(m.Sender, m.LowerTick, m.UpperTick, m.TokensProvided)
+	case *cltypes.MsgWithdrawPosition:
+		return p.WithdrawPosition(m.Sender, m.PositionId, m.LiquidityAmount)
+	case *pmtypes.MsgSwapExactAmountIn:
+		if len(m.Routes) != 1 || m.Routes[0].PoolId != p.ID {
+			return nil, fmt.Errorf("swap must route through pool %d only", p.ID)
+		}
+		swap, err := p.SwapExactAmountIn(m.TokenIn)
+		if err != nil {
+			return nil, err
+		}
+		if swap.TokenOut.Denom != m.Routes[0].TokenOutDenom {
+			return nil, fmt.Errorf("swap out denom %s, route expects %s", swap.TokenOut.Denom, m.Routes[0].TokenOutDenom)
+		}
+		if swap.TokenOut.Amount.LT(m.TokenOutMinAmount) {
+			return nil, fmt.Errorf("token out %s below minimum %s", swap.TokenOut.Amount, m.TokenOutMinAmount)
+		}
+		return &Result{Swap: swap}, nil
+	default:
+		return nil, fmt.Errorf("unsupported message %T", msg)
+	}
+}
+
+// ApplyAll applies the messages in order, stopping at the first error.
+func (p *Pool) ApplyAll(msgs []sdk.Msg) ([]*Result, error) {
+	results := make([]*Result, 0, len(msgs))
+	for i, msg := range msgs {
+		res, err := p.Apply(msg)
+		if err != nil {
+			return results, fmt.Errorf("msg %d: %w", i, err)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// CreatePosition adds as much liquidity over the range as the provided
+// tokens allow and returns the amounts actually deposited.
+func (p *Pool) CreatePosition(owner string, lowerTick, upperTick int64, tokens sdk.Coins) (*Result, error) {
+	if err := p.validateTicks(lowerTick, upperTick); err != nil {
+		return nil, err
+	}
+
+	sqrtLower, sqrtUpper, err := clmath.TicksToSqrtPrice(lowerTick, upperTick)
+	if err != nil {
+		return nil, err
+	}
+
+	amount0, amount1 := tokens.AmountOf(p.Token0), tokens.AmountOf(p.Token1)
+
+	// Price the range by tick so a current price on a tick boundary is
+	// treated the same way as the active liquidity
+	sqrtPrice := p.currentSqrtPrice
+	if p.currentTick < lowerTick {
+		sqrtPrice = sqrtLower
+	} else if p.currentTick >= upperTick {
+		sqrtPrice = sqrtUpper
+	}
+
+	liq := osmomath.BigDecFromDec(clmath.GetLiquidityFromAmounts(sqrtPrice, sqrtLower, sqrtUpper, amount0, amount1))
+	if !liq.IsPositive() {
+		return nil, ErrNoLiquidity
+	}
+
+	used0, used1, err := p.amounts(lowerTick, upperTick, liq, true)
+	if err != nil {
+		return nil, err
+	}
+
+	p.updateTick(lowerTick, liq, false)
+	p.updateTick(upperTick, liq, true)
+
+	if p.isActive(lowerTick, upperTick) {
+		p.liquidity = p.liquidity.Add(liq)
+	}
+
+	pos := &Position{
+		ID:               p.nextID,
+		Owner:            owner,
+		LowerTick:        lowerTick,
+		UpperTick:        upperTick,
+		Liquidity:        liq,
+		JoinTime:         p.Now(),
+		growthInsideLast: p.growthInside(lowerTick, upperTick),
+		owed:             [2]osmomath.BigDec{osmomath.ZeroBigDec(), osmomath.ZeroBigDec()},
+	}
+	p.positions[pos.ID] = pos
+	p.nextID++
+
+	return &Result{
+		PositionID: pos.ID,
+		Amount0:    used0.Dec().TruncateInt(),
+		Amount1:    used1.Dec().TruncateInt(),
+		Liquidity:  liq.Dec(),
+	}, nil
+}
+
+// WithdrawPosition removes liquidity from a position and returns the tokens
+// withdrawn. Spread rewards are claimed and the position is deleted when all
+// of its liquidity is withdrawn, as on chain.
+func (p *Pool) WithdrawPosition(owner string, id uint64, liquidity osmomath.Dec) (*Result, error) {
+	pos, err := p.Position(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if pos.Owner != owner {
+		return nil, ErrNotOwner
+	}
+
+	liq := osmomath.BigDecFromDec(liquidity)
+	if !liq.IsPositive() || liq.GT(pos.Liquidity) {
+		return nil, fmt.Errorf("invalid liquidity %s for position with %s", liquidity, pos.Liquidity)
+	}
+
+	pos.owed = p.pendingRewards(pos)
+	pos.growthInsideLast = p.growthInside(pos.LowerTick, pos.UpperTick)
+
+	amount0, amount1, err := p.amounts(pos.LowerTick, pos.UpperTick, liq, false)
+	if err != nil {
+		return nil, err
+	}
+
+	neg := liq.Neg()
+	p.updateTick(pos.LowerTick, neg, false)
+	p.updateTick(pos.UpperTick, neg, true)
+
+	if p.isActive(pos.LowerTick, pos.UpperTick) {
+		p.liquidity = p.liquidity.Sub(liq)
+	}
+
+	pos.Liquidity = pos.Liquidity.Sub(liq)
+
+	res := &Result{
+		PositionID: id,
+		Amount0:    amount0.Dec().TruncateInt(),
+		Amount1:    amount1.Dec().TruncateInt(),
+		Liquidity:  liquidity,
+	}
+
+	if pos.Liquidity.IsZero() {
+		res.SpreadRewards = sdk.NewCoins(
+			sdk.NewCoin(p.Token0, pos.owed[0].Dec().TruncateInt()),
+			sdk.NewCoin(p.Token1, pos.owed[1].Dec().TruncateInt()),
+		)
+		delete(p.positions, id)
+	}
+
+	return res, nil
+}
+
+func (p *Pool) validateTicks(lowerTick, upperTick int64) error {
+	if lowerTick >= upperTick {
+		return fmt.Errorf("%w: lower tick %d must be less than upper tick %d", ErrInvalidTicks, lowerTick, upperTick)
+	}
+	if lowerTick < cltypes.MinInitializedTick || upperTick > cltypes.MaxTick {
+		return fmt.Errorf("%w: ticks %d, %d out of bounds", ErrInvalidTicks, lowerTick, upperTick)
+	}
+	if lowerTick%p.TickSpacing != 0 || upperTick%p.TickSpacing != 0 {
+		return fmt.Errorf("%w: ticks %d, %d not divisible by spacing %d", ErrInvalidTicks, lowerTick, upperTick, p.TickSpacing)
+	}
+	return nil
+}
+
+// updateTick adds liquidity delta to the tick, the net liquidity is added
+// when crossed from below for lower ticks and subtracted for upper ticks.
+func (p *Pool) updateTick(index int64, delta osmomath.BigDec, upper bool) {
+	t, ok := p.ticks[index]
+	if !ok {
+		t = &tick{
+			liquidityGross: osmomath.ZeroBigDec(),
+			liquidityNet:   osmomath.ZeroBigDec(),
+			spreadRewardGrowthOutside: [2]osmomath.BigDec{
+				osmomath.ZeroBigDec(), osmomath.ZeroBigDec(),
+			},
+		}
+		// By convention all growth so far happened below an initialised tick
+		if index <= p.currentTick {
+			t.spreadRewardGrowthOutside = p.spreadRewardGrowthGlobal
+		}
+		p.ticks[index] = t
+	}
+
+	t.liquidityGross = t.liquidityGross.Add(delta)
+	if upper {
+		t.liquidityNet = t.liquidityNet.Sub(delta)
+	} else {
+		t.liquidityNet = t.liquidityNet.Add(delta)
+	}
+
+	if t.liquidityGross.IsZero() {
+		delete(p.ticks, index)
+	}
+}
+
+// growthInside returns the spread reward growth per unit of liquidity
+// accumulated inside the range.
+func (p *Pool) growthInside(lowerTick, upperTick int64) [2]osmomath.BigDec {
+	var inside [2]osmomath.BigDec
+	for i := range inside {
+		global := p.spreadRewardGrowthGlobal[i]
+
+		below := osmomath.ZeroBigDec()
+		if t, ok := p.ticks[lowerTick]; ok {
+			below = t.spreadRewardGrowthOutside[i]
+			if p.currentTick < lowerTick {
+				below = global.Sub(below)
+			}
+		}
+
+		above := osmomath.ZeroBigDec()
+		if t, ok := p.ticks[upperTick]; ok {
+			above = t.spreadRewardGrowthOutside[i]
+			if p.currentTick >= upperTick {
+				above = global.Sub(above)
+			}
+		}
+
+		inside[i] = global.Sub(below).Sub(above)
+	}
+	return inside
+}
+
+// pendingRewards returns the rewards owed to a position including growth
+// since it was last updated.
+func (p *Pool) pendingRewards(pos *Position) [2]osmomath.BigDec {
+	inside := p.growthInside(pos.LowerTick, pos.UpperTick)
+
+	var owed [2]osmomath.BigDec
+	for i := range owed {
+		owed[i] = pos.owed[i].Add(inside[i].Sub(pos.growthInsideLast[i]).Mul(pos.Liquidity))
+	}
+	return owed
+}
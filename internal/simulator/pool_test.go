@@ -0,0 +1,116 @@
+package simulator
+
+import (
+	"errors"
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/osmosis-labs/osmosis/osmomath"
+	cltypes "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/types"
+	"gotest.tools/assert"
+)
+
+const (
+	owner  = "osmo1owner"
+	denom0 = "uosmo"
+	denom1 = "usqosmo"
+)
+
+func newPool(t *testing.T) *Pool {
+	t.Helper()
+	p, err := NewPool(1, denom0, denom1, 100, osmomath.MustNewDecFromStr("0.002"), 0)
+	assert.NilError(t, err)
+	return p
+}
+
+func TestCreatePositionAmounts(t *testing.T) {
+	p := newPool(t)
+
+	// Entirely above the current price only takes token0
+	above, err := p.CreatePosition(owner, 1000, 2000, sdk.NewCoins(sdk.NewInt64Coin(denom0, 1_000_000), sdk.NewInt64Coin(denom1, 1_000_000)))
+	assert.NilError(t, err)
+	assert.Assert(t, above.Amount0.IsPositive())
+	assert.Assert(t, above.Amount1.IsZero())
+	assert.Assert(t, p.Liquidity().IsZero())
+
+	// Entirely below the current price only takes token1
+	below, err := p.CreatePosition(owner, -2000, -1000, sdk.NewCoins(sdk.NewInt64Coin(denom1, 1_000_000)))
+	assert.NilError(t, err)
+	assert.Assert(t, below.Amount0.IsZero())
+	assert.Assert(t, below.Amount1.IsPositive())
+
+	// Straddling the current price takes both and becomes active
+	straddle, err := p.CreatePosition(owner, -1000, 1000, sdk.NewCoins(sdk.NewInt64Coin(denom0, 1_000_000), sdk.NewInt64Coin(denom1, 1_000_000)))
+	assert.NilError(t, err)
+	assert.Assert(t, straddle.Amount0.IsPositive() && straddle.Amount1.IsPositive())
+	assert.Equal(t, p.Liquidity().String(), osmomath.BigDecFromDec(straddle.Liquidity).String())
+
+	_, err = p.CreatePosition(owner, 1000, 1050, sdk.NewCoins(sdk.NewInt64Coin(denom0, 1)))
+	assert.Assert(t, errors.Is(err, ErrInvalidTicks))
+}
+
+func TestSwapFillsRangeAndEarnsRewards(t *testing.T) {
+	p := newPool(t)
+
+	sell, err := p.CreatePosition(owner, 100, 1000, sdk.NewCoins(sdk.NewInt64Coin(denom0, 1_000_000)))
+	assert.NilError(t, err)
+
+	// Buy all of token0 and more, the price must cross the whole range
+	res, err := p.SwapExactAmountIn(sdk.NewInt64Coin(denom1, 2_000_000))
+	assert.NilError(t, err)
+	assert.Equal(t, 2, res.TicksCrossed)
+	assert.Equal(t, int64(1000), p.CurrentTick())
+	assert.Assert(t, p.Liquidity().IsZero())
+	assert.Assert(t, res.TokenOut.Amount.LTE(sell.Amount0))
+	assert.Assert(t, res.TokenOut.Amount.GT(sdk.NewInt(999_990)))
+
+	amount0, amount1, err := p.PositionAmounts(sell.PositionID)
+	assert.NilError(t, err)
+	assert.Assert(t, amount0.IsZero())
+	assert.Assert(t, amount1.Amount.IsPositive())
+
+	rewards, err := p.ClaimableSpreadRewards(sell.PositionID)
+	assert.NilError(t, err)
+	assert.Assert(t, rewards.AmountOf(denom1).IsPositive())
+
+	// Full withdrawal claims rewards and removes the position
+	pos, err := p.Position(sell.PositionID)
+	assert.NilError(t, err)
+	out, err := p.Apply(&cltypes.MsgWithdrawPosition{PositionId: pos.ID, Sender: owner, LiquidityAmount: pos.Liquidity.Dec()})
+	assert.NilError(t, err)
+	assert.Assert(t, out.Amount1.Equal(amount1.Amount))
+	assert.Assert(t, out.SpreadRewards.AmountOf(denom1).Equal(rewards.AmountOf(denom1)))
+
+	_, err = p.Position(sell.PositionID)
+	assert.Assert(t, errors.Is(err, ErrPositionNotFound))
+}
+
+func TestSwapToTickCrossesEmptyRanges(t *testing.T) {
+	p := newPool(t)
+
+	_, err := p.CreatePosition(owner, -1000, -500, sdk.NewCoins(sdk.NewInt64Coin(denom1, 1_000_000)))
+	assert.NilError(t, err)
+
+	res, err := p.SwapToTick(-800)
+	assert.NilError(t, err)
+	assert.Equal(t, int64(-800), p.CurrentTick())
+	assert.Equal(t, 1, res.TicksCrossed)
+	assert.Assert(t, res.TokenIn.Amount.IsPositive())
+	assert.Assert(t, p.Liquidity().IsPositive())
+
+	res, err = p.SwapToTick(500)
+	assert.NilError(t, err)
+	assert.Equal(t, int64(500), p.CurrentTick())
+	assert.Assert(t, p.Liquidity().IsZero())
+	assert.Equal(t, denom1, res.TokenIn.Denom)
+}
+
+func TestWithdrawRequiresOwner(t *testing.T) {
+	p := newPool(t)
+
+	res, err := p.CreatePosition(owner, -100, 100, sdk.NewCoins(sdk.NewInt64Coin(denom0, 1_000), sdk.NewInt64Coin(denom1, 1_000)))
+	assert.NilError(t, err)
+
+	_, err = p.WithdrawPosition("osmo1other", res.PositionID, res.Liquidity)
+	assert.Assert(t, errors.Is(err, ErrNotOwner))
+}
@@ -0,0 +1,222 @@
+package simulator
+
+import (
+	"fmt"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/osmosis-labs/osmosis/osmomath"
+	clmath "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/math"
+	cltypes "github.com/osmosis-labs/osmosis/v21/x/concentrated-liquidity/types"
+)
+
+// SwapResult is the outcome of a swap against the pool.
+type SwapResult struct {
+	TokenIn       sdk.Coin
+	TokenOut      sdk.Coin
+	SpreadRewards sdk.Coin
+	TicksCrossed  int
+}
+
+// SwapExactAmountIn swaps the token in for the other pool token, crossing
+// initialised ticks until the amount is used or liquidity runs out.
+func (p *Pool) SwapExactAmountIn(tokenIn sdk.Coin) (*SwapResult, error) {
+	var zeroForOne bool
+	var limit osmomath.BigDec
+
+	switch tokenIn.Denom {
+	case p.Token0:
+		zeroForOne, limit = true, osmomath.BigDecFromDec(cltypes.MinSqrtPrice)
+	case p.Token1:
+		zeroForOne, limit = false, osmomath.BigDecFromDec(cltypes.MaxSqrtPrice)
+	default:
+		return nil, fmt.Errorf("denom %s not in pool", tokenIn.Denom)
+	}
+
+	if !tokenIn.Amount.IsPositive() {
+		return nil, fmt.Errorf("amount in must be positive")
+	}
+
+	amount := osmomath.BigDecFromSDKInt(tokenIn.Amount)
+	res := p.swap(zeroForOne, &amount, limit)
+
+	if res.TokenIn.IsZero() {
+		return nil, ErrNoLiquidity
+	}
+
+	return res, nil
+}
+
+// SwapToTick moves the price to the tick, swapping whatever is needed against
+// the liquidity in between. Ranges with no liquidity are skipped over, which
+// makes it suitable for replaying a recorded price path.
+func (p *Pool) SwapToTick(target int64) (*SwapResult, error) {
+	sqrtTarget, err := clmath.TickToSqrtPrice(target)
+	if err != nil {
+		return nil, err
+	}
+
+	zeroForOne := sqrtTarget.LT(p.currentSqrtPrice)
+
+	return p.swap(zeroForOne, nil, sqrtTarget), nil
+}
+
+// swap moves the price towards the limit. If amount is not nil the swap stops
+// once the amount, including the spread factor, has been used.
+func (p *Pool) swap(zeroForOne bool, amount *osmomath.BigDec, limit osmomath.BigDec) *SwapResult {
+	inIdx, denomIn, denomOut := 1, p.Token1, p.Token0
+	if zeroForOne {
+		inIdx, denomIn, denomOut = 0, p.Token0, p.Token1
+	}
+
+	one := osmomath.OneBigDec()
+	totalIn, totalOut, totalFee := osmomath.ZeroBigDec(), osmomath.ZeroBigDec(), osmomath.ZeroBigDec()
+	crossed := 0
+
+	for {
+		if amount != nil && !amount.IsPositive() {
+			break
+		}
+		if (zeroForOne && p.currentSqrtPrice.LTE(limit)) || (!zeroForOne && p.currentSqrtPrice.GTE(limit)) {
+			break
+		}
+
+		nextTick, hasNext := p.nextInitializedTick(zeroForOne)
+
+		sqrtTarget, crossing := limit, false
+		if hasNext {
+			sqrtNext, err := clmath.TickToSqrtPrice(nextTick)
+			// Moving up a tick is crossed on reaching it, moving down only
+			// once the price goes below it
+			if err == nil && ((zeroForOne && sqrtNext.GT(limit)) || (!zeroForOne && sqrtNext.LTE(limit))) {
+				sqrtTarget, crossing = sqrtNext, true
+			}
+		}
+
+		// Nothing to trade against, jump straight to the next tick or limit
+		if p.liquidity.IsZero() {
+			if amount != nil && !hasNext {
+				break
+			}
+			p.currentSqrtPrice = sqrtTarget
+			if crossing {
+				p.cross(nextTick, zeroForOne)
+				crossed++
+			} else {
+				p.setTickFromPrice(zeroForOne, nextTick, hasNext)
+			}
+			continue
+		}
+
+		var maxIn osmomath.BigDec
+		if zeroForOne {
+			maxIn = clmath.CalcAmount0Delta(p.liquidity, sqrtTarget, p.currentSqrtPrice, true)
+		} else {
+			maxIn = clmath.CalcAmount1Delta(p.liquidity, p.currentSqrtPrice, sqrtTarget, true)
+		}
+
+		stepIn, sqrtNew := maxIn, sqrtTarget
+		stepFee := maxIn.Mul(p.SpreadFactor).Quo(one.Sub(p.SpreadFactor))
+
+		if amount != nil {
+			remainingLessFee := amount.Mul(one.Sub(p.SpreadFactor))
+			if remainingLessFee.LT(maxIn) {
+				stepIn, stepFee = remainingLessFee, amount.Sub(remainingLessFee)
+				if zeroForOne {
+					sqrtNew = clmath.GetNextSqrtPriceFromAmount0InRoundingUp(p.currentSqrtPrice, p.liquidity, stepIn)
+				} else {
+					sqrtNew = clmath.GetNextSqrtPriceFromAmount1InRoundingDown(p.currentSqrtPrice, p.liquidity, stepIn)
+				}
+			}
+		}
+
+		var stepOut osmomath.BigDec
+		if zeroForOne {
+			stepOut = clmath.CalcAmount1Delta(p.liquidity, sqrtNew, p.currentSqrtPrice, false)
+		} else {
+			stepOut = clmath.CalcAmount0Delta(p.liquidity, p.currentSqrtPrice, sqrtNew, false)
+		}
+
+		p.spreadRewardGrowthGlobal[inIdx] = p.spreadRewardGrowthGlobal[inIdx].Add(stepFee.Quo(p.liquidity))
+
+		totalIn, totalOut, totalFee = totalIn.Add(stepIn), totalOut.Add(stepOut), totalFee.Add(stepFee)
+		if amount != nil {
+			remaining := amount.Sub(stepIn).Sub(stepFee)
+			amount = &remaining
+		}
+
+		progressed := !sqrtNew.Equal(p.currentSqrtPrice)
+		p.currentSqrtPrice = sqrtNew
+
+		if crossing && sqrtNew.Equal(sqrtTarget) {
+			p.cross(nextTick, zeroForOne)
+			crossed++
+			continue
+		}
+
+		p.setTickFromPrice(zeroForOne, nextTick, hasNext)
+
+		if !progressed {
+			break
+		}
+	}
+
+	return &SwapResult{
+		TokenIn:       sdk.NewCoin(denomIn, totalIn.Add(totalFee).Ceil().Dec().TruncateInt()),
+		TokenOut:      sdk.NewCoin(denomOut, totalOut.Dec().TruncateInt()),
+		SpreadRewards: sdk.NewCoin(denomIn, totalFee.Dec().TruncateInt()),
+		TicksCrossed:  crossed,
+	}
+}
+
+// nextInitializedTick returns the next tick that would be crossed moving in
+// the direction of the swap.
+func (p *Pool) nextInitializedTick(zeroForOne bool) (int64, bool) {
+	var next int64
+	found := false
+	for index := range p.ticks {
+		if zeroForOne && index <= p.currentTick && (!found || index > next) {
+			next, found = index, true
+		}
+		if !zeroForOne && index > p.currentTick && (!found || index < next) {
+			next, found = index, true
+		}
+	}
+	return next, found
+}
+
+// cross moves the current tick over an initialised tick, updating active
+// liquidity and flipping the reward growth recorded outside it.
+func (p *Pool) cross(index int64, zeroForOne bool) {
+	t := p.ticks[index]
+	for i := range t.spreadRewardGrowthOutside {
+		t.spreadRewardGrowthOutside[i] = p.spreadRewardGrowthGlobal[i].Sub(t.spreadRewardGrowthOutside[i])
+	}
+
+	if zeroForOne {
+		p.liquidity = p.liquidity.Sub(t.liquidityNet)
+		p.currentTick = index - 1
+	} else {
+		p.liquidity = p.liquidity.Add(t.liquidityNet)
+		p.currentTick = index
+	}
+}
+
+// setTickFromPrice updates the current tick after a move that stopped short
+// of the next initialised tick, clamping so the tick is never past it.
+func (p *Pool) setTickFromPrice(zeroForOne bool, nextTick int64, hasNext bool) {
+	current, err := clmath.CalculateSqrtPriceToTick(p.currentSqrtPrice)
+	if err != nil {
+		return
+	}
+
+	if hasNext {
+		if zeroForOne && current < nextTick {
+			current = nextTick
+		}
+		if !zeroForOne && current >= nextTick {
+			current = nextTick - 1
+		}
+	}
+
+	p.currentTick = current
+}
@@ -0,0 +1,74 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+
+	sdkmath "cosmossdk.io/math"
+)
+
+// Amount is a token amount in the config. A TOML integer is in raw units,
+// e.g. 1500500000, and a string is in whole units converted with the
+// decimals of the denom, e.g. "1500.5".
+type Amount struct {
+	value string
+	whole bool
+}
+
+// RawAmount returns an amount in raw units.
+func RawAmount(raw sdkmath.Int) Amount {
+	return Amount{value: raw.String()}
+}
+
+// WholeAmount returns an amount in whole units.
+func WholeAmount(value string) Amount {
+	return Amount{value: value, whole: true}
+}
+
+// IsWhole reports whether the amount is in whole units and needs the
+// decimals of its denom.
+func (a Amount) IsWhole() bool {
+	return a.whole
+}
+
+// Value returns the amount as written, in raw or whole units.
+func (a Amount) Value() string {
+	if a.value == "" {
+		return "0"
+	}
+	return a.value
+}
+
+// Int returns an amount in raw units, it fails for whole units.
+func (a Amount) Int() (sdkmath.Int, error) {
+	if a.whole {
+		return sdkmath.Int{}, fmt.Errorf("amount %q is in whole units, convert it with the denom's decimals", a.value)
+	}
+	i, ok := sdkmath.NewIntFromString(a.Value())
+	if !ok {
+		return sdkmath.Int{}, fmt.Errorf("invalid amount: %s", a.value)
+	}
+	return i, nil
+}
+
+func (a Amount) String() string {
+	if a.whole {
+		return strconv.Quote(a.value)
+	}
+	return a.Value()
+}
+
+func (a *Amount) UnmarshalTOML(v interface{}) error {
+	switch v := v.(type) {
+	case int64:
+		if v < 0 {
+			return fmt.Errorf("amount must not be negative: %d", v)
+		}
+		*a = RawAmount(sdkmath.NewInt(v))
+	case string:
+		*a = WholeAmount(v)
+	default:
+		return fmt.Errorf("amount must be an integer in raw units or a string in whole units, got %T", v)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+package types
+
+// OrDefault returns the value of an optional config setting, or the
+// fallback when it is not set.
+func OrDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
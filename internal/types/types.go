@@ -1,14 +1,21 @@
 package types
 
+import (
+	"fmt"
+	"time"
+)
+
 type SigningKey struct {
 	AppName string `toml:"app_name"`
 	Backend string `toml:"backend"`
 	RootDir string `toml:"root_dir"`
 }
 
+// Asset sets the decimals of a denom, used to convert amounts written in
+// whole units.
 type Asset struct {
-	Decimals uint64 `toml:"decimals"`
-	Denom    string `toml:"denom"`
+	Decimals uint64 `toml:"decimals" json:"decimals"`
+	Denom    string `toml:"denom" json:"denom"`
 }
 
 type PowerPool struct {
@@ -16,28 +23,228 @@ type PowerPool struct {
 	BaseAsset       string `toml:"base_asset"`
 	QuoteAsset      string `toml:"quote_asset"`
 	ContractAddress string `toml:"contract_address"`
+	// Exponent of the power perpetual, 2 unless the contract reports one
+	Exponent string `toml:"exponent"`
 }
 
 type Position struct {
-	DefaultToken0Amount int64  `toml:"default_token_0_amount"`
-	DefaultToken1Amount int64  `toml:"default_token_1_amount"`
-	Spread              string `toml:"spread"`
-	LpSpread            string `toml:"lp_spread"`
+	// Inventory deployed when no positions are open, an integer in raw units
+	// or a string in whole units
+	DefaultToken0Amount Amount `toml:"default_token_0_amount"`
+	DefaultToken1Amount Amount `toml:"default_token_1_amount"`
+	// BalanceShare deploys this fraction of each available balance instead
+	// of the default amounts
+	BalanceShare string `toml:"balance_share"`
+	// GasReserve is kept in the wallet for fees, in the fee denom
+	GasReserve Amount `toml:"gas_reserve"`
+	// Spread is the width of both sides unless overridden per side
+	Spread     string `toml:"spread"`
+	BuySpread  string `toml:"buy_spread"`
+	SellSpread string `toml:"sell_spread"`
+	// InnerGap is the minimum distance in ticks between the ranges and the
+	// current tick, it is never less than the tick spacing
+	InnerGap int64  `toml:"inner_gap"`
+	Ladder   Ladder `toml:"ladder"`
+	// Rebalance swaps inventory before redeploying it
+	Rebalance Rebalance `toml:"rebalance"`
+}
+
+type Ladder struct {
+	// Ranges per side, 0 places a single range on each side
+	Ranges int `toml:"ranges"`
+	// Offsets from the reference price to the inner edge of each range, each
+	// range extends to the next one and the last to the spread
+	BuyOffsets  []string `toml:"buy_offsets"`
+	SellOffsets []string `toml:"sell_offsets"`
+	// Distribution of inventory across ranges: uniform, linear or exponential
+	Distribution string `toml:"distribution"`
+	// Decay is the size ratio between neighbouring ranges for exponential
+	Decay string `toml:"decay"`
+}
+
+type NotifierBackend struct {
+	// Type is one of webhook, slack or telegram
+	Type        string   `toml:"type"`
+	URL         string   `toml:"url"`
+	Token       string   `toml:"token"`
+	ChatID      string   `toml:"chat_id"`
+	MinSeverity string   `toml:"min_severity"`
+	Events      []string `toml:"events"`
+}
+
+type Notifier struct {
+	DedupWindow     time.Duration     `toml:"dedup_window"`
+	DedupPath       string            `toml:"dedup_path"`
+	Timeout         time.Duration     `toml:"timeout"`
+	LowGasThreshold Amount            `toml:"low_gas_threshold"`
+	Backends        []NotifierBackend `toml:"backends"`
+}
+
+type ProtocolPrices struct {
+	Enabled bool `toml:"enabled"`
+	// TwapPeriod is the window of the time weighted prices
+	TwapPeriod time.Duration `toml:"twap_period"`
+	// MaxDeviation is the relative difference between the protocol and
+	// local prices that raises an alert
+	MaxDeviation string `toml:"max_deviation"`
+	// UseProtocol prices the premium from the protocol's mark and index
+	UseProtocol bool `toml:"use_protocol"`
+}
+
+type Endpoints struct {
+	// GRPC and RPC addresses in order of preference, grpc_server_address and
+	// rpc_server_address are used when empty. A gRPC address starting with
+	// https:// is dialled with TLS
+	GRPC []string `toml:"grpc"`
+	RPC  []string `toml:"rpc"`
+	// CAFile verifies TLS endpoints against these certificates instead of
+	// the system's
+	CAFile string `toml:"ca_file"`
+	// MaxHeightLag is how many blocks an endpoint may trail the highest
+	// before it is skipped
+	MaxHeightLag int64 `toml:"max_height_lag"`
+	// Timeout of each health check
+	Timeout time.Duration `toml:"timeout"`
+	// QueryTimeout is the deadline of each query, 10s by default
+	QueryTimeout time.Duration `toml:"query_timeout"`
+}
+
+type Daemon struct {
+	Interval time.Duration `toml:"interval"`
+}
+
+type Admin struct {
+	ListenAddress string `toml:"listen_address"`
+	Token         string `toml:"token"`
+}
+
+type Rebalance struct {
+	Enabled bool `toml:"enabled"`
+	// TargetRatio is the share of inventory value to hold in token0
+	TargetRatio string `toml:"target_ratio"`
+	// Band is how far the token0 share may drift from the target before a
+	// swap brings it back
+	Band string `toml:"band"`
+	// MaxSlippage sets the minimum amount out of the swap
+	MaxSlippage string `toml:"max_slippage"`
+}
+
+type Hedge struct {
+	Enabled bool `toml:"enabled"`
+	// Target is the net base asset delta to hold
+	Target Amount `toml:"target"`
+	// Band is how far the delta may drift from the target before hedging
+	Band Amount `toml:"band"`
+	// MaxTrade caps the base asset amount of a single hedge, 0 is unlimited
+	MaxTrade Amount `toml:"max_trade"`
+	// MaxSlippage sets the minimum amount out of the hedge trade
+	MaxSlippage string `toml:"max_slippage"`
+}
+
+type Arbitrage struct {
+	Enabled bool `toml:"enabled"`
+	// MinPremium is the absolute premium at which to look for a trade
+	MinPremium string `toml:"min_premium"`
+	// MinProfit in the base asset after the contract fee
+	MinProfit Amount `toml:"min_profit"`
+	// MaxSize is the most power minted or burned in one trade
+	MaxSize Amount `toml:"max_size"`
+	// MaxImpact bounds the average swap price against spot, sizing trades
+	// to the depth of the power pool
+	MaxImpact string `toml:"max_impact"`
+	// CollateralRatio is the collateral value per unit of debt value when
+	// minting
+	CollateralRatio string `toml:"collateral_ratio"`
+	// VaultID is the vault minted into and burned from, minting with 0
+	// opens a new vault and burning requires one
+	VaultID uint64 `toml:"vault_id"`
+	// MaxSlippage sets the minimum amount out against the estimate
+	MaxSlippage string `toml:"max_slippage"`
+}
+
+type Vaults struct {
+	Enabled bool `toml:"enabled"`
+	// LiquidationRatio is the collateral ratio below which the contract
+	// liquidates a vault
+	LiquidationRatio string `toml:"liquidation_ratio"`
+	// WarningRatio is the ratio at which a vault is topped up
+	WarningRatio string `toml:"warning_ratio"`
+	// TargetRatio is the ratio a vault is restored to
+	TargetRatio string `toml:"target_ratio"`
+	// Action is deposit, burn or auto to deposit when the wallet holds
+	// enough collateral and burn otherwise
+	Action string `toml:"action"`
+}
+
+type Liquidation struct {
+	// LiquidationRatio is the collateral ratio below which a vault can be
+	// liquidated
+	LiquidationRatio string `toml:"liquidation_ratio"`
+	// Bonus is the share of the debt value paid to the liquidator on top
+	// of the debt value in collateral
+	Bonus string `toml:"bonus"`
+	// MinProfit in the base asset after sourcing the power
+	MinProfit Amount `toml:"min_profit"`
+	// BuyPower swaps the base asset for the power missing from the wallet
+	BuyPower bool `toml:"buy_power"`
+	// MaxSlippage bounds the base asset paid for power against spot
+	MaxSlippage string `toml:"max_slippage"`
+}
+
+type Store struct {
+	// Path of a JSON file keeping cycle results across runs, results are
+	// only kept in memory when empty
+	Path string `toml:"path"`
+	// Size is the number of results kept
+	Size int `toml:"size"`
+}
+
+type Volatility struct {
+	Enabled bool `toml:"enabled"`
+	// Samples is the number of stored cycles used for the estimate
+	Samples int `toml:"samples"`
+	// MinSamples is the number of price returns needed before the estimate
+	// replaces the configured spread
+	MinSamples int `toml:"min_samples"`
+	// Horizon the ranges should cover, e.g. "24h"
+	Horizon time.Duration `toml:"horizon"`
+	// Multiplier is the number of standard deviations each side spans
+	Multiplier string `toml:"multiplier"`
+	MinSpread  string `toml:"min_spread"`
+	MaxSpread  string `toml:"max_spread"`
 }
 
 type Config struct {
-	AddressPrefix     string     `toml:"address_prefix"`
-	Fees              string     `toml:"fees"`
-	GasAdjustment     float64    `toml:"gas_adjustment"`
-	Gas               string     `toml:"gas"`
-	GRPCServerAddress string     `toml:"grpc_server_address"`
-	Key               SigningKey `toml:"key"`
-	Memo              string     `toml:"memo"`
-	PowerPool         PowerPool  `toml:"power_pool"`
-	RPCServerAddress  string     `toml:"rpc_server_address"`
-	WebsocketPath     string     `toml:"websocket_path"`
-	SignerAccount     string     `toml:"signer_account"`
-	Position          Position   `toml:"position"`
+	AddressPrefix     string         `toml:"address_prefix"`
+	Fees              string         `toml:"fees"`
+	FeeGranter        string         `toml:"fee_granter"`
+	GasAdjustment     float64        `toml:"gas_adjustment"`
+	Gas               string         `toml:"gas"`
+	GRPCServerAddress string         `toml:"grpc_server_address"`
+	Key               SigningKey     `toml:"key"`
+	Memo              string         `toml:"memo"`
+	PowerPool         PowerPool      `toml:"power_pool"`
+	RPCServerAddress  string         `toml:"rpc_server_address"`
+	WebsocketPath     string         `toml:"websocket_path"`
+	Endpoints         Endpoints      `toml:"endpoints"`
+	SignerAccount     string         `toml:"signer_account"`
+	Position          Position       `toml:"position"`
+	Notifier          Notifier       `toml:"notifier"`
+	ProtocolPrices    ProtocolPrices `toml:"protocol_prices"`
+	Daemon            Daemon         `toml:"daemon"`
+	Admin             Admin          `toml:"admin"`
+	Store             Store          `toml:"store"`
+	Volatility        Volatility     `toml:"volatility"`
+	Hedge             Hedge          `toml:"hedge"`
+	Arbitrage         Arbitrage      `toml:"arbitrage"`
+	Vaults            Vaults         `toml:"vaults"`
+	Liquidation       Liquidation    `toml:"liquidation"`
+	// PowerAddresses are the power contracts scanned by the liquidator,
+	// the power pool contract when empty
+	PowerAddresses []string `toml:"power_addresses"`
+	// Assets set the decimals of denoms, the bank module's denom metadata
+	// is used for others
+	Assets []Asset `toml:"assets"`
 }
 
 // getVaultResponse represents the response structure for querying information about a vault.
@@ -63,9 +270,63 @@ type GetConfigResponse struct {
 	FundingPeriod       int    `json:"funding_period"`
 	BaseDecimals        int    `json:"base_decimals"`
 	PowerDecimals       int    `json:"power_decimals"`
-	IndexScale          int    `json:"index_scale"`
+	IndexScale          Uint   `json:"index_scale"`
 	MinCollateralAmount string `json:"min_collateral_amount"`
 	Version             string `json:"version"`
+	// Exponent of the power perpetual, not reported by every version
+	Exponent string `json:"exponent,omitempty"`
+}
+
+// PowerDenoms returns the power and base asset denoms of the power pool.
+// Power is the contract's power asset, the pool's base and quote denoms say
+// nothing about which of the two it is.
+func (c GetConfigResponse) PowerDenoms() (string, string, error) {
+	power := c.PowerAsset.Denom
+	switch {
+	case power == "":
+		return "", "", fmt.Errorf("power contract config has no power asset")
+	case c.PowerPool.BaseDenom == power:
+		return power, c.PowerPool.QuoteDenom, nil
+	case c.PowerPool.QuoteDenom == power:
+		return power, c.PowerPool.BaseDenom, nil
+	default:
+		return "", "", fmt.Errorf("power pool %d does not hold the power asset %s", c.PowerPool.ID, power)
+	}
+}
+
+// GetVaultResponse is a vault of the power contract, the collateral is in
+// the base asset and the short amount is the power debt.
+type GetVaultResponse struct {
+	Operator    string `json:"operator"`
+	Collateral  string `json:"collateral"`
+	ShortAmount string `json:"short_amount"`
+}
+
+// UserVault is a vault listed by get_user_vaults.
+type UserVault struct {
+	ID uint64 `json:"id"`
+	GetVaultResponse
+}
+
+type GetUserVaultsResponse struct {
+	Vaults []UserVault `json:"vaults"`
+}
+
+// PowerPrices are the index and mark prices reported by the power contract,
+// which reads them from its query contract. The index is unscaled so it is
+// comparable to the denormalised mark.
+type PowerPrices struct {
+	Index     string `json:"index"`
+	IndexTwap string `json:"index_twap"`
+	Mark      string `json:"mark"`
+	// MarkTwap is the mark used for funding
+	MarkTwap string `json:"mark_twap"`
+}
+
+// ContractVersion is the cw2 name and version stored by a contract.
+type ContractVersion struct {
+	Contract string `json:"contract"`
+	Version  string `json:"version"`
 }
 
 type Pool struct {
@@ -73,3 +334,18 @@ type Pool struct {
 	BaseDenom  string `json:"base_denom"`
 	QuoteDenom string `json:"quote_denom"`
 }
+
+// Block is the height and time of a block.
+type Block struct {
+	Height int64     `json:"height"`
+	Time   time.Time `json:"time"`
+}
+
+// ConcentratedPool is the state of a concentrated liquidity pool, its price
+// is token1 per token0.
+type ConcentratedPool struct {
+	ID          uint64 `json:"id"`
+	Token0      string `json:"token0"`
+	Token1      string `json:"token1"`
+	CurrentTick int64  `json:"current_tick"`
+}
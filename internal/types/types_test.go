@@ -0,0 +1,37 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestPowerDenoms(t *testing.T) {
+	var config GetConfigResponse
+	err := json.Unmarshal([]byte(`{
+		"power_asset": {"denom": "usqosmo", "decimals": 6},
+		"base_asset": {"denom": "uosmo", "decimals": 6},
+		"power_pool": {"id": 2, "base_denom": "uosmo", "quote_denom": "usqosmo"}
+	}`), &config)
+	assert.NilError(t, err)
+
+	// The pool's base denom is not necessarily power
+	power, base, err := config.PowerDenoms()
+	assert.NilError(t, err)
+	assert.Equal(t, "usqosmo", power)
+	assert.Equal(t, "uosmo", base)
+
+	config.PowerPool = Pool{ID: 2, BaseDenom: "usqosmo", QuoteDenom: "uosmo"}
+	power, base, err = config.PowerDenoms()
+	assert.NilError(t, err)
+	assert.Equal(t, "usqosmo", power)
+	assert.Equal(t, "uosmo", base)
+
+	config.PowerPool = Pool{ID: 2, BaseDenom: "uosmo", QuoteDenom: "uatom"}
+	_, _, err = config.PowerDenoms()
+	assert.ErrorContains(t, err, "power pool 2 does not hold the power asset usqosmo")
+
+	_, _, err = GetConfigResponse{}.PowerDenoms()
+	assert.ErrorContains(t, err, "no power asset")
+}
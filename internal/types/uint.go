@@ -0,0 +1,54 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// Uint is an unsigned integer of arbitrary size. It decodes from a JSON
+// number or from a string, the way CosmWasm encodes Uint128, and encodes as
+// a string.
+type Uint struct {
+	i *big.Int
+}
+
+// NewUint returns the Uint of n.
+func NewUint(n uint64) Uint {
+	return Uint{i: new(big.Int).SetUint64(n)}
+}
+
+// BigInt returns a copy of the value, zero if unset.
+func (u Uint) BigInt() *big.Int {
+	if u.i == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(u.i)
+}
+
+func (u Uint) String() string {
+	return u.BigInt().String()
+}
+
+func (u Uint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(u.String())
+}
+
+func (u *Uint) UnmarshalJSON(bz []byte) error {
+	var s string
+	if err := json.Unmarshal(bz, &s); err != nil {
+		var n json.Number
+		if err := json.Unmarshal(bz, &n); err != nil {
+			return fmt.Errorf("invalid uint: %s", bz)
+		}
+		s = n.String()
+	}
+
+	i, ok := new(big.Int).SetString(s, 10)
+	if !ok || i.Sign() < 0 {
+		return fmt.Errorf("invalid uint: %s", bz)
+	}
+	u.i = i
+
+	return nil
+}
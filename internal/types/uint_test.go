@@ -0,0 +1,26 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestUintJSON(t *testing.T) {
+	var config struct {
+		Number Uint `json:"number"`
+		String Uint `json:"string"`
+	}
+	err := json.Unmarshal([]byte(`{"number":10000,"string":"340282366920938463463374607431768211455"}`), &config)
+	assert.NilError(t, err)
+	assert.Equal(t, "10000", config.Number.String())
+	assert.Equal(t, "340282366920938463463374607431768211455", config.String.String())
+
+	bz, err := json.Marshal(config.Number)
+	assert.NilError(t, err)
+	assert.Equal(t, `"10000"`, string(bz))
+
+	assert.ErrorContains(t, json.Unmarshal([]byte(`"-1"`), &config.Number), "invalid uint")
+	assert.ErrorContains(t, json.Unmarshal([]byte(`1.5`), &config.Number), "invalid uint")
+}
@@ -0,0 +1,221 @@
+// Package units converts token amounts between raw units, the integers
+// held by the chain, and whole units shown to people, using the decimals of
+// each denom from the config or the bank module's denom metadata.
+package units
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	sdkmath "cosmossdk.io/math"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+
+	"github.com/margined-protocol/flood/internal/fetch"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+// maxDecimals bounds the decimals of a denom
+const maxDecimals = 36
+
+// MetadataQuerier reads the bank module's metadata of a denom.
+type MetadataQuerier interface {
+	DenomMetadata(ctx context.Context, denom string) (banktypes.Metadata, error)
+}
+
+// ToRaw converts an amount in whole units, e.g. "1500.5", to raw units.
+func ToRaw(amount string, decimals uint64) (sdkmath.Int, error) {
+	if decimals > maxDecimals {
+		return sdkmath.Int{}, fmt.Errorf("decimals must be at most %d", maxDecimals)
+	}
+
+	whole, frac, _ := strings.Cut(strings.TrimSpace(amount), ".")
+	if whole == "" && frac == "" {
+		return sdkmath.Int{}, fmt.Errorf("invalid amount: %q", amount)
+	}
+	if uint64(len(frac)) > decimals {
+		if strings.Trim(frac[decimals:], "0") != "" {
+			return sdkmath.Int{}, fmt.Errorf("amount %s has more than %d decimals", amount, decimals)
+		}
+		frac = frac[:decimals]
+	}
+
+	digits := whole + frac + strings.Repeat("0", int(decimals)-len(frac))
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return sdkmath.Int{}, fmt.Errorf("invalid amount: %q", amount)
+		}
+	}
+
+	i, _ := new(big.Int).SetString(digits, 10)
+	return sdkmath.NewIntFromBigInt(i), nil
+}
+
+// Format returns a raw amount in whole units without trailing zeros.
+func Format(raw sdkmath.Int, decimals uint64) string {
+	s := raw.Abs().String()
+	if decimals > 0 {
+		if pad := int(decimals) + 1 - len(s); pad > 0 {
+			s = strings.Repeat("0", pad) + s
+		}
+		point := len(s) - int(decimals)
+		s = strings.TrimRight(strings.TrimRight(s[:point]+"."+s[point:], "0"), ".")
+	}
+	if raw.IsNegative() {
+		return "-" + s
+	}
+	return s
+}
+
+// Registry looks up the decimals of denoms. Configured assets take
+// precedence over denom metadata, which is cached once read. A failed
+// lookup is cached too, until Retry.
+type Registry struct {
+	querier MetadataQuerier
+
+	mu       sync.Mutex
+	decimals map[string]uint64
+	failed   map[string]error
+}
+
+// NewRegistry returns a registry of the configured assets. The querier is
+// optional, without it only configured denoms are known.
+func NewRegistry(assets []types.Asset, querier MetadataQuerier) *Registry {
+	decimals := make(map[string]uint64, len(assets))
+	for _, a := range assets {
+		decimals[a.Denom] = a.Decimals
+	}
+	return &Registry{querier: querier, decimals: decimals, failed: make(map[string]error)}
+}
+
+// Retry forgets failed lookups so the next one queries the metadata again.
+func (r *Registry) Retry() {
+	r.mu.Lock()
+	r.failed = make(map[string]error)
+	r.mu.Unlock()
+}
+
+// Decimals returns the number of decimals of the denom's display unit.
+func (r *Registry) Decimals(ctx context.Context, denom string) (uint64, error) {
+	r.mu.Lock()
+	d, ok := r.decimals[denom]
+	failed := r.failed[denom]
+	r.mu.Unlock()
+	if ok {
+		return d, nil
+	}
+	if failed != nil {
+		return 0, failed
+	}
+
+	if r.querier == nil {
+		return 0, fmt.Errorf("decimals of %s are unknown, set them under [[assets]]", denom)
+	}
+
+	d, err := r.lookup(ctx, denom)
+
+	r.mu.Lock()
+	if err != nil {
+		r.failed[denom] = err
+	} else {
+		r.decimals[denom] = d
+	}
+	r.mu.Unlock()
+
+	return d, err
+}
+
+// lookup reads the decimals of the denom from its metadata
+func (r *Registry) lookup(ctx context.Context, denom string) (uint64, error) {
+	metadata, err := r.querier.DenomMetadata(ctx, denom)
+	if err != nil {
+		return 0, fmt.Errorf("decimals of %s are unknown, set them under [[assets]]: %w", denom, err)
+	}
+
+	d, err := displayDecimals(metadata)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", denom, err)
+	}
+
+	return d, nil
+}
+
+// Load reads the denom metadata of the denoms whose decimals are not yet
+// known concurrently, each bounded by the timeout, and caches it.
+func (r *Registry) Load(ctx context.Context, timeout time.Duration, denoms ...string) error {
+	fetches := make([]fetch.Query, 0, len(denoms))
+	for _, denom := range denoms {
+		denom := denom
+		fetches = append(fetches, fetch.Query{Name: denom + " metadata", Run: func(ctx context.Context) error {
+			_, err := r.Decimals(ctx, denom)
+			return err
+		}})
+	}
+	return fetch.All(ctx, timeout, fetches...)
+}
+
+// Coin converts a config amount of the denom to a coin in raw units.
+func (r *Registry) Coin(ctx context.Context, denom string, amount types.Amount) (sdk.Coin, error) {
+	if !amount.IsWhole() {
+		raw, err := amount.Int()
+		if err != nil {
+			return sdk.Coin{}, err
+		}
+		return sdk.NewCoin(denom, raw), nil
+	}
+
+	decimals, err := r.Decimals(ctx, denom)
+	if err != nil {
+		return sdk.Coin{}, err
+	}
+
+	raw, err := ToRaw(amount.Value(), decimals)
+	if err != nil {
+		return sdk.Coin{}, err
+	}
+
+	return sdk.NewCoin(denom, raw), nil
+}
+
+// Describe returns the coin in raw units followed by whole units, e.g.
+// "1500500000uosmo (1500.5)", or only in raw units if the decimals are
+// unknown.
+func (r *Registry) Describe(ctx context.Context, coin sdk.Coin) string {
+	if coin.Amount.IsNil() {
+		return coin.String()
+	}
+
+	decimals, err := r.Decimals(ctx, coin.Denom)
+	if err != nil {
+		return coin.String()
+	}
+
+	return fmt.Sprintf("%s (%s)", coin, Format(coin.Amount, decimals))
+}
+
+// displayDecimals returns the exponent of the display unit, or of the
+// largest unit if no display unit is set.
+func displayDecimals(metadata banktypes.Metadata) (uint64, error) {
+	var largest *banktypes.DenomUnit
+	for _, unit := range metadata.DenomUnits {
+		if unit == nil {
+			continue
+		}
+		if metadata.Display != "" && unit.Denom == metadata.Display {
+			return uint64(unit.Exponent), nil
+		}
+		if largest == nil || unit.Exponent > largest.Exponent {
+			largest = unit
+		}
+	}
+
+	if largest == nil {
+		return 0, fmt.Errorf("denom metadata has no units")
+	}
+
+	return uint64(largest.Exponent), nil
+}
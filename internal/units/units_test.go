@@ -0,0 +1,153 @@
+package units
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	sdkmath "cosmossdk.io/math"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+func TestToRaw(t *testing.T) {
+	for _, tc := range []struct {
+		amount   string
+		decimals uint64
+		want     string
+	}{
+		{"1500.5", 6, "1500500000"},
+		{"1500", 6, "1500000000"},
+		{".25", 2, "25"},
+		{"007", 0, "7"},
+		{"1.500000000", 6, "1500000"},
+		{"123456789012345678901234567890", 18, "123456789012345678901234567890000000000000000000"},
+	} {
+		raw, err := ToRaw(tc.amount, tc.decimals)
+		assert.NilError(t, err, tc.amount)
+		assert.Equal(t, tc.want, raw.String())
+	}
+
+	for _, amount := range []string{"", ".", "-1", "1e6", "1,000", "1.2.3"} {
+		_, err := ToRaw(amount, 6)
+		assert.ErrorContains(t, err, "invalid amount", amount)
+	}
+
+	_, err := ToRaw("1.0000001", 6)
+	assert.ErrorContains(t, err, "more than 6 decimals")
+}
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "1500.5", Format(sdkmath.NewInt(1500500000), 6))
+	assert.Equal(t, "0.000001", Format(sdkmath.NewInt(1), 6))
+	assert.Equal(t, "2", Format(sdkmath.NewInt(2000000), 6))
+	assert.Equal(t, "0", Format(sdkmath.ZeroInt(), 6))
+	assert.Equal(t, "-0.5", Format(sdkmath.NewInt(-5), 1))
+	assert.Equal(t, "42", Format(sdkmath.NewInt(42), 0))
+}
+
+type fakeMetadata struct {
+	metadata map[string]banktypes.Metadata
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (f *fakeMetadata) DenomMetadata(_ context.Context, denom string) (banktypes.Metadata, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	m, ok := f.metadata[denom]
+	if !ok {
+		return banktypes.Metadata{}, errors.New("not found")
+	}
+	return m, nil
+}
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	q := &fakeMetadata{metadata: map[string]banktypes.Metadata{
+		"uosmo": {Display: "osmo", DenomUnits: []*banktypes.DenomUnit{{Denom: "uosmo"}, {Denom: "osmo", Exponent: 6}}},
+		// Without a display unit the largest is used
+		"wei":   {DenomUnits: []*banktypes.DenomUnit{{Denom: "wei"}, {Denom: "gwei", Exponent: 9}, {Denom: "eth", Exponent: 18}}},
+		"empty": {},
+	}}
+	r := NewRegistry([]types.Asset{{Denom: "uosmo", Decimals: 4}, {Denom: "usqosmo", Decimals: 6}}, q)
+
+	// Configured decimals take precedence
+	d, err := r.Decimals(ctx, "uosmo")
+	assert.NilError(t, err)
+	assert.Equal(t, uint64(4), d)
+	assert.Equal(t, 0, q.calls)
+
+	d, err = r.Decimals(ctx, "wei")
+	assert.NilError(t, err)
+	assert.Equal(t, uint64(18), d)
+	_, err = r.Decimals(ctx, "wei")
+	assert.NilError(t, err)
+	assert.Equal(t, 1, q.calls)
+
+	_, err = r.Decimals(ctx, "empty")
+	assert.ErrorContains(t, err, "no units")
+	_, err = r.Decimals(ctx, "ibc/ABC")
+	assert.ErrorContains(t, err, "set them under [[assets]]")
+
+	coin, err := r.Coin(ctx, "usqosmo", types.WholeAmount("1.5"))
+	assert.NilError(t, err)
+	assert.Equal(t, "1500000usqosmo", coin.String())
+
+	// Raw amounts need no decimals
+	coin, err = r.Coin(ctx, "ibc/ABC", types.RawAmount(sdkmath.NewInt(7)))
+	assert.NilError(t, err)
+	assert.Equal(t, int64(7), coin.Amount.Int64())
+
+	assert.Equal(t, "1500000usqosmo (1.5)", r.Describe(ctx, sdk.NewInt64Coin("usqosmo", 1500000)))
+	assert.Equal(t, "7ibc/ABC", r.Describe(ctx, sdk.NewInt64Coin("ibc/ABC", 7)))
+}
+
+func TestRegistryCachesFailedLookups(t *testing.T) {
+	ctx := context.Background()
+	q := &fakeMetadata{metadata: map[string]banktypes.Metadata{}}
+	r := NewRegistry(nil, q)
+
+	_, err := r.Decimals(ctx, "uosmo")
+	assert.ErrorContains(t, err, "decimals of uosmo are unknown")
+	assert.Equal(t, "5uosmo", r.Describe(ctx, sdk.NewInt64Coin("uosmo", 5)))
+	_, err = r.Decimals(ctx, "uosmo")
+	assert.ErrorContains(t, err, "decimals of uosmo are unknown")
+	assert.Equal(t, 1, q.calls)
+
+	// The metadata is queried again after a retry
+	q.metadata["uosmo"] = banktypes.Metadata{DenomUnits: []*banktypes.DenomUnit{{Denom: "uosmo"}, {Denom: "osmo", Exponent: 6}}}
+	r.Retry()
+	d, err := r.Decimals(ctx, "uosmo")
+	assert.NilError(t, err)
+	assert.Equal(t, uint64(6), d)
+	assert.Equal(t, 2, q.calls)
+}
+
+func TestRegistryLoad(t *testing.T) {
+	ctx := context.Background()
+	q := &fakeMetadata{metadata: map[string]banktypes.Metadata{
+		"uosmo": {Display: "osmo", DenomUnits: []*banktypes.DenomUnit{{Denom: "uosmo"}, {Denom: "osmo", Exponent: 6}}},
+		"uatom": {Display: "atom", DenomUnits: []*banktypes.DenomUnit{{Denom: "uatom"}, {Denom: "atom", Exponent: 6}}},
+	}}
+	r := NewRegistry([]types.Asset{{Denom: "usqosmo", Decimals: 6}}, q)
+
+	// Configured denoms are not queried and a missing denom is named
+	err := r.Load(ctx, time.Second, "uosmo", "uatom", "usqosmo", "ibc/ABC")
+	assert.ErrorContains(t, err, "ibc/ABC metadata")
+	assert.Equal(t, 3, q.calls)
+
+	// Loaded decimals are cached
+	d, err := r.Decimals(ctx, "uatom")
+	assert.NilError(t, err)
+	assert.Equal(t, uint64(6), d)
+	assert.NilError(t, r.Load(ctx, time.Second, "uosmo", "uatom"))
+	assert.Equal(t, 3, q.calls)
+}
@@ -0,0 +1,200 @@
+// Package vault keeps the bot's power vaults away from liquidation. Each
+// vault's collateral ratio is measured at the index and, once it falls to
+// the warning ratio, it is restored to the target by depositing collateral
+// or burning power to repay debt.
+package vault
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	sdkmath "cosmossdk.io/math"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+
+	"github.com/margined-protocol/flood/internal/maths"
+	"github.com/margined-protocol/flood/internal/power"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+// Action is how a vault is topped up.
+type Action string
+
+const (
+	ActionNone    Action = ""
+	ActionDeposit Action = "deposit"
+	ActionBurn    Action = "burn"
+	// ActionAuto deposits when the wallet holds enough collateral and burns
+	// power otherwise
+	ActionAuto Action = "auto"
+)
+
+const (
+	defaultLiquidationRatio = "1.5"
+	defaultWarningRatio     = "1.7"
+	defaultTargetRatio      = "2"
+)
+
+// Market is the state vault ratios are measured against.
+type Market struct {
+	BaseDenom           string
+	PowerDenom          string
+	BasePrice           string
+	NormalisationFactor string
+	Power               maths.Power
+}
+
+// Status is the health of a vault and the top up planned for it.
+type Status struct {
+	ID          uint64      `json:"id"`
+	Collateral  sdkmath.Int `json:"collateral"`
+	ShortAmount sdkmath.Int `json:"short_amount"`
+	Ratio       float64     `json:"ratio"`
+	// Liquidatable is set when the ratio is below the liquidation ratio
+	Liquidatable bool     `json:"liquidatable"`
+	Action       Action   `json:"action,omitempty"`
+	Amount       sdk.Coin `json:"amount"`
+	// Shortfall is set when the wallet cannot restore the target ratio
+	Shortfall bool `json:"shortfall,omitempty"`
+}
+
+type params struct {
+	liquidation float64
+	warning     float64
+	target      float64
+	action      Action
+}
+
+func parseParams(cfg types.Vaults) (params, error) {
+	var p params
+	var err error
+
+	if p.liquidation, err = strconv.ParseFloat(types.OrDefault(cfg.LiquidationRatio, defaultLiquidationRatio), 64); err != nil {
+		return p, fmt.Errorf("invalid liquidation ratio: %w", err)
+	}
+	if p.warning, err = strconv.ParseFloat(types.OrDefault(cfg.WarningRatio, defaultWarningRatio), 64); err != nil {
+		return p, fmt.Errorf("invalid warning ratio: %w", err)
+	}
+	if p.target, err = strconv.ParseFloat(types.OrDefault(cfg.TargetRatio, defaultTargetRatio), 64); err != nil {
+		return p, fmt.Errorf("invalid target ratio: %w", err)
+	}
+	p.action = Action(types.OrDefault(cfg.Action, string(ActionAuto)))
+
+	switch {
+	case p.liquidation < 1:
+		return p, fmt.Errorf("liquidation ratio must be at least 1")
+	case p.warning <= p.liquidation:
+		return p, fmt.Errorf("warning ratio must be above the liquidation ratio")
+	case p.target <= p.warning:
+		return p, fmt.Errorf("target ratio must be above the warning ratio")
+	}
+
+	switch p.action {
+	case ActionDeposit, ActionBurn, ActionAuto:
+	default:
+		return p, fmt.Errorf("unknown vault action %q", p.action)
+	}
+
+	return p, nil
+}
+
+// Plan measures every vault and plans a top up for those at or below the
+// warning ratio, paid from the balances. Balances are shared between vaults
+// in the order given. A vault the wallet cannot restore receives what is
+// available and is marked with a shortfall.
+func Plan(cfg types.Vaults, vaults []types.UserVault, market Market, balances sdk.Coins) ([]Status, error) {
+	p, err := parseParams(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := market.Power.PowerValue(market.BasePrice, market.NormalisationFactor)
+	if err != nil {
+		return nil, err
+	}
+	if value <= 0 {
+		return nil, fmt.Errorf("power value must be positive")
+	}
+
+	baseAvailable := balances.AmountOf(market.BaseDenom)
+	powerAvailable := balances.AmountOf(market.PowerDenom)
+
+	statuses := make([]Status, 0, len(vaults))
+	for _, v := range vaults {
+		collateral, ok := sdkmath.NewIntFromString(v.Collateral)
+		if !ok {
+			return nil, fmt.Errorf("invalid collateral of vault %d: %s", v.ID, v.Collateral)
+		}
+		short, ok := sdkmath.NewIntFromString(v.ShortAmount)
+		if !ok {
+			return nil, fmt.Errorf("invalid short amount of vault %d: %s", v.ID, v.ShortAmount)
+		}
+
+		ratio, err := market.Power.CollateralRatio(v.Collateral, v.ShortAmount, market.BasePrice, market.NormalisationFactor)
+		if err != nil {
+			return nil, fmt.Errorf("vault %d: %w", v.ID, err)
+		}
+
+		s := Status{
+			ID:           v.ID,
+			Collateral:   collateral,
+			ShortAmount:  short,
+			Ratio:        ratio,
+			Liquidatable: ratio < p.liquidation,
+		}
+
+		if ratio <= p.warning {
+			debt, _ := short.ToLegacyDec().Float64()
+			held, _ := collateral.ToLegacyDec().Float64()
+
+			// Deposit until collateral / (debt * value) reaches the target
+			deposit := sdkmath.NewInt(int64(math.Ceil(p.target*debt*value - held)))
+			// Burn until collateral / ((debt - burn) * value) reaches it
+			burn := sdkmath.NewInt(int64(math.Ceil(debt - held/(p.target*value))))
+			if burn.GT(short) {
+				burn = short
+			}
+
+			switch {
+			case p.action != ActionBurn && deposit.LTE(baseAvailable):
+				s.Action, s.Amount = ActionDeposit, sdk.NewCoin(market.BaseDenom, deposit)
+			case p.action != ActionDeposit && burn.LTE(powerAvailable):
+				s.Action, s.Amount = ActionBurn, sdk.NewCoin(market.PowerDenom, burn)
+			case p.action == ActionBurn:
+				s.Action, s.Amount, s.Shortfall = ActionBurn, sdk.NewCoin(market.PowerDenom, powerAvailable), true
+			default:
+				s.Action, s.Amount, s.Shortfall = ActionDeposit, sdk.NewCoin(market.BaseDenom, baseAvailable), true
+			}
+
+			switch s.Action {
+			case ActionDeposit:
+				baseAvailable = baseAvailable.Sub(s.Amount.Amount)
+			case ActionBurn:
+				powerAvailable = powerAvailable.Sub(s.Amount.Amount)
+			}
+
+			// Nothing left to top up with
+			if !s.Amount.IsPositive() {
+				s.Action = ActionNone
+			}
+		}
+
+		statuses = append(statuses, s)
+	}
+
+	return statuses, nil
+}
+
+// Msg returns the message topping up the vault, or nil if none is planned.
+func (s Status) Msg(sender, contract string) (sdk.Msg, error) {
+	switch s.Action {
+	case ActionNone:
+		return nil, nil
+	case ActionDeposit:
+		return power.DepositMsg(sender, contract, s.ID, s.Amount)
+	case ActionBurn:
+		return power.BurnPowerPerpMsg(sender, contract, s.Amount, s.ID, sdkmath.ZeroInt())
+	default:
+		return nil, fmt.Errorf("unknown vault action %q", s.Action)
+	}
+}
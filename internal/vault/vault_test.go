@@ -0,0 +1,115 @@
+package vault
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"gotest.tools/assert"
+
+	"github.com/margined-protocol/flood/internal/maths"
+	"github.com/margined-protocol/flood/internal/types"
+)
+
+const (
+	baseDenom  = "uosmo"
+	powerDenom = "usqosmo"
+)
+
+// One power is worth 0.001 base, so a debt of 1m is worth 1000
+var market = Market{
+	BaseDenom:           baseDenom,
+	PowerDenom:          powerDenom,
+	BasePrice:           "10",
+	NormalisationFactor: "1",
+	Power:               maths.MustNewPower("2", 10000),
+}
+
+func userVault(id uint64, collateral, short string) types.UserVault {
+	return types.UserVault{ID: id, GetVaultResponse: types.GetVaultResponse{Collateral: collateral, ShortAmount: short}}
+}
+
+var vaults = []types.UserVault{
+	userVault(1, "1600", "1000000"),
+	userVault(2, "5000", "1000000"),
+	userVault(3, "1400", "1000000"),
+	userVault(4, "100", "0"),
+}
+
+var balances = sdk.NewCoins(sdk.NewInt64Coin(baseDenom, 500), sdk.NewInt64Coin(powerDenom, 1_000_000))
+
+func TestPlanAuto(t *testing.T) {
+	statuses, err := Plan(types.Vaults{}, vaults, market, balances)
+	assert.NilError(t, err)
+	assert.Equal(t, 4, len(statuses))
+
+	assert.Equal(t, 1.6, statuses[0].Ratio)
+	assert.Assert(t, !statuses[0].Liquidatable)
+	assert.Equal(t, ActionDeposit, statuses[0].Action)
+	assert.Equal(t, "400"+baseDenom, statuses[0].Amount.String())
+
+	assert.Equal(t, 5.0, statuses[1].Ratio)
+	assert.Equal(t, ActionNone, statuses[1].Action)
+
+	// Only 100 base is left, so debt is repaid instead
+	assert.Assert(t, statuses[2].Liquidatable)
+	assert.Equal(t, ActionBurn, statuses[2].Action)
+	assert.Equal(t, "300000"+powerDenom, statuses[2].Amount.String())
+	assert.Assert(t, !statuses[2].Shortfall)
+
+	assert.Assert(t, math.IsInf(statuses[3].Ratio, 1))
+	assert.Equal(t, ActionNone, statuses[3].Action)
+}
+
+func TestPlanDepositShortfall(t *testing.T) {
+	statuses, err := Plan(types.Vaults{Action: "deposit"}, vaults, market, balances)
+	assert.NilError(t, err)
+
+	assert.Equal(t, ActionDeposit, statuses[2].Action)
+	assert.Equal(t, "100"+baseDenom, statuses[2].Amount.String())
+	assert.Assert(t, statuses[2].Shortfall)
+
+	// Nothing is left for another vault
+	statuses, err = Plan(types.Vaults{Action: "deposit"}, vaults[2:], market, sdk.NewCoins())
+	assert.NilError(t, err)
+	assert.Equal(t, ActionNone, statuses[0].Action)
+	assert.Assert(t, statuses[0].Shortfall)
+}
+
+func TestPlanInvalidConfig(t *testing.T) {
+	_, err := Plan(types.Vaults{WarningRatio: "1.4"}, vaults, market, balances)
+	assert.ErrorContains(t, err, "warning ratio")
+	_, err = Plan(types.Vaults{TargetRatio: "1.6"}, vaults, market, balances)
+	assert.ErrorContains(t, err, "target ratio")
+	_, err = Plan(types.Vaults{Action: "sell"}, vaults, market, balances)
+	assert.ErrorContains(t, err, "unknown vault action")
+	_, err = Plan(types.Vaults{}, []types.UserVault{userVault(1, "x", "1")}, market, balances)
+	assert.ErrorContains(t, err, "invalid collateral")
+}
+
+func TestStatusMsg(t *testing.T) {
+	statuses, err := Plan(types.Vaults{}, vaults, market, balances)
+	assert.NilError(t, err)
+
+	msg, err := statuses[1].Msg("osmo1bot", "osmo1power")
+	assert.NilError(t, err)
+	assert.Assert(t, msg == nil)
+
+	msg, err = statuses[0].Msg("osmo1bot", "osmo1power")
+	assert.NilError(t, err)
+	deposit := msg.(*wasmtypes.MsgExecuteContract)
+	assert.Equal(t, "400"+baseDenom, deposit.Funds.String())
+	assert.Equal(t, `{"deposit":{"vault_id":1}}`, string(deposit.Msg))
+
+	msg, err = statuses[2].Msg("osmo1bot", "osmo1power")
+	assert.NilError(t, err)
+	burn := msg.(*wasmtypes.MsgExecuteContract)
+	assert.Equal(t, "300000"+powerDenom, burn.Funds.String())
+	var execute map[string]map[string]interface{}
+	assert.NilError(t, json.Unmarshal(burn.Msg, &execute))
+	assert.Equal(t, 3.0, execute["burn_power_perp"]["vault_id"])
+	_, ok := execute["burn_power_perp"]["amount_to_withdraw"]
+	assert.Assert(t, !ok)
+}
@@ -0,0 +1,64 @@
+// Package volatility estimates realised volatility from price samples and
+// scales range widths with it.
+package volatility
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+var ErrInsufficientSamples = errors.New("insufficient samples")
+
+// Sample is a price observed at a time.
+type Sample struct {
+	Time  time.Time
+	Price float64
+}
+
+// Realised returns the volatility of log returns over the horizon. Samples
+// may be irregularly spaced, each squared return is normalised by its
+// interval so the result is independent of the sampling frequency.
+// Non-positive prices and samples sharing a time are ignored.
+func Realised(samples []Sample, horizon time.Duration) (float64, int, error) {
+	sorted := make([]Sample, 0, len(samples))
+	for _, s := range samples {
+		if s.Price > 0 && !math.IsInf(s.Price, 0) && !math.IsNaN(s.Price) {
+			sorted = append(sorted, s)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	var sum float64
+	returns := 0
+	for i := 1; i < len(sorted); i++ {
+		dt := sorted[i].Time.Sub(sorted[i-1].Time).Seconds()
+		if dt <= 0 {
+			continue
+		}
+		r := math.Log(sorted[i].Price / sorted[i-1].Price)
+		sum += r * r / dt
+		returns++
+	}
+
+	if returns == 0 {
+		return 0, 0, ErrInsufficientSamples
+	}
+
+	variancePerSecond := sum / float64(returns)
+
+	return math.Sqrt(variancePerSecond * horizon.Seconds()), returns, nil
+}
+
+// Width returns multiplier standard deviations clamped to the bounds.
+func Width(vol, multiplier, min, max float64) float64 {
+	width := vol * multiplier
+	if width < min {
+		return min
+	}
+	if max > 0 && width > max {
+		return max
+	}
+	return width
+}
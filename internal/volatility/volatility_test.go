@@ -0,0 +1,73 @@
+package volatility
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func series(start time.Time, step time.Duration, prices ...float64) []Sample {
+	samples := make([]Sample, len(prices))
+	for i, p := range prices {
+		samples[i] = Sample{Time: start.Add(time.Duration(i) * step), Price: p}
+	}
+	return samples
+}
+
+func TestRealisedScalesWithHorizon(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	up := math.Exp(0.01)
+
+	// Alternating 1% log moves every minute
+	samples := series(start, time.Minute, 1, up, 1, up, 1)
+
+	vol, returns, err := Realised(samples, time.Minute)
+	assert.NilError(t, err)
+	assert.Equal(t, 4, returns)
+	assert.Assert(t, math.Abs(vol-0.01) < 1e-9)
+
+	// Four times the horizon doubles the volatility
+	vol, _, err = Realised(samples, 4*time.Minute)
+	assert.NilError(t, err)
+	assert.Assert(t, math.Abs(vol-0.02) < 1e-9)
+}
+
+func TestRealisedIsIndependentOfSampling(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+
+	// The same 1% move per minute sampled every two minutes
+	samples := series(start, 2*time.Minute, 1, math.Exp(0.01*math.Sqrt2), 1)
+
+	vol, _, err := Realised(samples, time.Minute)
+	assert.NilError(t, err)
+	assert.Assert(t, math.Abs(vol-0.01) < 1e-9)
+}
+
+func TestRealisedIgnoresBadSamples(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+
+	_, _, err := Realised([]Sample{{Time: start, Price: 1}}, time.Hour)
+	assert.Assert(t, errors.Is(err, ErrInsufficientSamples))
+
+	// Unsorted input with a zero price and a duplicate time
+	samples := []Sample{
+		{Time: start.Add(time.Minute), Price: 2},
+		{Time: start, Price: 1},
+		{Time: start.Add(time.Minute), Price: 0},
+		{Time: start.Add(time.Minute), Price: 3},
+	}
+	vol, returns, err := Realised(samples, time.Minute)
+	assert.NilError(t, err)
+	assert.Equal(t, 1, returns)
+	assert.Assert(t, math.Abs(vol-math.Log(2)) < 1e-9)
+}
+
+func TestWidth(t *testing.T) {
+	assert.Equal(t, 0.02, Width(0.001, 2, 0.02, 0.3))
+	assert.Equal(t, 0.1, Width(0.05, 2, 0.02, 0.3))
+	assert.Equal(t, 0.3, Width(0.5, 2, 0.02, 0.3))
+	assert.Equal(t, 1.0, Width(0.5, 2, 0.02, 0))
+}